@@ -14,5 +14,7 @@ var (
 func main() {
 	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
 
-	agent.Run()
+	if err := agent.Run(); err != nil {
+		panic(err)
+	}
 }
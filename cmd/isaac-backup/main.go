@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sshirox/isaac/internal/backup"
+	"github.com/sshirox/isaac/internal/certs"
+	"github.com/sshirox/isaac/internal/crypto"
+	"github.com/sshirox/isaac/internal/metric"
+	"github.com/sshirox/isaac/internal/storage"
+	"github.com/sshirox/isaac/internal/storage/pg"
+)
+
+const (
+	usage = `usage: isaac-backup <command> [flags]
+
+Snapshots are referenced by index (0 is the newest), file name, "latest" or an
+RFC 3339 time picking the newest snapshot taken at or before it.
+
+  keygen  -o <key file>
+        generate a new AES-256 backup key
+  rekey   -f <backup dir> [-old <key file,...>] [-new <key file>]
+        re-encrypt every snapshot with the new key, without -new snapshots are decrypted
+  list    -f <backup dir> [-keys <key file,...>]
+        list snapshots with their timestamps
+  diff    -f <backup dir> [-keys <key file,...>] <from> <to>
+        show metrics added, removed or changed between two snapshots
+  export  -f <backup dir> [-keys <key file,...>] [-format json|csv|prometheus] [-s <snapshot>]
+        write a snapshot to stdout
+  restore -f <backup dir> [-keys <key file,...>] [-s <snapshot>] [-a <server> | -d <dsn>]
+        load a snapshot into a running server (-a), a Postgres database (-d)
+        or, without a target, make it the newest snapshot of the backup dir
+`
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen(os.Args[2:])
+	case "rekey":
+		err = rekey(os.Args[2:])
+	case "list":
+		err = list(os.Args[2:])
+	case "diff":
+		err = diff(os.Args[2:])
+	case "export":
+		err = export(os.Args[2:])
+	case "restore":
+		err = restore(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "isaac-backup:", err)
+		os.Exit(1)
+	}
+}
+
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("o", "", "key file to create")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return fmt.Errorf("key file is required")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fprintln(f, hex.EncodeToString(raw)); err != nil {
+		return err
+	}
+
+	key, err := backup.NewKey(raw)
+	if err != nil {
+		return err
+	}
+	fmt.Println("created key", key.ID)
+
+	return nil
+}
+
+func rekey(args []string) error {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	dir := fs.String("f", os.Getenv("FILE_STORAGE_PATH"), "backup directory")
+	oldKeys := fs.String("old", "", "comma separated key files able to decrypt current records")
+	newKey := fs.String("new", "", "key file to encrypt records with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return fmt.Errorf("backup directory is required")
+	}
+
+	keys, err := readKeyring(*oldKeys)
+	if err != nil {
+		return err
+	}
+
+	var key *backup.Key
+	if *newKey != "" {
+		if key, err = backup.ReadKey(*newKey); err != nil {
+			return err
+		}
+	}
+
+	if err = backup.Rekey(*dir, keys, key); err != nil {
+		return err
+	}
+
+	if key != nil {
+		fmt.Println("re-encrypted with key", key.ID)
+	} else {
+		fmt.Println("decrypted")
+	}
+
+	return nil
+}
+
+func list(args []string) error {
+	fs, dir, keys := storeFlags("list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir, *keys, false)
+	if err != nil {
+		return err
+	}
+
+	gens, err := store.Generations()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDEX\tTIMESTAMP\tFILE\tSIZE\tMETRICS")
+	for i, g := range gens {
+		status := ""
+		snap, err := store.Load(g)
+		if err != nil {
+			status = "invalid: " + err.Error()
+		} else {
+			status = strconv.Itoa(len(snap.Gauges) + len(snap.Counters))
+		}
+
+		ts := g.Time
+		if snap != nil {
+			ts = snap.Timestamp
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\n", i, ts.Local().Format("2006-01-02T15:04:05.000Z07:00"), g.Path, g.Size, status)
+	}
+
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+
+	if store.HasLegacy() {
+		fmt.Fprintln(os.Stderr, "legacy metrics.bk is not listed, it becomes generations once the server or a promoting restore opens the directory")
+	}
+
+	return nil
+}
+
+func diff(args []string) error {
+	fs, dir, keys := storeFlags("diff")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("diff needs two snapshots")
+	}
+
+	store, err := openStore(*dir, *keys, false)
+	if err != nil {
+		return err
+	}
+
+	from, err := loadSnapshot(store, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	to, err := loadSnapshot(store, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("--- %s %s\n+++ %s %s\n", from.Path, from.Timestamp.Format(time.RFC3339), to.Path, to.Timestamp.Format(time.RFC3339))
+	for _, c := range backup.Diff(from, to) {
+		switch {
+		case c.Old == nil:
+			fmt.Printf("+ %s %s %s\n", c.Kind, c.ID, formatValue(*c.New))
+		case c.New == nil:
+			fmt.Printf("- %s %s %s\n", c.Kind, c.ID, formatValue(*c.Old))
+		default:
+			fmt.Printf("~ %s %s %s -> %s\n", c.Kind, c.ID, formatValue(*c.Old), formatValue(*c.New))
+		}
+	}
+
+	return nil
+}
+
+func export(args []string) error {
+	fs, dir, keys := storeFlags("export")
+	format := fs.String("format", backup.FormatJSON, "output format: json, csv or prometheus")
+	ref := fs.String("s", "latest", "snapshot to export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*dir, *keys, false)
+	if err != nil {
+		return err
+	}
+
+	snap, err := loadSnapshot(store, *ref)
+	if err != nil {
+		return err
+	}
+
+	return backup.Export(os.Stdout, snap, *format)
+}
+
+func restore(args []string) error {
+	fs, dir, keys := storeFlags("restore")
+	ref := fs.String("s", "latest", "snapshot to restore")
+	addr := fs.String("a", "", "address of a running server")
+	dsn := fs.String("d", "", "database DSN")
+	token := fs.String("token", os.Getenv("TOKEN"), "api token with write scope")
+	hashKey := fs.String("k", os.Getenv("KEY"), "request signing key of the server")
+	caPath := fs.String("tca", os.Getenv("TLS_CA"), "tls CA path used to verify the server")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Only promoting writes to the store, restoring elsewhere leaves it as it is.
+	store, err := openStore(*dir, *keys, *addr == "" && *dsn == "")
+	if err != nil {
+		return err
+	}
+
+	snap, err := loadSnapshot(store, *ref)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *addr != "":
+		err = restoreToServer(snap, *addr, *token, *hashKey, *caPath)
+	case *dsn != "":
+		err = restoreToDatabase(snap, *dsn)
+	default:
+		err = store.Promote(snap)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored %s taken at %s\n", snap.Path, snap.Timestamp.Format(time.RFC3339))
+
+	return nil
+}
+
+// restoreToServer sends snapshot values to the server. Counters are additive there,
+// so the difference to the current value is sent to end up with the snapshot value.
+func restoreToServer(snap *backup.Snapshot, addr, token, hashKey, caPath string) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if caPath != "" {
+		cfg, err := certs.ClientConfig(caPath, "", "")
+		if err != nil {
+			return err
+		}
+		client.Transport = &http.Transport{TLSClientConfig: cfg}
+	}
+
+	base := addr
+	if !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		base = "http://" + base
+		if caPath != "" {
+			base = "https://" + addr
+		}
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	metrics := make([]metric.Metrics, 0, len(snap.Gauges)+len(snap.Counters))
+	for id, val := range snap.Gauges {
+		v := val
+		metrics = append(metrics, metric.Metrics{ID: id, MType: metric.GaugeMetricType, Value: &v})
+	}
+
+	for id, val := range snap.Counters {
+		current, err := currentCounter(client, base, token, id)
+		if err != nil {
+			return err
+		}
+
+		if delta := val - current; delta != 0 {
+			metrics = append(metrics, metric.Metrics{ID: id, MType: metric.CounterMetricType, Delta: &delta})
+		}
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, base+"/updates/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if enc := crypto.NewEncoder(hashKey); enc.IsEnabled() {
+		req.Header.Set(crypto.SignHeader, enc.Encode(body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server responded %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+func currentCounter(client *http.Client, base, token, id string) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, base+"/value/counter/"+url.PathEscape(id), nil)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	case http.StatusNotFound:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("read counter %s: server responded %s", id, resp.Status)
+	}
+}
+
+// restoreToDatabase upserts snapshot values, metrics missing from the snapshot are kept
+func restoreToDatabase(snap *backup.Snapshot, dsn string) error {
+	db, err := pg.Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err = pg.Bootstrap(db, ctx); err != nil {
+		return err
+	}
+
+	ms := storage.NewMemStorage()
+	snap.Apply(ms)
+
+	_, err = pg.NewSaver(db).Save(ctx, ms)
+
+	return err
+}
+
+func storeFlags(name string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dir := fs.String("f", os.Getenv("FILE_STORAGE_PATH"), "backup directory")
+	keys := fs.String("keys", os.Getenv("BACKUP_KEY"), "comma separated key files able to decrypt snapshots")
+
+	return fs, dir, keys
+}
+
+// openStore opens the store read-only unless writable, only a writable store
+// compacts a legacy metrics.bk
+func openStore(dir, keyPaths string, writable bool) (*backup.Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("backup directory is required")
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	keys, err := readKeyring(keyPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	if !writable {
+		return backup.OpenReadOnly(dir, keys)
+	}
+
+	// Promoted snapshots are written with the first key so they stay encrypted.
+	var key *backup.Key
+	for _, k := range strings.Split(keyPaths, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			if key, err = backup.ReadKey(k); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return backup.NewStore(dir, backup.Retention{Generations: 1 << 20}, key, keys)
+}
+
+func loadSnapshot(store *backup.Store, ref string) (*backup.Snapshot, error) {
+	g, err := store.Find(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Load(g)
+}
+
+func readKeyring(paths string) (backup.Keyring, error) {
+	var keys []*backup.Key
+	for _, p := range strings.Split(paths, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+
+		k, err := backup.ReadKey(p)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return backup.NewKeyring(keys...), nil
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/sshirox/isaac/internal/auth"
+)
+
+const (
+	dbTokenStore = "database"
+	usage        = `usage: isaac-token <mint|revoke|list> [flags]
+
+  mint   -store <path|database> [-d dsn] -name <name> -scopes <read,write,admin> [-prefixes <p1,p2>]
+  revoke -store <path|database> [-d dsn] -id <token id>
+  list   -store <path|database> [-d dsn]
+`
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "isaac-token:", err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	storePath := fs.String("store", os.Getenv("TOKEN_STORE"), "path to tokens file or \"database\"")
+	dsn := fs.String("d", os.Getenv("DATABASE_DSN"), "database DSN")
+	name := fs.String("name", "", "token name")
+	scopes := fs.String("scopes", "", "comma separated scopes: read, write, admin")
+	prefixes := fs.String("prefixes", "", "comma separated metric name prefixes the token is limited to")
+	id := fs.String("id", "", "token id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store, closeStore, err := openStore(ctx, *storePath, *dsn)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	switch cmd {
+	case "mint":
+		return mint(ctx, store, *name, *scopes, *prefixes)
+	case "revoke":
+		if *id == "" {
+			return fmt.Errorf("token id is required")
+		}
+		if err = store.Revoke(ctx, *id); err != nil {
+			return err
+		}
+		fmt.Println("revoked", *id)
+		return nil
+	case "list":
+		return list(ctx, store)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	return nil
+}
+
+func openStore(ctx context.Context, path, dsn string) (auth.Store, func(), error) {
+	switch path {
+	case "":
+		return nil, nil, fmt.Errorf("token store is required")
+	case dbTokenStore:
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		store, err := auth.NewPGStore(ctx, db)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return store, func() { db.Close() }, nil
+	default:
+		return auth.NewFileStore(path), func() {}, nil
+	}
+}
+
+func mint(ctx context.Context, store auth.Store, name, scopes, prefixes string) error {
+	if name == "" {
+		return fmt.Errorf("token name is required")
+	}
+
+	sc, err := auth.ParseScopes(scopes)
+	if err != nil {
+		return err
+	}
+
+	var pr []string
+	for _, p := range strings.Split(prefixes, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			pr = append(pr, p)
+		}
+	}
+
+	t, value, err := auth.Mint(name, sc, pr)
+	if err != nil {
+		return err
+	}
+
+	if err = store.Save(ctx, t); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "minted token %s (%s), it is shown only once:\n", t.ID, t.Name)
+	fmt.Println(value)
+
+	return nil
+}
+
+func list(ctx context.Context, store auth.Store) error {
+	tokens, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPES\tPREFIXES\tCREATED\tREVOKED")
+	for _, t := range tokens {
+		var scopes []string
+		for _, sc := range t.Scopes {
+			scopes = append(scopes, string(sc))
+		}
+
+		revoked := "-"
+		if t.RevokedAt != nil {
+			revoked = t.RevokedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(scopes, ","),
+			strings.Join(t.Prefixes, ","), t.CreatedAt.Format(time.RFC3339), revoked)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sshirox/isaac/internal/crypto"
+)
+
+// keygen writes <out>.pem (PKCS#8, encrypted with -passphrase) and <out>.pub.pem (PKIX).
+//
+// RSA pairs are used for body encryption: the server gets the private key (crypto_key)
+// and the agent the public one. ECDSA and Ed25519 pairs are used for signing: the agent
+// gets the private key (sign_key) and the server the public one.
+func main() {
+	keyType := flag.String("type", "ed25519", "key type: rsa, ecdsa or ed25519")
+	bits := flag.Int("bits", 4096, "rsa key size")
+	curve := flag.String("curve", "p256", "ecdsa curve: p256, p384 or p521")
+	out := flag.String("out", "isaac", "output file prefix")
+	passphrase := flag.String("passphrase", os.Getenv("KEY_PASSPHRASE"), "encrypt the private key with the passphrase")
+	flag.Parse()
+
+	if err := run(*keyType, *bits, *curve, *out, *passphrase); err != nil {
+		fmt.Fprintln(os.Stderr, "keygen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(keyType string, bits int, curve, out, passphrase string) error {
+	key, err := generate(keyType, bits, curve)
+	if err != nil {
+		return err
+	}
+
+	privPEM, err := crypto.MarshalPrivateKey(key, []byte(passphrase))
+	if err != nil {
+		return err
+	}
+
+	pubPEM, err := crypto.MarshalPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+
+	if err = writeFile(out+".pem", privPEM, 0600); err != nil {
+		return err
+	}
+
+	if err = writeFile(out+".pub.pem", pubPEM, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("private key: %s.pem\npublic key:  %s.pub.pem\n", out, out)
+
+	return nil
+}
+
+func generate(keyType string, bits int, curve string) (gocrypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, bits)
+	case "ecdsa":
+		c, err := parseCurve(curve)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(c, rand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unknown key type %q", keyType)
+	}
+}
+
+func parseCurve(name string) (elliptic.Curve, error) {
+	switch strings.ToLower(name) {
+	case "p256":
+		return elliptic.P256(), nil
+	case "p384":
+		return elliptic.P384(), nil
+	case "p521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unknown curve %q", name)
+	}
+}
+
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
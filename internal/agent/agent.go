@@ -5,12 +5,14 @@ import (
 	"context"
 	crand "crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sshirox/isaac/internal/net"
 	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"log/slog"
 	"math/rand"
@@ -19,6 +21,7 @@ import (
 	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -27,22 +30,29 @@ import (
 	"github.com/shirou/gopsutil/mem"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/sshirox/isaac/internal/audit"
+	"github.com/sshirox/isaac/internal/certs"
 	"github.com/sshirox/isaac/internal/compress"
 	"github.com/sshirox/isaac/internal/crypto"
 	errs "github.com/sshirox/isaac/internal/errors"
+	"github.com/sshirox/isaac/internal/ingest"
 	"github.com/sshirox/isaac/internal/metric"
 	"github.com/sshirox/isaac/internal/ratelimit"
 	"github.com/sshirox/isaac/internal/retries"
+	"github.com/sshirox/isaac/internal/statsd"
 )
 
 const (
-	proto                 = "http"
 	updateMetricsPath     = "update"
 	bulkUpdateMetricsPath = "updates"
 )
 
 var (
+	proto     = "http"
 	publicKey *rsa.PublicKey
+	signer    *crypto.KeySigner
+	tlsConfig *tls.Config
+	agentID   string
 )
 
 type Monitor struct {
@@ -51,6 +61,10 @@ type Monitor struct {
 	client    *resty.Client
 	encoder   *crypto.Encoder
 	limiter   *ratelimit.Limiter
+	streamer  *streamer
+	statsd    *statsd.Aggregator
+	// unsent are the StatsD series of failed reports, merged into the next one
+	unsent []ingest.Series
 }
 
 func (mt *Monitor) pollMetrics() {
@@ -103,20 +117,39 @@ func (mt *Monitor) pollMetrics() {
 	mt.pollCount++
 }
 
-func Run() {
+func Run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer cancel()
 
 	parseFlags()
-	initConf()
+	if err := initConf(); err != nil {
+		return err
+	}
 
 	encoder := crypto.NewEncoder(flagEncryptionKey)
 	limiter := ratelimit.NewLimiter(flagRateLimit)
 	mt := Monitor{
 		encoder: encoder,
-		client:  resty.New(),
+		client:  newHTTPClient(),
 		limiter: limiter,
 	}
+	if flagGRPCAddr != "" && flagGRPCStream {
+		mt.streamer = newStreamer(flagGRPCAddr, flagRateLimit)
+		defer mt.streamer.close()
+	}
+
+	var statsdListener *statsd.Listener
+	if flagStatsdAddr != "" {
+		mt.statsd = statsd.NewAggregator(statsd.DefaultMaxSeries)
+		l, err := statsd.NewListener(flagStatsdAddr, mt.statsd)
+		if err != nil {
+			slog.Error("[agent.Run] start statsd listener", "err", err)
+			mt.statsd = nil
+		} else {
+			statsdListener = l
+			slog.Info("[agent.Run] StatsD metrics are relayed with every report", "address", l.Addr().String())
+		}
+	}
 
 	pollTicker := time.NewTicker(time.Duration(pollInterval) * time.Second)
 	defer pollTicker.Stop()
@@ -127,6 +160,18 @@ func Run() {
 
 	slog.Info("[agent.Run] Agent launched for sending metrics to", "address", serverAddr)
 
+	if statsdListener != nil {
+		group.Go(func() error {
+			stop := make(chan struct{})
+			go func() {
+				<-groupCtx.Done()
+				close(stop)
+			}()
+			statsdListener.Serve(stop)
+			return nil
+		})
+	}
+
 	group.Go(func() error {
 		for {
 			select {
@@ -149,17 +194,27 @@ func Run() {
 			case <-reportTicker.C:
 				slog.Info("[agent.Run] Send report")
 
-				if flagGRPCAddr != "" {
-					err := mt.sendGRPCMetrics(flagGRPCAddr)
+				relayed := mt.flushStatsd()
+				var err error
+				if flagGRPCAddr != "" && flagGRPCStream {
+					err = mt.streamer.send(mt.pbMetrics(relayed))
+					if err != nil {
+						slog.Error("[agent.Run] stream metrics", "error", err)
+					}
+				} else if flagGRPCAddr != "" {
+					err = mt.sendGRPCMetrics(flagGRPCAddr, relayed)
 					if err != nil {
 						slog.Error("[agent.Run] bulk sending metrics", "error", err)
 					}
 				} else {
-					err := mt.bulkSendMetrics()
+					err = mt.bulkSendMetrics(relayed)
 					if err != nil {
 						slog.Error("[agent.Run] bulk sending metrics", "error", err)
 					}
 				}
+				if err != nil {
+					mt.unsent = relayed
+				}
 			}
 		}
 	})
@@ -167,9 +222,10 @@ func Run() {
 	if err := group.Wait(); err != nil {
 		slog.ErrorContext(ctx, "Run agent", "err", err)
 	}
+	return nil
 }
 
-func initConf() {
+func initConf() error {
 	addrFromEnv := os.Getenv("ADDRESS")
 	reportIntervalFromEnv := os.Getenv("REPORT_INTERVAL")
 	pollIntervalFromEnv := os.Getenv("POLL_INTERVAL")
@@ -215,14 +271,43 @@ func initConf() {
 		flagGRPCAddr = envGRPCAddr
 	}
 
-	var err error
-	if flagCryptoKeyPath != "" {
-		publicKey, err = crypto.ReadPublicKey(flagCryptoKeyPath)
+	if envStatsdAddr := os.Getenv("STATSD_ADDRESS"); envStatsdAddr != "" {
+		flagStatsdAddr = envStatsdAddr
+	}
+
+	if envGRPCStream := os.Getenv("GRPC_STREAM"); envGRPCStream != "" {
+		stream, err := strconv.ParseBool(envGRPCStream)
 		if err != nil {
-			slog.Error("[agent.initConf] read public key")
+			slog.Error("grpc stream conv", "err", err)
+		} else {
+			flagGRPCStream = stream
 		}
 	}
 
+	if envSignKey := os.Getenv("SIGN_KEY"); envSignKey != "" {
+		flagSignKeyPath = envSignKey
+	}
+
+	if envSignKeyPassphrase := os.Getenv("SIGN_KEY_PASSPHRASE"); envSignKeyPassphrase != "" {
+		flagSignKeyPassphrase = envSignKeyPassphrase
+	}
+
+	if envTLSCA := os.Getenv("TLS_CA"); envTLSCA != "" {
+		flagTLSCAPath = envTLSCA
+	}
+
+	if envTLSCert := os.Getenv("TLS_CERT"); envTLSCert != "" {
+		flagTLSCertPath = envTLSCert
+	}
+
+	if envTLSKey := os.Getenv("TLS_KEY"); envTLSKey != "" {
+		flagTLSKeyPath = envTLSKey
+	}
+
+	if envToken := os.Getenv("TOKEN"); envToken != "" {
+		flagToken = envToken
+	}
+
 	if envConfigPath := os.Getenv("CONFIG"); envConfigPath != "" {
 		flagConfigPath = envConfigPath
 	}
@@ -233,6 +318,95 @@ func initConf() {
 			slog.Error("[server.initConf] load config file")
 		}
 	}
+
+	var err error
+	agentID, err = os.Hostname()
+	if err != nil {
+		slog.Error("[agent.initConf] resolve hostname", "err", err)
+	}
+
+	if flagTLSCAPath != "" || flagTLSCertPath != "" {
+		tlsConfig, err = certs.ClientConfig(flagTLSCAPath, flagTLSCertPath, flagTLSKeyPath)
+		if err != nil {
+			return errors.Wrap(err, "[agent.initConf] load tls config")
+		}
+		proto = "https"
+	}
+	// The token grants write access, it must not travel in plain text over HTTP or gRPC.
+	if flagToken != "" && tlsConfig == nil {
+		return errors.New("[agent.initConf] a token is sent over TLS only, set the TLS CA or client certificate")
+	}
+
+	if flagCryptoKeyPath != "" {
+		key, err := crypto.ReadPublicKey(flagCryptoKeyPath)
+		if err != nil {
+			slog.Error("[agent.initConf] read public key", "err", err)
+		} else if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			publicKey = rsaKey
+		} else {
+			slog.Error("[agent.initConf] crypto key must be an RSA key, use sign_key for ECDSA and Ed25519")
+		}
+	}
+
+	if flagSignKeyPath != "" {
+		key, err := crypto.ReadPrivateKey(flagSignKeyPath, []byte(flagSignKeyPassphrase))
+		if err != nil {
+			slog.Error("[agent.initConf] read sign key", "err", err)
+		} else {
+			signer = crypto.NewKeySigner(key)
+		}
+	}
+
+	return nil
+}
+
+func newHTTPClient() *resty.Client {
+	client := resty.New()
+	if tlsConfig != nil {
+		client.SetTLSClientConfig(tlsConfig)
+	}
+	if flagToken != "" {
+		client.SetAuthToken(flagToken)
+	}
+	if agentID != "" {
+		client.SetHeader(audit.AgentIDHeader, agentID)
+	}
+
+	return client
+}
+
+func grpcDialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	opts = append(opts, grpc.WithPerRPCCredentials(callCredentials{token: flagToken, agentID: agentID}))
+
+	return opts
+}
+
+// callCredentials attaches the api token and the agent id to every gRPC call
+type callCredentials struct {
+	token   string
+	agentID string
+}
+
+func (c callCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	md := make(map[string]string)
+	if c.token != "" {
+		md["authorization"] = "Bearer " + c.token
+	}
+	if c.agentID != "" {
+		md[strings.ToLower(audit.AgentIDHeader)] = c.agentID
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity keeps the token off connections without TLS
+func (c callCredentials) RequireTransportSecurity() bool {
+	return c.token != ""
 }
 
 func (mt *Monitor) processReport() error {
@@ -273,7 +447,7 @@ func sendMetric(metric metric.Metrics) error {
 		return err
 	}
 
-	client := resty.New()
+	client := newHTTPClient()
 	err = retries.Retry(func() error {
 		resp, respErr := client.R().
 			SetHeader("Content-Type", "application/json").
@@ -309,7 +483,7 @@ func sendMetric(metric metric.Metrics) error {
 	return nil
 }
 
-func (mt *Monitor) bulkSendMetrics() error {
+func (mt *Monitor) bulkSendMetrics(relayed []ingest.Series) error {
 	slog.Info("[Bulk_Send_Metrics] Start sending metrics")
 
 	var metrics []metric.Metrics
@@ -331,6 +505,18 @@ func (mt *Monitor) bulkSendMetrics() error {
 	}
 	metrics = append(metrics, pc)
 
+	for _, s := range relayed {
+		m := metric.Metrics{ID: s.ID, MType: s.Kind, Labels: s.Labels}
+		if s.Kind == metric.CounterMetricType {
+			delta := int64(s.Value)
+			m.Delta = &delta
+		} else {
+			value := s.Value
+			m.Value = &value
+		}
+		metrics = append(metrics, m)
+	}
+
 	slog.Info("[Bulk_Send_Metrics] metrics", "set", metrics)
 
 	var buf bytes.Buffer
@@ -363,9 +549,11 @@ func (mt *Monitor) bulkSendMetrics() error {
 			SetHeader("Accept-Encoding", "gzip").
 			SetBody(compressedData)
 
-		var ipAddr string
-		ipAddr, err = net.RetrieveLocalIP()
-		if err == nil {
+		ipAddr, ipErr := net.RetrieveSourceIP(serverAddr)
+		if ipErr != nil {
+			ipAddr, ipErr = net.RetrieveLocalIP()
+		}
+		if ipErr == nil {
 			req.SetHeader("X-Real-IP", ipAddr)
 		}
 
@@ -373,6 +561,14 @@ func (mt *Monitor) bulkSendMetrics() error {
 			req = req.SetHeader(crypto.SignHeader, mt.encoder.Encode(buf.Bytes()))
 		}
 
+		if signer != nil {
+			sign, signErr := signer.Sign(data)
+			if signErr != nil {
+				return errors.Wrap(signErr, "[agent.bulkSendMetrics] sign data")
+			}
+			req = req.SetHeader(crypto.SignatureHeader, sign)
+		}
+
 		mt.limiter.Acquire()
 		defer mt.limiter.Release()
 
@@ -399,13 +595,13 @@ func (mt *Monitor) bulkSendMetrics() error {
 	})
 
 	if err != nil {
-		slog.Error("[Bulk_Send_Metrics] sending metrics", "err", err)
+		return errors.Wrap(err, "[agent.bulkSendMetrics] send metrics")
 	}
 
 	return nil
 }
 
-func (mt *Monitor) sendGRPCMetrics(address string) error {
+func (mt *Monitor) pbMetrics(relayed []ingest.Series) []*pb.Metric {
 	var pbMetrics []*pb.Metric
 
 	for id, val := range mt.gauges {
@@ -422,7 +618,36 @@ func (mt *Monitor) sendGRPCMetrics(address string) error {
 		Delta: &mt.pollCount,
 	})
 
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	for _, s := range relayed {
+		m := &pb.Metric{Name: s.ID, Kind: s.Kind, Labels: s.Labels}
+		if s.Kind == metric.CounterMetricType {
+			delta := int64(s.Value)
+			m.Delta = &delta
+		} else {
+			value := s.Value
+			m.Value = &value
+		}
+		pbMetrics = append(pbMetrics, m)
+	}
+
+	return pbMetrics
+}
+
+// flushStatsd returns the StatsD metrics aggregated since the previous successful report.
+// Counters are sent as deltas, gauges hold the current value.
+func (mt *Monitor) flushStatsd() []ingest.Series {
+	if mt.statsd == nil {
+		return nil
+	}
+	series := statsd.Merge(mt.unsent, mt.statsd.Flush())
+	mt.unsent = nil
+	return series
+}
+
+func (mt *Monitor) sendGRPCMetrics(address string, relayed []ingest.Series) error {
+	pbMetrics := mt.pbMetrics(relayed)
+
+	conn, err := grpc.NewClient(address, grpcDialOptions()...)
 	if err != nil {
 		slog.Error("Failed to connect to gRPC server", slog.String("address", address), slog.Any("error", err))
 		return err
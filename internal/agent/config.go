@@ -6,13 +6,21 @@ import (
 )
 
 type Config struct {
-	Address        string `json:"address"`
-	GRPCAddress    string `json:"grpc_address"`
-	HashKey        string `json:"hash_key"`
-	CryptoKeyPath  string `json:"crypto_key"`
-	ReportInterval int64  `json:"report_interval"`
-	PollInterval   int64  `json:"poll_interval"`
-	RateLimit      int64  `json:"rate_limit"`
+	Address           string `json:"address"`
+	GRPCAddress       string `json:"grpc_address"`
+	GRPCStream        bool   `json:"grpc_stream"`
+	HashKey           string `json:"hash_key"`
+	CryptoKeyPath     string `json:"crypto_key"`
+	SignKeyPath       string `json:"sign_key"`
+	SignKeyPassphrase string `json:"sign_key_passphrase"`
+	ReportInterval    int64  `json:"report_interval"`
+	PollInterval      int64  `json:"poll_interval"`
+	RateLimit         int64  `json:"rate_limit"`
+	TLSCAPath         string `json:"tls_ca"`
+	TLSCertPath       string `json:"tls_cert"`
+	TLSKeyPath        string `json:"tls_key"`
+	Token             string `json:"token"`
+	StatsdAddress     string `json:"statsd_address"`
 }
 
 func loadConfigs(path string) error {
@@ -42,6 +50,14 @@ func loadConfigs(path string) error {
 		flagCryptoKeyPath = cfg.CryptoKeyPath
 	}
 
+	if cfg.SignKeyPath != "" && flagSignKeyPath == "" {
+		flagSignKeyPath = cfg.SignKeyPath
+	}
+
+	if cfg.SignKeyPassphrase != "" && flagSignKeyPassphrase == "" {
+		flagSignKeyPassphrase = cfg.SignKeyPassphrase
+	}
+
 	if cfg.ReportInterval != 0 && reportInterval == 0 {
 		reportInterval = cfg.ReportInterval
 	}
@@ -58,5 +74,29 @@ func loadConfigs(path string) error {
 		flagGRPCAddr = cfg.GRPCAddress
 	}
 
+	if cfg.TLSCAPath != "" && flagTLSCAPath == "" {
+		flagTLSCAPath = cfg.TLSCAPath
+	}
+
+	if cfg.TLSCertPath != "" && flagTLSCertPath == "" {
+		flagTLSCertPath = cfg.TLSCertPath
+	}
+
+	if cfg.TLSKeyPath != "" && flagTLSKeyPath == "" {
+		flagTLSKeyPath = cfg.TLSKeyPath
+	}
+
+	if cfg.Token != "" && flagToken == "" {
+		flagToken = cfg.Token
+	}
+
+	if cfg.StatsdAddress != "" && flagStatsdAddr == "" {
+		flagStatsdAddr = cfg.StatsdAddress
+	}
+
+	if cfg.GRPCStream {
+		flagGRPCStream = cfg.GRPCStream
+	}
+
 	return nil
 }
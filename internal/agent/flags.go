@@ -3,27 +3,43 @@ package agent
 import "flag"
 
 var (
-	flagServerAddr     string
-	flagGRPCAddr       string
-	flagReportInterval int64
-	flagPollInterval   int64
-	flagEncryptionKey  string
-	flagRateLimit      int64
-	flagCryptoKeyPath  string
-	serverAddr         string
-	reportInterval     int64
-	pollInterval       int64
-	flagConfigPath     string
+	flagServerAddr        string
+	flagGRPCAddr          string
+	flagGRPCStream        bool
+	flagReportInterval    int64
+	flagPollInterval      int64
+	flagEncryptionKey     string
+	flagRateLimit         int64
+	flagCryptoKeyPath     string
+	flagSignKeyPath       string
+	flagSignKeyPassphrase string
+	serverAddr            string
+	reportInterval        int64
+	pollInterval          int64
+	flagConfigPath        string
+	flagTLSCAPath         string
+	flagTLSCertPath       string
+	flagTLSKeyPath        string
+	flagToken             string
+	flagStatsdAddr        string
 )
 
 func parseFlags() {
 	flag.StringVar(&flagServerAddr, "a", "localhost:8080", "server address and port")
 	flag.StringVar(&flagGRPCAddr, "ga", "", "server grpc address")
+	flag.BoolVar(&flagGRPCStream, "gs", false, "keep one grpc stream open for sending metrics")
 	flag.Int64Var(&flagReportInterval, "r", 10, "report interval in seconds")
 	flag.Int64Var(&flagPollInterval, "p", 2, "poll interval in seconds")
 	flag.StringVar(&flagEncryptionKey, "k", "", "encryption key")
 	flag.Int64Var(&flagRateLimit, "l", 10, "rate limit")
 	flag.StringVar(&flagCryptoKeyPath, "ck", "", "crypto key path")
+	flag.StringVar(&flagSignKeyPath, "sk", "", "private key path used to sign requests")
+	flag.StringVar(&flagSignKeyPassphrase, "skp", "", "sign key passphrase, used when the key is encrypted")
 	flag.StringVar(&flagConfigPath, "c", "", "config file path")
+	flag.StringVar(&flagTLSCAPath, "tca", "", "tls CA path used to verify the server")
+	flag.StringVar(&flagTLSCertPath, "tc", "", "tls client certificate path")
+	flag.StringVar(&flagTLSKeyPath, "tk", "", "tls client key path")
+	flag.StringVar(&flagToken, "at", "", "api token, requires TLS")
+	flag.StringVar(&flagStatsdAddr, "sd", "", "address of the StatsD listener relaying metrics with every report, e.g. :8125")
 	flag.Parse()
 }
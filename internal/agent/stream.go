@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
+	"github.com/sshirox/isaac/internal/ratelimit"
+)
+
+// streamer keeps a single StreamMetrics stream open and pushes batches over it.
+// At most window batches may wait for an ack, further sends block until the server catches up.
+type streamer struct {
+	address string
+	window  *ratelimit.Limiter
+
+	mu      sync.Mutex
+	conn    *grpc.ClientConn
+	stream  pb.MetricsService_StreamMetricsClient
+	cancel  context.CancelFunc
+	seq     uint64
+	pending int
+}
+
+func newStreamer(address string, window int64) *streamer {
+	if window <= 0 {
+		window = 1
+	}
+
+	return &streamer{
+		address: address,
+		window:  ratelimit.NewLimiter(window),
+	}
+}
+
+func (st *streamer) send(metrics []*pb.Metric) error {
+	st.window.Acquire()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.stream == nil {
+		if err := st.open(); err != nil {
+			st.window.Release()
+			return err
+		}
+	}
+
+	st.seq++
+	err := st.stream.Send(&pb.MetricsBatch{Seq: st.seq, Metrics: metrics})
+	if err != nil {
+		st.window.Release()
+		st.reset()
+		return errors.Wrap(err, "[agent.streamer] send batch")
+	}
+	st.pending++
+
+	slog.Info("Batch sent to stream", slog.Uint64("seq", st.seq), slog.Int("count", len(metrics)))
+
+	return nil
+}
+
+func (st *streamer) open() error {
+	if st.conn == nil {
+		conn, err := grpc.NewClient(st.address, grpcDialOptions()...)
+		if err != nil {
+			return errors.Wrap(err, "[agent.streamer] connect")
+		}
+		st.conn = conn
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := pb.NewMetricsServiceClient(st.conn).StreamMetrics(ctx)
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, "[agent.streamer] open stream")
+	}
+
+	st.stream = stream
+	st.cancel = cancel
+	go st.receiveAcks(stream)
+
+	return nil
+}
+
+func (st *streamer) receiveAcks(stream pb.MetricsService_StreamMetricsClient) {
+	for {
+		ack, err := stream.Recv()
+		if err != nil {
+			slog.Error("Metrics stream closed", slog.Any("error", err))
+
+			st.mu.Lock()
+			if st.stream == stream {
+				st.reset()
+			}
+			st.mu.Unlock()
+
+			return
+		}
+
+		if len(ack.Errors) > 0 {
+			slog.Warn("Batch partially rejected", slog.Uint64("seq", ack.Seq), slog.Any("errors", ack.Errors))
+		}
+
+		st.mu.Lock()
+		if st.stream == stream && st.pending > 0 {
+			st.pending--
+			st.window.Release()
+		}
+		st.mu.Unlock()
+	}
+}
+
+// reset drops the current stream and frees the window taken by unacked batches.
+func (st *streamer) reset() {
+	if st.cancel != nil {
+		st.cancel()
+	}
+	st.stream = nil
+	st.cancel = nil
+
+	for ; st.pending > 0; st.pending-- {
+		st.window.Release()
+	}
+}
+
+func (st *streamer) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.stream != nil {
+		_ = st.stream.CloseSend()
+	}
+	st.reset()
+
+	if st.conn != nil {
+		_ = st.conn.Close()
+		st.conn = nil
+	}
+}
@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Action is the kind of mutation recorded in the audit log
+type Action string
+
+const (
+	ActionUpdate     Action = "update"
+	ActionBulkUpdate Action = "bulk_update"
+	ActionDelete     Action = "delete"
+)
+
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+
+	// AgentIDHeader carries the agent identifier in HTTP headers and gRPC metadata
+	AgentIDHeader = "X-Agent-ID"
+
+	defaultRecent = 1000
+)
+
+// Entry is a single audit record
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Action    Action    `json:"action"`
+	Transport string    `json:"transport"`
+	Source    string    `json:"source,omitempty"`
+	AgentID   string    `json:"agent_id,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Kind      string    `json:"type"`
+	Name      string    `json:"id"`
+	OldValue  *float64  `json:"old_value,omitempty"`
+	NewValue  *float64  `json:"new_value,omitempty"`
+	OldDelta  *int64    `json:"old_delta,omitempty"`
+	NewDelta  *int64    `json:"new_delta,omitempty"`
+}
+
+// Sink persists audit entries
+type Sink interface {
+	Write(e Entry) error
+	Close() error
+}
+
+// Logger fans entries out to sinks and keeps the most recent ones in memory
+type Logger struct {
+	sinks []Sink
+
+	mu     sync.RWMutex
+	recent []Entry
+	next   int
+	full   bool
+}
+
+// NewLogger creates new instance of Logger
+func NewLogger(sinks ...Sink) *Logger {
+	return &Logger{
+		sinks:  sinks,
+		recent: make([]Entry, defaultRecent),
+	}
+}
+
+// Record stores the entry in memory and writes it to every sink
+func (l *Logger) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	l.recent[l.next] = e
+	l.next = (l.next + 1) % len(l.recent)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+
+	for _, s := range l.sinks {
+		if err := s.Write(e); err != nil {
+			slog.Error("write audit entry", "err", err)
+		}
+	}
+}
+
+// Query filters recent entries, newest first
+type Query struct {
+	Name   string
+	Action Action
+	Since  time.Time
+	Limit  int
+}
+
+// Recent returns the most recent entries matching q, newest first
+func (l *Logger) Recent(q Query) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.recent)
+	}
+
+	res := make([]Entry, 0)
+	for i := 0; i < n; i++ {
+		e := l.recent[(l.next-1-i+len(l.recent))%len(l.recent)]
+		if q.Name != "" && e.Name != q.Name {
+			continue
+		}
+		if q.Action != "" && e.Action != q.Action {
+			continue
+		}
+		if !q.Since.IsZero() && e.Time.Before(q.Since) {
+			continue
+		}
+		res = append(res, e)
+		if q.Limit > 0 && len(res) >= q.Limit {
+			break
+		}
+	}
+
+	return res
+}
+
+// Close closes every sink
+func (l *Logger) Close() error {
+	var err error
+	for _, s := range l.sinks {
+		if closeErr := s.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+type ctxKey struct{}
+
+// Actor describes who performs the mutations of a request and how
+type Actor struct {
+	Action    Action
+	Transport string
+	Source    string
+	AgentID   string
+	Token     string
+}
+
+type request struct {
+	logger *Logger
+	actor  Actor
+}
+
+// NewContext marks ctx as audited, mutations applied with it are recorded on behalf of actor
+func (l *Logger) NewContext(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &request{logger: l, actor: actor})
+}
+
+func fromContext(ctx context.Context) *request {
+	r, _ := ctx.Value(ctxKey{}).(*request)
+	return r
+}
+
+func (r *request) record(e Entry) {
+	e.Action = r.actor.Action
+	e.Transport = r.actor.Transport
+	e.Source = r.actor.Source
+	e.AgentID = r.actor.AgentID
+	e.Token = r.actor.Token
+	r.logger.Record(e)
+}
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+type memSink struct {
+	entries []Entry
+}
+
+func (s *memSink) Write(e Entry) error {
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *memSink) Close() error {
+	return nil
+}
+
+func TestUpdateCounter(t *testing.T) {
+	sink := &memSink{}
+	l := NewLogger(sink)
+	ms := storage.NewMemStorage()
+	ctx := l.NewContext(context.Background(), Actor{
+		Action:    ActionUpdate,
+		Transport: TransportHTTP,
+		Source:    "10.0.0.1",
+		AgentID:   "agent-1",
+	})
+
+	UpdateCounter(ctx, ms, "PollCount", 2)
+	UpdateCounter(ctx, ms, "PollCount", 3)
+	UpdateCounter(context.Background(), ms, "PollCount", 4)
+
+	require.Len(t, sink.entries, 2)
+	assert.Nil(t, sink.entries[0].OldDelta)
+	assert.Equal(t, int64(2), *sink.entries[0].NewDelta)
+	assert.Equal(t, int64(2), *sink.entries[1].OldDelta)
+	assert.Equal(t, int64(5), *sink.entries[1].NewDelta)
+	assert.Equal(t, "agent-1", sink.entries[1].AgentID)
+	assert.Equal(t, "10.0.0.1", sink.entries[1].Source)
+}
+
+func TestLogger_Recent(t *testing.T) {
+	l := NewLogger()
+	ctx := l.NewContext(context.Background(), Actor{Action: ActionUpdate})
+	ms := storage.NewMemStorage()
+
+	for i := 0; i < defaultRecent+10; i++ {
+		UpdateGauge(ctx, ms, "Alloc", float64(i))
+	}
+	UpdateGauge(ctx, ms, "HeapAlloc", 1)
+
+	recent := l.Recent(Query{Limit: 2})
+	require.Len(t, recent, 2)
+	assert.Equal(t, "HeapAlloc", recent[0].Name)
+	assert.Equal(t, float64(defaultRecent+9), *recent[1].NewValue)
+
+	assert.Len(t, l.Recent(Query{Name: "HeapAlloc"}), 1)
+	assert.Len(t, l.Recent(Query{}), defaultRecent)
+	assert.Empty(t, l.Recent(Query{Action: ActionDelete}))
+}
+
+func TestFileSink_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	s, err := NewFileSink(path, 200, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, s.Write(Entry{Action: ActionUpdate, Kind: "gauge", Name: "Alloc"}))
+	}
+	require.NoError(t, s.Close())
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(200))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHTTPSink(t *testing.T) {
+	var mu sync.Mutex
+	var got []Entry
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []Entry
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		mu.Lock()
+		got = append(got, batch...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := NewHTTPSink(srv.URL)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.Write(Entry{Action: ActionDelete, Name: "Alloc"}))
+	}
+	require.NoError(t, s.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, got, 3)
+}
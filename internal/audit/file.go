@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxSize    = 10 << 20
+	defaultMaxBackups = 5
+)
+
+// FileSink appends entries as JSON lines and rotates the file once it grows over maxSize,
+// rotated files are named path.1 (newest) to path.N (oldest)
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewFileSink opens the audit file, non positive limits fall back to 10 MiB and 5 backups
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+
+	s := &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileSink) Write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "[audit.FileSink] marshal entry")
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "[audit.FileSink] write entry")
+	}
+
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "[audit.FileSink] open file")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "[audit.FileSink] stat file")
+	}
+
+	s.f = f
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return errors.Wrap(err, "[audit.FileSink] close file")
+	}
+
+	_ = os.Remove(s.backup(s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(s.backup(i), s.backup(i+1))
+	}
+
+	if err := os.Rename(s.path, s.backup(1)); err != nil {
+		return errors.Wrap(err, "[audit.FileSink] rotate file")
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	httpQueueSize     = 4096
+	httpBatchSize     = 100
+	httpFlushInterval = time.Second
+	httpTimeout       = 5 * time.Second
+)
+
+// HTTPSink posts batches of entries as a JSON array to url in background.
+// Entries are dropped when the endpoint cannot keep up and the queue is full.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+	queue  chan Entry
+	done   chan struct{}
+}
+
+// NewHTTPSink creates the sink and starts its sender
+func NewHTTPSink(url string) *HTTPSink {
+	s := &HTTPSink{
+		url:    url,
+		client: &http.Client{Timeout: httpTimeout},
+		queue:  make(chan Entry, httpQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *HTTPSink) Write(e Entry) error {
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		return errors.New("[audit.HTTPSink] queue is full, entry dropped")
+	}
+}
+
+// Close flushes queued entries and stops the sender
+func (s *HTTPSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
+
+func (s *HTTPSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(httpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Entry, 0, httpBatchSize)
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= httpBatchSize {
+				s.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (s *HTTPSink) send(batch []Entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		slog.Error("marshal audit entries", "err", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("create audit request", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		slog.Error("send audit entries", "err", err, "count", len(batch))
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		slog.Error("send audit entries", "status", resp.StatusCode, "count", len(batch))
+	}
+}
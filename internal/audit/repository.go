@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+// Repository is the part of the storage mutations are applied to
+type Repository interface {
+	UpdateGauge(string, float64)
+	UpdateCounter(string, int64)
+	ReceiveGauge(string) (float64, bool)
+	ReceiveCounter(string) (int64, bool)
+}
+
+// UpdateGauge updates the gauge and records the change when the context is audited
+func UpdateGauge(ctx context.Context, repo Repository, id string, value float64) {
+	r := fromContext(ctx)
+	if r == nil {
+		repo.UpdateGauge(id, value)
+		return
+	}
+
+	e := Entry{Kind: metric.GaugeMetricType, Name: id}
+	if old, ok := repo.ReceiveGauge(id); ok {
+		e.OldValue = &old
+	}
+
+	repo.UpdateGauge(id, value)
+
+	if val, ok := repo.ReceiveGauge(id); ok {
+		e.NewValue = &val
+	}
+	r.record(e)
+}
+
+// UpdateCounter updates the counter and records the change when the context is audited
+func UpdateCounter(ctx context.Context, repo Repository, id string, delta int64) {
+	r := fromContext(ctx)
+	if r == nil {
+		repo.UpdateCounter(id, delta)
+		return
+	}
+
+	e := Entry{Kind: metric.CounterMetricType, Name: id}
+	if old, ok := repo.ReceiveCounter(id); ok {
+		e.OldDelta = &old
+	}
+
+	repo.UpdateCounter(id, delta)
+
+	if val, ok := repo.ReceiveCounter(id); ok {
+		e.NewDelta = &val
+	}
+	r.record(e)
+}
+
+// Deleted records removal of a metric with its last value
+func Deleted(ctx context.Context, kind, id string, oldValue *float64, oldDelta *int64) {
+	r := fromContext(ctx)
+	if r == nil {
+		return
+	}
+
+	r.record(Entry{Kind: kind, Name: id, OldValue: oldValue, OldDelta: oldDelta})
+}
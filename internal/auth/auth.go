@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type ctxKey struct{}
+
+// Authenticator checks tokens presented by clients against a store
+type Authenticator struct {
+	store Store
+}
+
+// NewAuthenticator creates new instance of Authenticator
+func NewAuthenticator(store Store) *Authenticator {
+	return &Authenticator{
+		store: store,
+	}
+}
+
+// Authenticate resolves the token value and checks it grants scope
+func (a *Authenticator) Authenticate(ctx context.Context, value string, scope Scope) (*Token, error) {
+	id, secret, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := a.store.Get(ctx, id)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "[auth.Authenticate] get token")
+	}
+
+	if t.RevokedAt != nil || !t.verify(secret) {
+		return nil, ErrUnauthenticated
+	}
+
+	if !t.HasScope(scope) {
+		return nil, ErrForbidden
+	}
+
+	return t, nil
+}
+
+// BearerToken extracts the token from an Authorization header value
+func BearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) > len(prefix) && strings.EqualFold(header[:len(prefix)], prefix) {
+		return header[len(prefix):]
+	}
+
+	return ""
+}
+
+// WithToken stores the authenticated token in the context
+func WithToken(ctx context.Context, t *Token) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext returns the authenticated token, nil when authentication is disabled
+func FromContext(ctx context.Context) *Token {
+	t, _ := ctx.Value(ctxKey{}).(*Token)
+	return t
+}
+
+// AllowsName reports whether the request context may access the metric name
+func AllowsName(ctx context.Context, name string) bool {
+	t := FromContext(ctx)
+	return t == nil || t.AllowsName(name)
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	authn := NewAuthenticator(store)
+
+	writer, writerValue, err := Mint("agent", []Scope{ScopeWrite}, []string{"Heap"})
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, writer))
+
+	admin, adminValue, err := Mint("admin", []Scope{ScopeAdmin}, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, admin))
+
+	testCases := []struct {
+		name    string
+		value   string
+		scope   Scope
+		wantErr error
+	}{
+		{name: "Valid scope", value: writerValue, scope: ScopeWrite},
+		{name: "Missing scope", value: writerValue, scope: ScopeRead, wantErr: ErrForbidden},
+		{name: "Admin grants every scope", value: adminValue, scope: ScopeRead},
+		{name: "Empty token", value: "", scope: ScopeRead, wantErr: ErrUnauthenticated},
+		{name: "Malformed token", value: "isaac_xx", scope: ScopeRead, wantErr: ErrUnauthenticated},
+		{name: "Wrong secret", value: "isaac_" + writer.ID + "_00", scope: ScopeWrite, wantErr: ErrUnauthenticated},
+		{name: "Unknown token", value: "isaac_0000000000000000_00", scope: ScopeWrite, wantErr: ErrUnauthenticated},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := authn.Authenticate(ctx, tc.value, tc.scope)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("Revoked token", func(t *testing.T) {
+		require.NoError(t, store.Revoke(ctx, writer.ID))
+
+		_, err := authn.Authenticate(ctx, writerValue, ScopeWrite)
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	})
+}
+
+func TestFileStore_Revoke(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+
+	token, _, err := Mint("agent", []Scope{ScopeWrite}, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, token))
+
+	got, err := store.Get(ctx, token.ID)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			list, _ := store.List(ctx)
+			for _, t := range list {
+				_ = t.RevokedAt
+			}
+		}
+	}()
+	require.NoError(t, store.Revoke(ctx, token.ID))
+	wg.Wait()
+
+	assert.Nil(t, got.RevokedAt)
+	assert.Nil(t, token.RevokedAt)
+
+	revoked, err := store.Get(ctx, token.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+}
+
+func TestToken_AllowsName(t *testing.T) {
+	tok := &Token{Prefixes: []string{"Heap", "Poll"}}
+
+	assert.True(t, tok.AllowsName("HeapAlloc"))
+	assert.True(t, tok.AllowsName("PollCount"))
+	assert.False(t, tok.AllowsName("Alloc"))
+	assert.True(t, (&Token{}).AllowsName("Alloc"))
+
+	ctx := context.Background()
+	assert.True(t, AllowsName(ctx, "Alloc"))
+	assert.False(t, AllowsName(WithToken(ctx, tok), "Alloc"))
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("read, write")
+	require.NoError(t, err)
+	assert.Equal(t, []Scope{ScopeRead, ScopeWrite}, scopes)
+
+	_, err = ParseScopes("owner")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, err = ParseScopes("")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc", BearerToken("Bearer abc"))
+	assert.Equal(t, "abc", BearerToken("bearer abc"))
+	assert.Equal(t, "", BearerToken("Basic abc"))
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileStore keeps tokens in a JSON file, changes made by other processes are picked up on access.
+// Stored tokens are never modified in place, callers get copies they are free to change.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	tokens  map[string]*Token
+}
+
+// NewFileStore creates new instance of FileStore
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		path:   path,
+		tokens: make(map[string]*Token),
+	}
+}
+
+func (s *FileStore) Get(_ context.Context, id string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	return t.clone(), nil
+}
+
+func (s *FileStore) Save(_ context.Context, t *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	s.tokens[t.ID] = t.clone()
+
+	return s.flush()
+}
+
+func (s *FileStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+
+	// The revoked token replaces the stored one, copies handed out before stay as they were.
+	revoked := t.clone()
+	now := time.Now().UTC()
+	revoked.RevokedAt = &now
+	s.tokens[id] = revoked
+
+	return s.flush()
+}
+
+func (s *FileStore) List(_ context.Context) ([]*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	res := make([]*Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		res = append(res, t.clone())
+	}
+
+	return res, nil
+}
+
+func (s *FileStore) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.tokens = make(map[string]*Token)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "[auth.FileStore] stat tokens file")
+	}
+
+	if info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return errors.Wrap(err, "[auth.FileStore] read tokens file")
+	}
+
+	var tokens []*Token
+	if err = json.Unmarshal(data, &tokens); err != nil {
+		return errors.Wrap(err, "[auth.FileStore] unmarshal tokens")
+	}
+
+	s.tokens = make(map[string]*Token, len(tokens))
+	for _, t := range tokens {
+		s.tokens[t.ID] = t
+	}
+	s.modTime = info.ModTime()
+
+	return nil
+}
+
+func (s *FileStore) flush() error {
+	tokens := make([]*Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "[auth.FileStore] marshal tokens")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tokens-*")
+	if err != nil {
+		return errors.Wrap(err, "[auth.FileStore] create temp file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "[auth.FileStore] write tokens")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "[auth.FileStore] write tokens")
+	}
+
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "[auth.FileStore] replace tokens file")
+	}
+
+	info, err := os.Stat(s.path)
+	if err == nil {
+		s.modTime = info.ModTime()
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PGStore keeps tokens in the observability.tokens table
+type PGStore struct {
+	db *sql.DB
+}
+
+// NewPGStore creates the tokens table if needed and returns the store
+func NewPGStore(ctx context.Context, db *sql.DB) (*PGStore, error) {
+	_, err := db.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS observability`)
+	if err != nil {
+		return nil, errors.Wrap(err, "[auth.NewPGStore] create schema")
+	}
+
+	_, err = db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS observability.tokens (
+            id character varying(64) PRIMARY KEY,
+            name character varying(255) NOT NULL,
+            hash character varying(64) NOT NULL,
+            scopes text NOT NULL,
+            prefixes text NOT NULL DEFAULT '',
+            created_at timestamptz NOT NULL,
+            revoked_at timestamptz
+        )
+    `)
+	if err != nil {
+		return nil, errors.Wrap(err, "[auth.NewPGStore] create tokens table")
+	}
+
+	return &PGStore{db: db}, nil
+}
+
+func (s *PGStore) Get(ctx context.Context, id string) (*Token, error) {
+	var t Token
+	var scopes, prefixes string
+	var revokedAt sql.NullTime
+
+	err := s.db.QueryRowContext(ctx, `
+        SELECT id, name, hash, scopes, prefixes, created_at, revoked_at
+            FROM observability.tokens WHERE id = $1`, id).
+		Scan(&t.ID, &t.Name, &t.Hash, &scopes, &prefixes, &t.CreatedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "[auth.PGStore] select token")
+	}
+
+	t.Scopes = splitScopes(scopes)
+	t.Prefixes = splitList(prefixes)
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+
+	return &t, nil
+}
+
+func (s *PGStore) Save(ctx context.Context, t *Token) error {
+	scopes := make([]string, 0, len(t.Scopes))
+	for _, sc := range t.Scopes {
+		scopes = append(scopes, string(sc))
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+        INSERT INTO observability.tokens (id, name, hash, scopes, prefixes, created_at, revoked_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            ON CONFLICT (id)
+            DO UPDATE SET name = $2, hash = $3, scopes = $4, prefixes = $5, revoked_at = $7`,
+		t.ID, t.Name, t.Hash, strings.Join(scopes, ","), strings.Join(t.Prefixes, ","), t.CreatedAt, t.RevokedAt)
+	if err != nil {
+		return errors.Wrap(err, "[auth.PGStore] upsert token")
+	}
+
+	return nil
+}
+
+func (s *PGStore) Revoke(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE observability.tokens SET revoked_at = $2 WHERE id = $1`, id, time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "[auth.PGStore] revoke token")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "[auth.PGStore] revoke token")
+	}
+	if n == 0 {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
+
+func (s *PGStore) List(ctx context.Context) ([]*Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM observability.tokens ORDER BY created_at`)
+	if err != nil {
+		return nil, errors.Wrap(err, "[auth.PGStore] list tokens")
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "[auth.PGStore] scan token")
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "[auth.PGStore] list tokens")
+	}
+
+	res := make([]*Token, 0, len(ids))
+	for _, id := range ids {
+		t, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+
+	return res, nil
+}
+
+func splitScopes(s string) []Scope {
+	var res []Scope
+	for _, sc := range splitList(s) {
+		res = append(res, Scope(sc))
+	}
+	return res
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Scope grants access to a group of operations
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+const (
+	tokenPrefix = "isaac"
+	idLen       = 8
+	secretLen   = 32
+)
+
+var (
+	ErrUnauthenticated = errors.New("invalid or missing token")
+	ErrForbidden       = errors.New("token is not allowed to perform the operation")
+	ErrTokenNotFound   = errors.New("token not found")
+	ErrInvalidScope    = errors.New("invalid scope")
+)
+
+// Token describes an API token, only the hash of its secret is stored
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash"`
+	Scopes    []Scope    `json:"scopes"`
+	Prefixes  []string   `json:"prefixes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// clone returns a deep copy of t
+func (t *Token) clone() *Token {
+	c := *t
+	c.Scopes = slices.Clone(t.Scopes)
+	c.Prefixes = slices.Clone(t.Prefixes)
+	if t.RevokedAt != nil {
+		revokedAt := *t.RevokedAt
+		c.RevokedAt = &revokedAt
+	}
+	return &c
+}
+
+// Store keeps tokens
+type Store interface {
+	Get(ctx context.Context, id string) (*Token, error)
+	Save(ctx context.Context, t *Token) error
+	Revoke(ctx context.Context, id string) error
+	List(ctx context.Context) ([]*Token, error)
+}
+
+// ParseScopes parses comma separated scopes
+func ParseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		sc := Scope(part)
+		if sc != ScopeRead && sc != ScopeWrite && sc != ScopeAdmin {
+			return nil, errors.Wrap(ErrInvalidScope, part)
+		}
+		scopes = append(scopes, sc)
+	}
+
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+
+	return scopes, nil
+}
+
+// Mint creates a token and returns it with the secret value handed to the client
+func Mint(name string, scopes []Scope, prefixes []string) (*Token, string, error) {
+	id := make([]byte, idLen)
+	secret := make([]byte, secretLen)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	t := &Token{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      hash(secret),
+		Scopes:    scopes,
+		Prefixes:  prefixes,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return t, tokenPrefix + "_" + t.ID + "_" + hex.EncodeToString(secret), nil
+}
+
+// HasScope reports whether the token grants scope, admin grants every scope
+func (t *Token) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, ScopeAdmin)
+}
+
+// AllowsName reports whether the token may access the metric name
+func (t *Token) AllowsName(name string) bool {
+	if len(t.Prefixes) == 0 {
+		return true
+	}
+
+	for _, p := range t.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Token) verify(secret []byte) bool {
+	return subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash(secret))) == 1
+}
+
+func parse(value string) (string, []byte, error) {
+	parts := strings.Split(value, "_")
+	if len(parts) != 3 || parts[0] != tokenPrefix {
+		return "", nil, ErrUnauthenticated
+	}
+
+	secret, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, ErrUnauthenticated
+	}
+
+	return parts[1], secret, nil
+}
+
+func hash(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:])
+}
@@ -2,31 +2,55 @@ package backup
 
 import (
 	"encoding/json"
-	"os"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/sshirox/isaac/internal/storage"
 )
 
-// SaveBackup save metrics from storage to file
-func SaveBackup(ms *storage.MemStorage, f *os.File) error {
-	m := ms.ReceiveAllMetrics()
+// Save writes metrics from storage as a new snapshot generation, encrypted when the store has a key
+func (s *Store) Save(ms *storage.MemStorage) error {
+	// Reading and writing under one lock keeps concurrent saves from
+	// storing an older state as the newest generation.
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	d, err := json.Marshal(m)
+	s.err = s.save(ms)
+	return s.err
+}
+
+func (s *Store) save(ms *storage.MemStorage) error {
+	now := time.Now()
+	bf := backupFile{
+		Timestamp: now.UTC(),
+		Gauges:    ms.ReceiveAllGauges(),
+		Counters:  ms.ReceiveAllCounters(),
+	}
+
+	d, err := json.Marshal(bf)
 	if err != nil {
 		return errors.Wrap(err, "marshal metrics")
 	}
 
-	_, err = f.Write(d)
-	if err != nil {
-		return errors.Wrap(err, "write metrics")
+	if s.key != nil {
+		d, err = s.key.Encrypt(d)
+		if err != nil {
+			return errors.Wrap(err, "encrypt metrics")
+		}
 	}
 
-	_, err = f.WriteString("\n")
-	if err != nil {
+	if err = s.write(d, now); err != nil {
 		return errors.Wrap(err, "write metrics")
 	}
 
 	return nil
 }
+
+// Health returns the error of the latest save, nil when it succeeded
+func (s *Store) Health() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	encMagic   = "isaac-enc"
+	encVersion = "v1"
+)
+
+var (
+	ErrUnknownKey = errors.New("backup is encrypted with unknown key")
+	ErrEncrypted  = errors.New("backup is encrypted but no key is configured")
+)
+
+// Key is an AES-GCM key used to encrypt backups at rest, its ID is derived from the key material
+type Key struct {
+	ID   string
+	aead cipher.AEAD
+}
+
+// ReadKey loads a key file containing 16, 24 or 32 raw bytes or their hex encoding
+func ReadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := data
+	if trimmed := bytes.TrimSpace(data); len(trimmed)%2 == 0 {
+		if dec, decErr := hex.DecodeString(string(trimmed)); decErr == nil {
+			raw = dec
+		}
+	}
+
+	return NewKey(raw)
+}
+
+// NewKey creates key from raw AES key material
+func NewKey(raw []byte) (*Key, error) {
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "create cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "create gcm")
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return &Key{
+		ID:   hex.EncodeToString(sum[:4]),
+		aead: aead,
+	}, nil
+}
+
+// Keyring holds keys able to decrypt backups
+type Keyring map[string]*Key
+
+// NewKeyring creates keyring of non nil keys
+func NewKeyring(keys ...*Key) Keyring {
+	kr := make(Keyring)
+	for _, k := range keys {
+		if k != nil {
+			kr[k.ID] = k
+		}
+	}
+	return kr
+}
+
+// Encrypt seals a record as "isaac-enc:v1:<key id>:<base64 nonce and ciphertext>",
+// the header is authenticated together with the payload
+func (k *Key) Encrypt(plain []byte) ([]byte, error) {
+	header := k.header()
+
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+
+	sealed := k.aead.Seal(nonce, nonce, plain, header)
+
+	res := make([]byte, 0, len(header)+base64.StdEncoding.EncodedLen(len(sealed)))
+	res = append(res, header...)
+	return base64.StdEncoding.AppendEncode(res, sealed), nil
+}
+
+func (k *Key) header() []byte {
+	return []byte(encMagic + ":" + encVersion + ":" + k.ID + ":")
+}
+
+// IsEncrypted reports whether the record carries the encryption header
+func IsEncrypted(record []byte) bool {
+	return bytes.HasPrefix(record, []byte(encMagic+":"))
+}
+
+// RecordKeyID returns the ID of the key an encrypted record was sealed with
+func RecordKeyID(record []byte) (string, error) {
+	parts := bytes.SplitN(record, []byte(":"), 4)
+	if len(parts) != 4 || string(parts[0]) != encMagic {
+		return "", errors.New("invalid encryption header")
+	}
+	if string(parts[1]) != encVersion {
+		return "", errors.Errorf("unsupported encryption version %q", parts[1])
+	}
+
+	return string(parts[2]), nil
+}
+
+// Decrypt opens an encrypted record, plaintext records are returned as is
+func (kr Keyring) Decrypt(record []byte) ([]byte, error) {
+	if !IsEncrypted(record) {
+		return record, nil
+	}
+
+	id, err := RecordKeyID(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kr) == 0 {
+		return nil, ErrEncrypted
+	}
+
+	k, ok := kr[id]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownKey, id)
+	}
+
+	header := k.header()
+	sealed, err := base64.StdEncoding.DecodeString(string(record[len(header):]))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode encrypted record")
+	}
+
+	ns := k.aead.NonceSize()
+	if len(sealed) < ns {
+		return nil, errors.New("encrypted record is too short")
+	}
+
+	plain, err := k.aead.Open(nil, sealed[:ns], sealed[ns:], header)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt record")
+	}
+
+	return plain, nil
+}
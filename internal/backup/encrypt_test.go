@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func newTestKey(t *testing.T, b byte) *Key {
+	t.Helper()
+
+	raw := make([]byte, 32)
+	for i := range raw {
+		raw[i] = b
+	}
+
+	k, err := NewKey(raw)
+	require.NoError(t, err)
+
+	return k
+}
+
+func TestKey_Encrypt(t *testing.T) {
+	k := newTestKey(t, 1)
+
+	record, err := k.Encrypt([]byte(`{"gauges":{}}`))
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(record))
+
+	id, err := RecordKeyID(record)
+	require.NoError(t, err)
+	assert.Equal(t, k.ID, id)
+
+	plain, err := NewKeyring(k).Decrypt(record)
+	require.NoError(t, err)
+	assert.Equal(t, `{"gauges":{}}`, string(plain))
+
+	_, err = NewKeyring().Decrypt(record)
+	assert.ErrorIs(t, err, ErrEncrypted)
+
+	_, err = NewKeyring(newTestKey(t, 2)).Decrypt(record)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// The last base64 characters may only carry padding bits, tamper with one in the middle.
+	i := len(record) - 10
+	if record[i] == 'A' {
+		record[i] = 'B'
+	} else {
+		record[i] = 'A'
+	}
+	_, err = NewKeyring(k).Decrypt(record)
+	assert.Error(t, err)
+}
+
+func TestReadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.key")
+	require.NoError(t, os.WriteFile(path, []byte("0101010101010101010101010101010101010101010101010101010101010101\n"), 0600))
+
+	k, err := ReadKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, newTestKey(t, 1).ID, k.ID)
+}
+
+func TestRestoreEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := newTestKey(t, 1), newTestKey(t, 2)
+
+	ms := storage.NewMemStorage()
+	ms.UpdateGauge("Alloc", 1.5)
+	ms.UpdateCounter("PollCount", 3)
+
+	store, err := NewStore(dir, Retention{}, oldKey, NewKeyring(oldKey))
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ms))
+
+	plain, err := NewStore(dir, Retention{}, nil, nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, plain.Restore(storage.NewMemStorage()), ErrEncrypted)
+
+	require.NoError(t, Rekey(dir, NewKeyring(oldKey), newKey))
+
+	store, err = NewStore(dir, Retention{}, newKey, NewKeyring(newKey))
+	require.NoError(t, err)
+
+	restored := storage.NewMemStorage()
+	require.NoError(t, store.Restore(restored))
+
+	val, _ := restored.ReceiveGauge("Alloc")
+	assert.Equal(t, 1.5, val)
+	delta, _ := restored.ReceiveCounter("PollCount")
+	assert.Equal(t, int64(3), delta)
+}
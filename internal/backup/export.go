@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sshirox/isaac/internal/expfmt"
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+const (
+	FormatJSON       = "json"
+	FormatCSV        = "csv"
+	FormatPrometheus = "prometheus"
+)
+
+// Export writes the snapshot in one of FormatJSON, FormatCSV or FormatPrometheus
+func Export(w io.Writer, snap *Snapshot, format string) error {
+	switch format {
+	case FormatJSON:
+		return exportJSON(w, snap)
+	case FormatCSV:
+		return exportCSV(w, snap)
+	case FormatPrometheus:
+		return exportPrometheus(w, snap)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func exportJSON(w io.Writer, snap *Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(backupFile{
+		Timestamp: snap.Timestamp.UTC(),
+		Gauges:    snap.Gauges,
+		Counters:  snap.Counters,
+	})
+}
+
+func exportCSV(w io.Writer, snap *Snapshot) error {
+	cw := csv.NewWriter(w)
+	ts := snap.Timestamp.UTC().Format(time.RFC3339Nano)
+
+	if err := cw.Write([]string{"timestamp", "type", "name", "value"}); err != nil {
+		return err
+	}
+
+	for _, id := range sortedKeys(snap.Gauges) {
+		val := strconv.FormatFloat(snap.Gauges[id], 'g', -1, 64)
+		if err := cw.Write([]string{ts, metric.GaugeMetricType, id, val}); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range sortedKeys(snap.Counters) {
+		val := strconv.FormatInt(snap.Counters[id], 10)
+		if err := cw.Write([]string{ts, metric.CounterMetricType, id, val}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportPrometheus writes the text exposition format with the snapshot time as sample
+// timestamps. Labelled series are grouped into the family of their name, like the
+// /metrics endpoint a series taken by an earlier one or of another family type is skipped.
+func exportPrometheus(w io.Writer, snap *Snapshot) error {
+	type series struct {
+		kind, family, line, value string
+	}
+
+	all := make([]series, 0, len(snap.Gauges)+len(snap.Counters))
+	add := func(kind, id, value string) {
+		name, labels := expfmt.ParseSeriesID(id)
+		family := expfmt.Name(name)
+		all = append(all, series{kind: kind, family: family, line: expfmt.SeriesID(family, labels), value: value})
+	}
+	for _, id := range sortedKeys(snap.Gauges) {
+		add(metric.GaugeMetricType, id, strconv.FormatFloat(snap.Gauges[id], 'g', -1, 64))
+	}
+	for _, id := range sortedKeys(snap.Counters) {
+		add(metric.CounterMetricType, id, strconv.FormatInt(snap.Counters[id], 10))
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].family != all[j].family {
+			return all[i].family < all[j].family
+		}
+		return all[i].kind < all[j].kind
+	})
+
+	ts := snap.Timestamp.UnixMilli()
+	kinds := make(map[string]string, len(all))
+	seen := make(map[string]bool, len(all))
+	for _, s := range all {
+		kind, ok := kinds[s.family]
+		if (ok && kind != s.kind) || seen[s.line] {
+			continue
+		}
+		seen[s.line] = true
+
+		if !ok {
+			kinds[s.family] = s.kind
+			if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", s.family, s.kind); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s %s %d\n", s.line, s.value, ts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,39 @@
+package backup
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Rekey rewrites every snapshot in dir with newKey, snapshots are decrypted with keys first.
+// A nil newKey leaves the snapshots in plaintext. Each file is replaced atomically.
+func Rekey(dir string, keys Keyring, newKey *Key) error {
+	s, err := NewStore(dir, Retention{}, newKey, keys)
+	if err != nil {
+		return err
+	}
+
+	gens, err := s.Generations()
+	if err != nil {
+		return err
+	}
+
+	for _, g := range gens {
+		plain, err := s.ReadGeneration(g)
+		if err != nil {
+			return errors.Wrap(err, g.Path)
+		}
+
+		out := plain
+		if newKey != nil {
+			if out, err = newKey.Encrypt(plain); err != nil {
+				return err
+			}
+		}
+
+		if err = writeSnapshot(g.Path, out); err != nil {
+			return errors.Wrap(err, g.Path)
+		}
+	}
+
+	return nil
+}
@@ -1,79 +1,39 @@
 package backup
 
 import (
-	"bufio"
 	"encoding/json"
 	"log/slog"
-	"os"
-	"path"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/sshirox/isaac/internal/storage"
 )
 
+const (
+	maxRecordSize = 64 << 20
+)
+
 type backupFile struct {
-	Gauges   map[string]float64 `json:"gauges"`
-	Counters map[string]int64   `json:"counters"`
+	Timestamp time.Time          `json:"timestamp,omitempty"`
+	Gauges    map[string]float64 `json:"gauges"`
+	Counters  map[string]int64   `json:"counters"`
 }
 
-// RestoreMetrics metrics from file to storage
-func RestoreMetrics(
-	ms *storage.MemStorage,
-	storagePath string,
-	enable bool,
-) (
-	*storage.MemStorage,
-	*os.File,
-	error,
-) {
-	var err error
-	var f *os.File
-
-	if err = os.MkdirAll(storagePath, 0755); err != nil {
-		slog.Error("create backup dir", "err", err)
-		return nil, nil, err
-	}
-
-	fp := path.Join(storagePath, "metrics.bk")
-	f, err = os.OpenFile(fp, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+// Restore loads the newest valid snapshot into storage, corrupt generations are skipped
+func (s *Store) Restore(ms *storage.MemStorage) error {
+	data, g, err := s.read()
 	if err != nil {
-		slog.Error("open file", "err", err)
-		return nil, nil, err
-	}
-
-	if enable {
-		err = restore(ms, f)
-		if err != nil {
-			slog.Error("restore metrics", "err", err)
-			return nil, nil, err
-		}
-	}
-	return ms, f, nil
-}
-
-func restore(ms *storage.MemStorage, file *os.File) error {
-	s := bufio.NewScanner(file)
-	var endVal string
-
-	for s.Scan() {
-		l := s.Text()
-		if l != "" {
-			endVal = l
-		}
+		return errors.Wrap(err, "read backup")
 	}
 
-	if err := s.Err(); err != nil {
-		return errors.Wrap(err, "read backup metrics file")
-	}
-
-	if endVal == "" {
+	if data == nil {
 		return nil
 	}
 
 	var bf backupFile
 
-	err := json.Unmarshal([]byte(endVal), &bf)
+	err = json.Unmarshal(data, &bf)
 	if err != nil {
 		return errors.Wrap(err, "unmarshal metrics")
 	}
@@ -86,5 +46,7 @@ func restore(ms *storage.MemStorage, file *os.File) error {
 		ms.UpdateCounter(id, delta)
 	}
 
+	slog.Info("metrics restored", "path", g.Path, "time", g.Time)
+
 	return nil
 }
@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/metric"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+var ErrSnapshotNotFound = errors.New("backup snapshot not found")
+
+// Snapshot is a decoded backup generation
+type Snapshot struct {
+	Generation
+	// Timestamp is the time the snapshot was taken, snapshots written before
+	// timestamps were embedded fall back to the generation time
+	Timestamp time.Time
+	Gauges    map[string]float64
+	Counters  map[string]int64
+}
+
+// Change is a difference of one metric between two snapshots
+type Change struct {
+	Kind string
+	ID   string
+	// Old is nil for added metrics, New is nil for removed ones
+	Old *float64
+	New *float64
+}
+
+// Load verifies and decodes the snapshot of generation g
+func (s *Store) Load(g Generation) (*Snapshot, error) {
+	data, err := s.ReadGeneration(g)
+	if err != nil {
+		return nil, err
+	}
+
+	var bf backupFile
+	if err = json.Unmarshal(data, &bf); err != nil {
+		return nil, errors.Wrap(ErrCorrupt, err.Error())
+	}
+
+	snap := &Snapshot{
+		Generation: g,
+		Timestamp:  bf.Timestamp,
+		Gauges:     bf.Gauges,
+		Counters:   bf.Counters,
+	}
+	if snap.Timestamp.IsZero() {
+		snap.Timestamp = g.Time
+	}
+	if snap.Gauges == nil {
+		snap.Gauges = map[string]float64{}
+	}
+	if snap.Counters == nil {
+		snap.Counters = map[string]int64{}
+	}
+
+	return snap, nil
+}
+
+// Find resolves a snapshot reference: "latest", an index where 0 is the newest,
+// a snapshot file name or an RFC 3339 time picking the newest snapshot taken at or before it
+func (s *Store) Find(ref string) (Generation, error) {
+	gens, err := s.Generations()
+	if err != nil {
+		return Generation{}, err
+	}
+
+	if ref == "" || ref == "latest" {
+		ref = "0"
+	}
+
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i < 0 || i >= len(gens) {
+			return Generation{}, errors.Wrap(ErrSnapshotNotFound, ref)
+		}
+		return gens[i], nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, ref); err == nil {
+		for _, g := range gens {
+			if !g.Time.After(t) {
+				return g, nil
+			}
+		}
+		return Generation{}, errors.Wrap(ErrSnapshotNotFound, ref)
+	}
+
+	for _, g := range gens {
+		if filepath.Base(g.Path) == filepath.Base(ref) {
+			return g, nil
+		}
+	}
+
+	return Generation{}, errors.Wrap(ErrSnapshotNotFound, ref)
+}
+
+// Promote saves the snapshot as the newest generation so the next restore picks it
+func (s *Store) Promote(snap *Snapshot) error {
+	ms := storage.NewMemStorage()
+	snap.Apply(ms)
+
+	return s.Save(ms)
+}
+
+// Apply writes the snapshot metrics into storage, counters are added to existing values
+func (snap *Snapshot) Apply(ms *storage.MemStorage) {
+	for id, val := range snap.Gauges {
+		ms.UpdateGauge(id, val)
+	}
+
+	for id, delta := range snap.Counters {
+		ms.UpdateCounter(id, delta)
+	}
+}
+
+// Diff lists metrics added, removed or changed from a to b sorted by kind and name
+func Diff(a, b *Snapshot) []Change {
+	var changes []Change
+
+	for id, old := range a.Gauges {
+		o := old
+		if val, ok := b.Gauges[id]; !ok {
+			changes = append(changes, Change{Kind: metric.GaugeMetricType, ID: id, Old: &o})
+		} else if val != old {
+			n := val
+			changes = append(changes, Change{Kind: metric.GaugeMetricType, ID: id, Old: &o, New: &n})
+		}
+	}
+	for id, val := range b.Gauges {
+		if _, ok := a.Gauges[id]; !ok {
+			n := val
+			changes = append(changes, Change{Kind: metric.GaugeMetricType, ID: id, New: &n})
+		}
+	}
+
+	for id, old := range a.Counters {
+		o := float64(old)
+		if val, ok := b.Counters[id]; !ok {
+			changes = append(changes, Change{Kind: metric.CounterMetricType, ID: id, Old: &o})
+		} else if val != old {
+			n := float64(val)
+			changes = append(changes, Change{Kind: metric.CounterMetricType, ID: id, Old: &o, New: &n})
+		}
+	}
+	for id, val := range b.Counters {
+		if _, ok := a.Counters[id]; !ok {
+			n := float64(val)
+			changes = append(changes, Change{Kind: metric.CounterMetricType, ID: id, New: &n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].ID < changes[j].ID
+	})
+
+	return changes
+}
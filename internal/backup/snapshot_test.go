@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestStore_Find(t *testing.T) {
+	store, err := NewStore(t.TempDir(), Retention{}, nil, nil)
+	require.NoError(t, err)
+
+	ms := storage.NewMemStorage()
+	for i := 0; i < 3; i++ {
+		ms.UpdateGauge("Alloc", float64(i))
+		require.NoError(t, store.Save(ms))
+	}
+
+	gens, err := store.Generations()
+	require.NoError(t, err)
+
+	g, err := store.Find("latest")
+	require.NoError(t, err)
+	assert.Equal(t, gens[0], g)
+
+	g, err = store.Find("2")
+	require.NoError(t, err)
+	assert.Equal(t, gens[2], g)
+
+	g, err = store.Find(filepath.Base(gens[1].Path))
+	require.NoError(t, err)
+	assert.Equal(t, gens[1], g)
+
+	g, err = store.Find(gens[1].Time.Add(time.Nanosecond).Format(time.RFC3339Nano))
+	require.NoError(t, err)
+	assert.Equal(t, gens[1], g)
+
+	_, err = store.Find("5")
+	assert.ErrorIs(t, err, ErrSnapshotNotFound)
+
+	_, err = store.Find(gens[2].Time.Add(-time.Hour).Format(time.RFC3339))
+	assert.ErrorIs(t, err, ErrSnapshotNotFound)
+
+	snap, err := store.Load(gens[2])
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, snap.Gauges["Alloc"])
+	assert.False(t, snap.Timestamp.IsZero())
+}
+
+func TestDiff(t *testing.T) {
+	a := &Snapshot{
+		Gauges:   map[string]float64{"Alloc": 1, "Frees": 2},
+		Counters: map[string]int64{"PollCount": 3},
+	}
+	b := &Snapshot{
+		Gauges:   map[string]float64{"Alloc": 5, "HeapSys": 7},
+		Counters: map[string]int64{"PollCount": 3},
+	}
+
+	changes := Diff(a, b)
+	require.Len(t, changes, 3)
+
+	assert.Equal(t, "Alloc", changes[0].ID)
+	assert.Equal(t, 1.0, *changes[0].Old)
+	assert.Equal(t, 5.0, *changes[0].New)
+
+	assert.Equal(t, "Frees", changes[1].ID)
+	assert.Nil(t, changes[1].New)
+
+	assert.Equal(t, "HeapSys", changes[2].ID)
+	assert.Nil(t, changes[2].Old)
+}
+
+func TestExport(t *testing.T) {
+	snap := &Snapshot{
+		Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Gauges:    map[string]float64{"Alloc": 1.5},
+		Counters:  map[string]int64{"Poll.Count": 3},
+	}
+	labelled := &Snapshot{
+		Timestamp: snap.Timestamp,
+		Counters:  map[string]int64{`requests{code="200"}`: 5, `requests{code="500"}`: 1},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Export(&buf, snap, FormatCSV))
+	assert.Equal(t, "timestamp,type,name,value\n"+
+		"2024-01-02T03:04:05Z,gauge,Alloc,1.5\n"+
+		"2024-01-02T03:04:05Z,counter,Poll.Count,3\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, Export(&buf, snap, FormatPrometheus))
+	assert.Equal(t, "# TYPE Alloc gauge\nAlloc 1.5 1704164645000\n"+
+		"# TYPE Poll_Count counter\nPoll_Count 3 1704164645000\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, Export(&buf, labelled, FormatPrometheus))
+	assert.Equal(t, "# TYPE requests counter\n"+
+		`requests{code="200"} 5 1704164645000`+"\n"+
+		`requests{code="500"} 1 1704164645000`+"\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, Export(&buf, snap, FormatJSON))
+	assert.JSONEq(t, `{"timestamp":"2024-01-02T03:04:05Z","gauges":{"Alloc":1.5},"counters":{"Poll.Count":3}}`, buf.String())
+
+	assert.Error(t, Export(&buf, snap, "xml"))
+}
@@ -0,0 +1,419 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	legacyFileName  = "metrics.bk"
+	snapshotPrefix  = "metrics-"
+	snapshotExt     = ".bk"
+	snapshotMagic   = "isaac-snapshot"
+	snapshotVersion = "v1"
+
+	DefaultGenerations = 5
+)
+
+var (
+	ErrCorrupt    = errors.New("backup snapshot is corrupt")
+	ErrNoSnapshot = errors.New("no valid backup snapshot")
+	ErrReadOnly   = errors.New("backup store is opened read-only")
+)
+
+// Retention limits the snapshots kept on disk, the newest snapshot is never removed
+type Retention struct {
+	// Generations is the number of snapshots to keep, DefaultGenerations when not set
+	Generations int
+	// MaxBytes limits the total size of kept snapshots, no limit when not set
+	MaxBytes int64
+}
+
+// Generation is one snapshot file of the store
+type Generation struct {
+	Path string
+	Size int64
+	Time time.Time
+}
+
+// Store keeps metric snapshots in a directory, one file per generation.
+// Every snapshot is written to a temp file, synced and renamed into place,
+// so a crash leaves either the previous or the new generation intact.
+type Store struct {
+	dir       string
+	retention Retention
+	key       *Key
+	keys      Keyring
+	readOnly  bool
+
+	mu   sync.Mutex
+	last int64
+	err  error
+}
+
+// NewStore opens the store in dir, snapshots are encrypted with key when it is not nil
+// and decrypted with keys. A legacy append-only metrics.bk is compacted into a generation.
+func NewStore(dir string, retention Retention, key *Key, keys Keyring) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "[backup.NewStore] create backup dir")
+	}
+
+	if retention.Generations <= 0 {
+		retention.Generations = DefaultGenerations
+	}
+
+	s := &Store{
+		dir:       dir,
+		retention: retention,
+		key:       key,
+		keys:      keys,
+	}
+
+	if err := s.compactLegacy(); err != nil {
+		return nil, errors.Wrap(err, "[backup.NewStore] compact legacy backup")
+	}
+
+	return s, nil
+}
+
+// OpenReadOnly opens the existing store in dir for reading snapshots decrypted with keys.
+// Nothing in dir is changed, a legacy metrics.bk is left for NewStore to compact.
+func OpenReadOnly(dir string, keys Keyring) (*Store, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "[backup.OpenReadOnly] open backup dir")
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("[backup.OpenReadOnly] %s is not a directory", dir)
+	}
+
+	return &Store{dir: dir, keys: keys, readOnly: true}, nil
+}
+
+// HasLegacy reports whether dir holds a legacy metrics.bk that is not compacted yet
+func (s *Store) HasLegacy() bool {
+	_, err := os.Stat(filepath.Join(s.dir, legacyFileName))
+	return err == nil
+}
+
+// Dir returns the store directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Generations lists snapshots from the newest to the oldest
+func (s *Store) Generations() ([]Generation, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "[backup.Store.Generations] read backup dir")
+	}
+
+	var gens []Generation
+	for _, e := range entries {
+		ts, ok := parseSnapshotName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, errors.Wrap(err, "[backup.Store.Generations] stat snapshot")
+		}
+
+		gens = append(gens, Generation{
+			Path: filepath.Join(s.dir, e.Name()),
+			Size: info.Size(),
+			Time: time.Unix(0, ts),
+		})
+	}
+
+	sort.Slice(gens, func(i, j int) bool {
+		return gens[i].Time.After(gens[j].Time)
+	})
+
+	return gens, nil
+}
+
+// write stores record as a new generation and applies retention, callers serialize writes
+func (s *Store) write(record []byte, t time.Time) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	ts := t.UnixNano()
+	if ts <= s.last {
+		ts = s.last + 1
+	}
+	s.last = ts
+
+	if err := writeSnapshot(filepath.Join(s.dir, snapshotName(ts)), record); err != nil {
+		return err
+	}
+
+	return s.prune()
+}
+
+func (s *Store) prune() error {
+	gens, err := s.Generations()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for i, g := range gens {
+		total += g.Size
+		if i == 0 || (i < s.retention.Generations && (s.retention.MaxBytes <= 0 || total <= s.retention.MaxBytes)) {
+			continue
+		}
+
+		// Older generations go as well, kept snapshots stay contiguous.
+		for _, old := range gens[i:] {
+			if err = os.Remove(old.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return errors.Wrap(err, "[backup.Store.prune] remove snapshot")
+			}
+		}
+
+		break
+	}
+
+	return nil
+}
+
+// read returns the decrypted payload of the newest valid generation.
+// Corrupt generations are skipped, missing keys are reported as errors.
+func (s *Store) read() ([]byte, Generation, error) {
+	gens, err := s.Generations()
+	if err != nil {
+		return nil, Generation{}, err
+	}
+
+	for _, g := range gens {
+		data, err := s.ReadGeneration(g)
+		if errors.Is(err, ErrEncrypted) || errors.Is(err, ErrUnknownKey) {
+			return nil, g, err
+		}
+		if err != nil {
+			slog.Warn("skip invalid backup snapshot", "path", g.Path, "err", err)
+			continue
+		}
+
+		return data, g, nil
+	}
+
+	if len(gens) > 0 {
+		return nil, Generation{}, ErrNoSnapshot
+	}
+
+	return nil, Generation{}, nil
+}
+
+// ReadGeneration verifies the snapshot checksum and returns its decrypted payload
+func (s *Store) ReadGeneration(g Generation) ([]byte, error) {
+	record, err := readSnapshot(g.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.keys.Decrypt(record)
+	if err != nil {
+		if errors.Is(err, ErrEncrypted) || errors.Is(err, ErrUnknownKey) {
+			return nil, err
+		}
+		return nil, errors.Wrap(ErrCorrupt, err.Error())
+	}
+
+	if !json.Valid(data) {
+		return nil, errors.Wrap(ErrCorrupt, "invalid payload")
+	}
+
+	return data, nil
+}
+
+// compactLegacy moves every valid record of an append-only metrics.bk into a generation of
+// its own, oldest first, so retention applies to them like to any other snapshot
+func (s *Store) compactLegacy() error {
+	path := filepath.Join(s.dir, legacyFileName)
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var records [][]byte
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, maxRecordSize)
+	for sc.Scan() {
+		if l := bytes.TrimSpace(sc.Bytes()); len(l) > 0 {
+			records = append(records, bytes.Clone(l))
+		}
+	}
+
+	// A partial write at crash time corrupts a record, it is skipped like any invalid one.
+	var valid int
+	for _, record := range records {
+		data, err := s.keys.Decrypt(record)
+		if errors.Is(err, ErrEncrypted) || errors.Is(err, ErrUnknownKey) {
+			return err
+		}
+		var bf backupFile
+		if err != nil || json.Unmarshal(data, &bf) != nil {
+			continue
+		}
+
+		// records without a timestamp take the file time, write keeps them in order
+		t := bf.Timestamp
+		if t.IsZero() {
+			t = info.ModTime()
+		}
+		if err = s.write(record, t); err != nil {
+			return err
+		}
+		valid++
+	}
+
+	if valid == 0 && len(records) > 0 {
+		return errors.Wrap(ErrNoSnapshot, path)
+	}
+
+	f.Close()
+	slog.Info("legacy backup compacted", "path", path, "records", len(records), "generations", valid)
+
+	return os.Remove(path)
+}
+
+func snapshotName(ts int64) string {
+	return fmt.Sprintf("%s%020d%s", snapshotPrefix, ts, snapshotExt)
+}
+
+func parseSnapshotName(name string) (int64, bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExt) {
+		return 0, false
+	}
+
+	ts, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotExt), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return ts, true
+}
+
+// writeSnapshot atomically writes "isaac-snapshot v1 sha256:<hex> <len>\n<record>\n" to path
+func writeSnapshot(path string, record []byte) error {
+	sum := sha256.Sum256(record)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s sha256:%s %d\n", snapshotMagic, snapshotVersion, hex.EncodeToString(sum[:]), len(record))
+	buf.Write(record)
+	buf.WriteByte('\n')
+
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+func readSnapshot(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header, record, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return nil, errors.Wrap(ErrCorrupt, "missing header")
+	}
+
+	fields := strings.Fields(string(header))
+	if len(fields) != 4 || fields[0] != snapshotMagic || !strings.HasPrefix(fields[2], "sha256:") {
+		return nil, errors.Wrap(ErrCorrupt, "invalid header")
+	}
+	if fields[1] != snapshotVersion {
+		return nil, errors.Errorf("unsupported snapshot version %q", fields[1])
+	}
+
+	size, err := strconv.Atoi(fields[3])
+	if err != nil || size != len(record)-1 || !bytes.HasSuffix(record, []byte("\n")) {
+		return nil, errors.Wrap(ErrCorrupt, "truncated snapshot")
+	}
+	record = record[:size]
+
+	sum := sha256.Sum256(record)
+	if hex.EncodeToString(sum[:]) != strings.TrimPrefix(fields[2], "sha256:") {
+		return nil, errors.Wrap(ErrCorrupt, "checksum mismatch")
+	}
+
+	return record, nil
+}
+
+// writeFileAtomic writes data to a temp file next to path, syncs it and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return errors.Wrap(err, "create temp file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "chmod temp file")
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write snapshot")
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "sync snapshot")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "close snapshot")
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "rename snapshot")
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir makes the rename durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil {
+		return errors.Wrap(err, "sync backup dir")
+	}
+
+	return nil
+}
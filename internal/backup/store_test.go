@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestStore_Retention(t *testing.T) {
+	store, err := NewStore(t.TempDir(), Retention{Generations: 3}, nil, nil)
+	require.NoError(t, err)
+
+	ms := storage.NewMemStorage()
+	for i := 0; i < 5; i++ {
+		ms.UpdateGauge("Alloc", float64(i))
+		require.NoError(t, store.Save(ms))
+	}
+
+	gens, err := store.Generations()
+	require.NoError(t, err)
+	require.Len(t, gens, 3)
+
+	restored := storage.NewMemStorage()
+	require.NoError(t, store.Restore(restored))
+	val, _ := restored.ReceiveGauge("Alloc")
+	assert.Equal(t, 4.0, val)
+
+	store.retention = Retention{Generations: 3, MaxBytes: gens[0].Size + 1}
+	require.NoError(t, store.Save(ms))
+
+	gens, err = store.Generations()
+	require.NoError(t, err)
+	assert.Len(t, gens, 1)
+}
+
+func TestStore_RestoreFallback(t *testing.T) {
+	store, err := NewStore(t.TempDir(), Retention{}, nil, nil)
+	require.NoError(t, err)
+
+	ms := storage.NewMemStorage()
+	ms.UpdateGauge("Alloc", 1)
+	require.NoError(t, store.Save(ms))
+	ms.UpdateGauge("Alloc", 2)
+	require.NoError(t, store.Save(ms))
+
+	gens, err := store.Generations()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(gens[0].Path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(gens[0].Path, data[:len(data)-5], 0600))
+
+	_, err = store.ReadGeneration(gens[0])
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	restored := storage.NewMemStorage()
+	require.NoError(t, store.Restore(restored))
+	val, _ := restored.ReceiveGauge("Alloc")
+	assert.Equal(t, 1.0, val)
+
+	require.NoError(t, os.WriteFile(gens[1].Path, []byte("garbage"), 0600))
+	assert.ErrorIs(t, store.Restore(storage.NewMemStorage()), ErrNoSnapshot)
+}
+
+func TestStore_CompactLegacy(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"gauges":{"Alloc":1},"counters":{}}
+{"gauges":{"Alloc":2},"counters":{"PollCount":7}}
+{"gauges":{"Alloc":3},"coun`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, legacyFileName), []byte(legacy), 0600))
+
+	store, err := NewStore(dir, Retention{}, nil, nil)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(dir, legacyFileName))
+	gens, err := store.Generations()
+	require.NoError(t, err)
+	assert.Len(t, gens, 2)
+
+	restored := storage.NewMemStorage()
+	require.NoError(t, store.Restore(restored))
+	val, _ := restored.ReceiveGauge("Alloc")
+	assert.Equal(t, 2.0, val)
+	delta, _ := restored.ReceiveCounter("PollCount")
+	assert.Equal(t, int64(7), delta)
+}
+
+func TestRunWorker_FinalSave(t *testing.T) {
+	store, err := NewStore(t.TempDir(), Retention{}, nil, nil)
+	require.NoError(t, err)
+
+	ms := storage.NewMemStorage()
+	ms.UpdateGauge("Alloc", 1)
+
+	sc := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		RunWorker(ms, 0, store, sc)
+		close(done)
+	}()
+
+	close(sc)
+	<-done
+
+	restored := storage.NewMemStorage()
+	require.NoError(t, store.Restore(restored))
+	val, _ := restored.ReceiveGauge("Alloc")
+	assert.Equal(t, 1.0, val)
+}
+
+func TestStore_Health(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	store, err := NewStore(dir, Retention{}, nil, nil)
+	require.NoError(t, err)
+
+	ms := storage.NewMemStorage()
+	require.NoError(t, store.Save(ms))
+	assert.NoError(t, store.Health())
+
+	require.NoError(t, os.RemoveAll(dir))
+	assert.Error(t, store.Save(ms))
+	assert.Error(t, store.Health())
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"gauges":{"Alloc":1},"counters":{}}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, legacyFileName), []byte(legacy), 0600))
+
+	store, err := OpenReadOnly(dir, nil)
+	require.NoError(t, err)
+	assert.True(t, store.HasLegacy())
+
+	gens, err := store.Generations()
+	require.NoError(t, err)
+	assert.Empty(t, gens)
+	assert.ErrorIs(t, store.Save(storage.NewMemStorage()), ErrReadOnly)
+	assert.FileExists(t, filepath.Join(dir, legacyFileName))
+
+	_, err = OpenReadOnly(filepath.Join(dir, "missing"), nil)
+	assert.Error(t, err)
+}
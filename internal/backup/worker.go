@@ -2,26 +2,37 @@ package backup
 
 import (
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/sshirox/isaac/internal/storage"
 )
 
+// RunWorker saves a snapshot every interval seconds until sc is closed, then saves
+// the final state. With zero interval only the final snapshot is saved, updates are
+// expected to be persisted by a write hook.
 func RunWorker(
 	ms *storage.MemStorage,
 	interval int64,
-	f *os.File,
+	s *Store,
 	sc chan struct{},
 ) {
-	t := time.NewTicker(time.Duration(interval) * time.Second)
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(time.Duration(interval) * time.Second)
+		defer t.Stop()
+		tick = t.C
+	}
+
 	for {
 		select {
-		case <-t.C:
-			if err := SaveBackup(ms, f); err != nil {
+		case <-tick:
+			if err := s.Save(ms); err != nil {
 				slog.Error("backup metrics", "err", err)
 			}
 		case <-sc:
+			if err := s.Save(ms); err != nil {
+				slog.Error("final backup metrics", "err", err)
+			}
 			slog.Info("stop backup worker")
 			return
 		}
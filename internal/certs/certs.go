@@ -0,0 +1,188 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Client certificate modes of ServerConfig
+const (
+	ClientAuthNone          = "none"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+	ClientAuthRequire       = "require"
+)
+
+// ParseClientAuth maps a client certificate mode onto the TLS setting, an empty mode
+// requires certificates when a client CA is configured and asks for none otherwise
+func ParseClientAuth(mode, clientCAPath string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "":
+		if clientCAPath == "" {
+			return tls.NoClientCert, nil
+		}
+		return tls.RequireAndVerifyClientCert, nil
+	case ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthVerifyIfGiven, ClientAuthRequire:
+		if clientCAPath == "" {
+			return 0, errors.Errorf("[certs.ParseClientAuth] client auth %q needs a client CA", mode)
+		}
+		if mode == ClientAuthRequire {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.VerifyClientCertIfGiven, nil
+	default:
+		return 0, errors.Errorf("[certs.ParseClientAuth] unknown client auth %q, use none, verify_if_given or require", mode)
+	}
+}
+
+// Reloader holds the server certificate and client CA pool and swaps them on reload.
+// Handshakes already in progress keep the old material, open connections are not dropped.
+type Reloader struct {
+	certPath     string
+	keyPath      string
+	clientCAPath string
+	clientAuth   tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewReloader loads the certificate, key and optional client CA bundle,
+// clientAuth is the client certificate mode, see ParseClientAuth
+func NewReloader(certPath, keyPath, clientCAPath, clientAuth string) (*Reloader, error) {
+	mode, err := ParseClientAuth(clientAuth, clientCAPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{
+		certPath:     certPath,
+		keyPath:      keyPath,
+		clientCAPath: clientCAPath,
+		clientAuth:   mode,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload re-reads all files, the previous material is kept when any of them is invalid
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return errors.Wrap(err, "[certs.Reload] load key pair")
+	}
+
+	var pool *x509.CertPool
+	if r.clientCAPath != "" {
+		pool, err = LoadCertPool(r.clientCAPath)
+		if err != nil {
+			return errors.Wrap(err, "[certs.Reload] load client CA")
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.mu.Unlock()
+
+	return nil
+}
+
+// ServerConfig returns TLS config for listeners, client certificates are checked
+// against the client CA bundle as the client auth mode says
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if r.clientCAs != nil && r.clientAuth != tls.NoClientCert {
+				cfg.ClientCAs = r.clientCAs
+				cfg.ClientAuth = r.clientAuth
+			}
+
+			return cfg, nil
+		},
+	}
+}
+
+// ReloadOnSignal reloads certificates on every SIGHUP until ctx is done
+func (r *Reloader) ReloadOnSignal(ctx context.Context) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				if err := r.Reload(); err != nil {
+					slog.Error("reload certificates", "err", err)
+					continue
+				}
+				slog.Info("certificates reloaded", "cert", r.certPath)
+			}
+		}
+	}()
+}
+
+// ClientConfig builds TLS config for outgoing connections. caPath overrides
+// system roots, certPath and keyPath enable client certificate authentication
+func ClientConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caPath != "" {
+		pool, err := LoadCertPool(caPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "[certs.ClientConfig] load CA")
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "[certs.ClientConfig] load key pair")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// LoadCertPool reads PEM encoded certificates into a pool
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found")
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,213 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func issue(t *testing.T, serial int64, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "isaac"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+
+	signer, signerKey := tpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+
+	return certPath, keyPath
+}
+
+func serve(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", r.ServerConfig())
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	return lis.Addr().String()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, 1, nil, true)
+	caPath, _ := ca.write(t, dir, "ca")
+	certPath, keyPath := issue(t, 2, ca, false).write(t, dir, "server")
+	clientCert, clientKey := issue(t, 3, ca, false).write(t, dir, "client")
+
+	r, err := NewReloader(certPath, keyPath, caPath, "")
+	require.NoError(t, err)
+	addr := serve(t, r)
+
+	t.Run("Client certificate is required", func(t *testing.T) {
+		cfg, err := ClientConfig(caPath, "", "")
+		require.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", addr, cfg)
+		if err == nil {
+			_, err = conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+		assert.Error(t, err)
+	})
+
+	t.Run("Mutual authentication", func(t *testing.T) {
+		cfg, err := ClientConfig(caPath, clientCert, clientKey)
+		require.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", addr, cfg)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, int64(2), conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+	})
+
+	t.Run("Reload certificate", func(t *testing.T) {
+		issue(t, 4, ca, false).write(t, dir, "server")
+		require.NoError(t, r.Reload())
+
+		cfg, err := ClientConfig(caPath, clientCert, clientKey)
+		require.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", addr, cfg)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, int64(4), conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+	})
+
+	t.Run("Invalid reload keeps previous certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(certPath, []byte("broken"), 0600))
+		assert.Error(t, r.Reload())
+		assert.NotNil(t, r.ServerConfig())
+	})
+}
+
+func TestReloader_VerifyIfGiven(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, 1, nil, true)
+	caPath, _ := ca.write(t, dir, "ca")
+	certPath, keyPath := issue(t, 2, ca, false).write(t, dir, "server")
+	clientCert, clientKey := issue(t, 3, ca, false).write(t, dir, "client")
+	strangerCert, strangerKey := issue(t, 4, issue(t, 5, nil, true), false).write(t, dir, "stranger")
+
+	r, err := NewReloader(certPath, keyPath, caPath, ClientAuthVerifyIfGiven)
+	require.NoError(t, err)
+	addr := serve(t, r)
+
+	dial := func(certPath, keyPath string) error {
+		cfg, err := ClientConfig(caPath, certPath, keyPath)
+		require.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", addr, cfg)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		// The server closes accepted connections, a rejected certificate ends in an alert instead.
+		if _, err = conn.Read(make([]byte, 1)); errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+
+	assert.NoError(t, dial("", ""))
+	assert.NoError(t, dial(clientCert, clientKey))
+	assert.Error(t, dial(strangerCert, strangerKey))
+}
+
+func TestParseClientAuth(t *testing.T) {
+	tests := []struct {
+		mode    string
+		caPath  string
+		want    tls.ClientAuthType
+		wantErr bool
+	}{
+		{mode: "", want: tls.NoClientCert},
+		{mode: "", caPath: "ca.pem", want: tls.RequireAndVerifyClientCert},
+		{mode: ClientAuthNone, caPath: "ca.pem", want: tls.NoClientCert},
+		{mode: ClientAuthVerifyIfGiven, caPath: "ca.pem", want: tls.VerifyClientCertIfGiven},
+		{mode: ClientAuthRequire, caPath: "ca.pem", want: tls.RequireAndVerifyClientCert},
+		{mode: ClientAuthRequire, wantErr: true},
+		{mode: "optional", caPath: "ca.pem", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.caPath, func(t *testing.T) {
+			got, err := ParseClientAuth(tt.mode, tt.caPath)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidKey         = errors.New("invalid key")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+)
+
+// ReadPrivateKey reads a PEM private key: PKCS#1, SEC1, PKCS#8, encrypted PKCS#8
+// and legacy encrypted PEM are accepted. passphrase is only used for encrypted keys.
+func ReadPrivateKey(path string, passphrase []byte) (gocrypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePrivateKey(data, passphrase)
+}
+
+// ReadPublicKey reads a PEM public key in PKIX or PKCS#1 form, or takes the key of a certificate.
+func ReadPublicKey(path string) (gocrypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePublicKey(data)
+}
+
+func ParsePrivateKey(data, passphrase []byte) (gocrypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Wrap(ErrInvalidKey, "[crypto.ParsePrivateKey] no pem block")
+	}
+
+	der := block.Bytes
+
+	// Legacy encrypted PEM is deprecated but still produced by openssl -traditional.
+	//lint:ignore SA1019 kept for compatibility with existing keys
+	if x509.IsEncryptedPEMBlock(block) {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+
+		var err error
+		//lint:ignore SA1019 kept for compatibility with existing keys
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+			return nil, ErrDecryptKey
+		}
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(der)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(der)
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+
+		if der, err = decryptPKCS8(der, passphrase); err != nil {
+			return nil, err
+		}
+
+		if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+			return nil, ErrDecryptKey
+		}
+	default:
+		return nil, errors.Wrapf(ErrInvalidKey, "[crypto.ParsePrivateKey] unexpected pem type %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "[crypto.ParsePrivateKey] parse key")
+	}
+
+	signer, ok := key.(gocrypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKeyType
+	}
+
+	return signer, nil
+}
+
+func ParsePublicKey(data []byte) (gocrypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Wrap(ErrInvalidKey, "[crypto.ParsePublicKey] no pem block")
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, errors.Wrapf(ErrInvalidKey, "[crypto.ParsePublicKey] unexpected pem type %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "[crypto.ParsePublicKey] parse key")
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+}
+
+// MarshalPrivateKey encodes key as PKCS#8 PEM, encrypted when passphrase is set.
+func MarshalPrivateKey(key gocrypto.Signer, passphrase []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "[crypto.MarshalPrivateKey] marshal key")
+	}
+
+	if len(passphrase) == 0 {
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+
+	if der, err = encryptPKCS8(der, passphrase); err != nil {
+		return nil, errors.Wrap(err, "[crypto.MarshalPrivateKey] encrypt key")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalPublicKey encodes key as PKIX PEM.
+func MarshalPublicKey(key gocrypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "[crypto.MarshalPublicKey] marshal key")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
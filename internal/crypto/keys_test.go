@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(t *testing.T) map[string]gocrypto.Signer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return map[string]gocrypto.Signer{"rsa": rsaKey, "ecdsa": ecKey, "ed25519": edKey}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	for name, key := range testKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			plain, err := MarshalPrivateKey(key, nil)
+			require.NoError(t, err)
+
+			got, err := ParsePrivateKey(plain, nil)
+			require.NoError(t, err)
+			assert.Equal(t, key.Public(), got.Public())
+
+			enc, err := MarshalPrivateKey(key, []byte("secret"))
+			require.NoError(t, err)
+
+			_, err = ParsePrivateKey(enc, nil)
+			assert.ErrorIs(t, err, ErrPassphraseRequired)
+
+			_, err = ParsePrivateKey(enc, []byte("wrong"))
+			assert.ErrorIs(t, err, ErrDecryptKey)
+
+			got, err = ParsePrivateKey(enc, []byte("secret"))
+			require.NoError(t, err)
+			assert.Equal(t, key.Public(), got.Public())
+
+			pub, err := MarshalPublicKey(key.Public())
+			require.NoError(t, err)
+
+			gotPub, err := ParsePublicKey(pub)
+			require.NoError(t, err)
+			assert.Equal(t, key.Public(), gotPub)
+		})
+	}
+}
+
+func TestParsePrivateKey_Legacy(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	got, err := ParsePrivateKey(pkcs1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, key.Public(), got.Public())
+
+	//lint:ignore SA1019 legacy encrypted PEM fixture
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte("secret"), x509.PEMCipherAES256)
+	require.NoError(t, err)
+
+	got, err = ParsePrivateKey(pem.EncodeToMemory(block), []byte("secret"))
+	require.NoError(t, err)
+	assert.Equal(t, key.Public(), got.Public())
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	got, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, ecKey.Public(), got.Public())
+}
+
+func TestKeySigner_Sign(t *testing.T) {
+	data := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+
+	for name, key := range testKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			sign, err := NewKeySigner(key).Sign(data)
+			require.NoError(t, err)
+
+			v, err := NewKeyVerifier(key.Public())
+			require.NoError(t, err)
+
+			assert.True(t, v.Verify(data, sign))
+			assert.False(t, v.Verify([]byte("tampered"), sign))
+			assert.False(t, v.Verify(data, "not base64"))
+		})
+	}
+}
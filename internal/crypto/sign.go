@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader carries the base64 signature of the request body made with
+// an ECDSA, Ed25519 or RSA private key, an alternative to the HMAC SignHeader.
+const SignatureHeader = "Signature"
+
+type KeySigner struct {
+	key gocrypto.Signer
+}
+
+type KeyVerifier struct {
+	key gocrypto.PublicKey
+}
+
+func NewKeySigner(key gocrypto.Signer) *KeySigner {
+	return &KeySigner{key: key}
+}
+
+// Sign signs data: Ed25519 signs it as is, ECDSA (ASN.1) and RSA (PKCS#1 v1.5) sign its SHA-256.
+func (s *KeySigner) Sign(data []byte) (string, error) {
+	var (
+		sig []byte
+		err error
+	)
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		sig, err = s.key.Sign(rand.Reader, data, gocrypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(data)
+		sig, err = s.key.Sign(rand.Reader, digest[:], gocrypto.SHA256)
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "[crypto.KeySigner.Sign] sign data")
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func NewKeyVerifier(key gocrypto.PublicKey) (*KeyVerifier, error) {
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return &KeyVerifier{key: key}, nil
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+}
+
+func (v *KeyVerifier) Verify(data []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	digest := sha256.Sum256(data)
+
+	switch key := v.key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, gocrypto.SHA256, digest[:], sig) == nil
+	default:
+		return false
+	}
+}
@@ -6,14 +6,19 @@ import (
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
 )
 
 var (
-	ErrConnection = errors.New("connection error")
-	ErrNonRetry   = errors.New("non retry error")
-	ErrNonRetryPG = errors.New("non retry postgres error")
-	ErrRetryPG    = errors.New("retry postgres error")
-	ErrServer     = errors.New("server error")
+	ErrConnection  = errors.New("connection error")
+	ErrEmptyName   = errors.New("empty metric name")
+	ErrEmptyValue  = errors.New("empty metric value")
+	ErrInvalidType = errors.New("invalid metric type")
+	ErrNotFound    = errors.New("metric not found")
+	ErrNonRetry    = errors.New("non retry error")
+	ErrNonRetryPG  = errors.New("non retry postgres error")
+	ErrRetryPG     = errors.New("retry postgres error")
+	ErrServer      = errors.New("server error")
 )
 
 var (
@@ -26,11 +31,15 @@ var (
 	}
 )
 
-// IsRetryPGErr checks that the error is a retriable PG error
+// IsRetryPGErr checks that the error is a retriable PG error of pgconn or lib/pq
 func IsRetryPGErr(pgErr error) bool {
 	var err *pgconn.PgError
-	ok := errors.As(pgErr, &err)
-	if ok && slices.Contains(pgErrors, err.Code) {
+	if errors.As(pgErr, &err) && slices.Contains(pgErrors, err.Code) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(pgErr, &pqErr) && slices.Contains(pgErrors, string(pqErr.Code)) {
 		return true
 	}
 
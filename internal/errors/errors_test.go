@@ -1,10 +1,12 @@
 package errors
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,6 +44,16 @@ func TestIsRetryPGErr(t *testing.T) {
 			args: args{pgErr: &pgconn.PgError{Code: pgerrcode.SerializationFailure}},
 			want: true,
 		},
+		{
+			name: "lib/pq DeadlockDetected error",
+			args: args{pgErr: fmt.Errorf("upsert counters: %w", &pq.Error{Code: pgerrcode.DeadlockDetected})},
+			want: true,
+		},
+		{
+			name: "lib/pq UniqueViolation error",
+			args: args{pgErr: &pq.Error{Code: pgerrcode.UniqueViolation}},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,297 @@
+// Package expfmt renders metrics in the Prometheus text and OpenMetrics exposition formats
+package expfmt
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+const (
+	ContentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+	openMetricsMediaType = "application/openmetrics-text"
+	counterSuffix        = "_total"
+)
+
+// Format is an exposition format
+type Format int
+
+const (
+	FormatText Format = iota
+	FormatOpenMetrics
+)
+
+// ContentType returns the Content-Type header value of the format
+func (f Format) ContentType() string {
+	if f == FormatOpenMetrics {
+		return ContentTypeOpenMetrics
+	}
+	return ContentTypeText
+}
+
+// Negotiate picks OpenMetrics when the Accept header prefers it over the text format
+func Negotiate(accept string) Format {
+	best, bestQ := FormatText, -1.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		var f Format
+		switch mediaType {
+		case openMetricsMediaType:
+			f = FormatOpenMetrics
+		case "text/plain", "*/*":
+			f = FormatText
+		default:
+			continue
+		}
+
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+
+	return best
+}
+
+// Metric is one stored metric to expose
+type Metric struct {
+	Kind   string
+	ID     string
+	Value  float64
+	Labels map[string]string
+}
+
+// Encode writes metrics in the format grouped into families. Metric IDs are sanitised
+// into valid names, IDs of the form name{labels} share the family of name. Without Labels
+// they are parsed from the ID, as labels are not kept over a restart. A series whose name
+// and labels are taken by an earlier one is skipped, as is a family exposed with another
+// type.
+func Encode(w io.Writer, f Format, metrics []Metric) error {
+	type series struct {
+		Metric
+		base, family string
+	}
+
+	sorted := make([]series, len(metrics))
+	for i, m := range metrics {
+		if len(m.Labels) == 0 {
+			_, m.Labels = ParseSeriesID(m.ID)
+		}
+		base := Family(m.ID)
+		family := Name(base)
+		if f == FormatOpenMetrics && m.Kind == metric.CounterMetricType {
+			family = strings.TrimSuffix(family, counterSuffix)
+		}
+		sorted[i] = series{Metric: m, base: base, family: family}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.family != b.family {
+			return a.family < b.family
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+
+	bw := bufio.NewWriter(w)
+	kinds := make(map[string]string, len(sorted))
+	seen := make(map[string]bool, len(sorted))
+
+	for _, m := range sorted {
+		sample := m.family
+		if f == FormatOpenMetrics && m.Kind == metric.CounterMetricType {
+			sample += counterSuffix
+		}
+		line := sample + labels(m.Labels)
+
+		kind, ok := kinds[m.family]
+		if (ok && kind != m.Kind) || seen[line] {
+			slog.Warn("skip metric with duplicate exposition name", "type", m.Kind, "id", m.ID, "name", line)
+			continue
+		}
+		seen[line] = true
+
+		if !ok {
+			kinds[m.family] = m.Kind
+			bw.WriteString("# HELP " + m.family + " " + escapeHelp(m.Kind+" "+m.base) + "\n")
+			bw.WriteString("# TYPE " + m.family + " " + m.Kind + "\n")
+		}
+		bw.WriteString(line + " " + formatValue(m.Value) + "\n")
+	}
+
+	if f == FormatOpenMetrics {
+		bw.WriteString("# EOF\n")
+	}
+
+	return bw.Flush()
+}
+
+// SeriesID returns the ID of a labelled series: the name followed by the labels sorted by
+// name, e.g. http_requests_total{code="200",method="get"}. It is the name alone without labels.
+func SeriesID(name string, l map[string]string) string {
+	return name + labels(l)
+}
+
+// Family returns the name part of a series ID
+func Family(id string) string {
+	if i := strings.IndexByte(id, '{'); i > 0 && strings.HasSuffix(id, "}") {
+		return id[:i]
+	}
+	return id
+}
+
+// ParseSeriesID splits a series ID into its name and labels, it is the reverse of SeriesID.
+// An ID that is not a valid name{labels} is a name without labels.
+func ParseSeriesID(id string) (string, map[string]string) {
+	name := Family(id)
+	if name == id {
+		return id, nil
+	}
+
+	rest := id[len(name)+1 : len(id)-1]
+	l := make(map[string]string)
+	for rest != "" {
+		eq := strings.Index(rest, `="`)
+		if eq <= 0 {
+			return id, nil
+		}
+		label := rest[:eq]
+		rest = rest[eq+2:]
+
+		var b strings.Builder
+		closed := false
+		for i := 0; i < len(rest); i++ {
+			c := rest[i]
+			if c == '"' {
+				rest = rest[i+1:]
+				closed = true
+				break
+			}
+			if c == '\\' && i+1 < len(rest) {
+				i++
+				if c = rest[i]; c == 'n' {
+					c = '\n'
+				}
+			}
+			b.WriteByte(c)
+		}
+		if !closed {
+			return id, nil
+		}
+		l[label] = b.String()
+
+		if rest != "" {
+			if rest[0] != ',' {
+				return id, nil
+			}
+			rest = rest[1:]
+		}
+	}
+	if len(l) == 0 {
+		return name, nil
+	}
+
+	return name, l
+}
+
+// Name replaces characters not allowed in metric names with underscores
+func Name(id string) string {
+	return sanitize(id, true)
+}
+
+// LabelName replaces characters not allowed in label names with underscores
+func LabelName(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(s string, colons bool) string {
+	if s == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r == ':' && colons:
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			// Names may not start with a digit, it is kept behind an underscore.
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return b.String()
+}
+
+func labels(l map[string]string) string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(LabelName(name))
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(l[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return valueEscaper.Replace(s)
+}
+
+// formatValue writes the shortest representation, special values as +Inf, -Inf and NaN
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
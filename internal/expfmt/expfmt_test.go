@@ -0,0 +1,107 @@
+package expfmt
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	assert.Equal(t, FormatText, Negotiate(""))
+	assert.Equal(t, FormatText, Negotiate("text/plain"))
+	assert.Equal(t, FormatOpenMetrics, Negotiate("application/openmetrics-text; version=1.0.0"))
+	assert.Equal(t, FormatOpenMetrics, Negotiate("application/openmetrics-text;version=1.0.0;q=0.5,text/plain;q=0.4,*/*;q=0.1"))
+	assert.Equal(t, FormatText, Negotiate("application/openmetrics-text;q=0.2,text/plain;q=0.5"))
+	assert.Equal(t, FormatText, Negotiate("application/json"))
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "cpu_usage_1", Name("cpu.usage-1"))
+	assert.Equal(t, "_9lives", Name("9lives"))
+	assert.Equal(t, "ns:requests", Name("ns:requests"))
+	assert.Equal(t, "ns_requests", LabelName("ns:requests"))
+	assert.Equal(t, "_", Name(""))
+}
+
+func TestEncode(t *testing.T) {
+	metrics := []Metric{
+		{Kind: "counter", ID: "requests_total", Value: 7},
+		{Kind: "gauge", ID: "temp", Value: math.Inf(1), Labels: map[string]string{"room": "a\\b\n", "floor": "1"}},
+		{Kind: "gauge", ID: "cpu.load", Value: 0.25},
+		{Kind: "gauge", ID: "cpu_load", Value: 1},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, FormatText, metrics))
+	assert.Equal(t, `# HELP cpu_load gauge cpu.load
+# TYPE cpu_load gauge
+cpu_load 0.25
+# HELP requests_total counter requests_total
+# TYPE requests_total counter
+requests_total 7
+# HELP temp gauge temp
+# TYPE temp gauge
+temp{floor="1",room="a\\b\n"} +Inf
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, Encode(&buf, FormatOpenMetrics, metrics[:1]))
+	assert.Equal(t, `# HELP requests counter requests_total
+# TYPE requests counter
+requests_total 7
+# EOF
+`, buf.String())
+}
+
+func TestEncode_series(t *testing.T) {
+	id := SeriesID("http_requests_total", map[string]string{"method": "get", "code": "200"})
+	assert.Equal(t, `http_requests_total{code="200",method="get"}`, id)
+	assert.Equal(t, "http_requests_total", Family(id))
+	assert.Equal(t, "up", Family("up"))
+
+	metrics := []Metric{
+		{Kind: "counter", ID: id, Value: 3, Labels: map[string]string{"method": "get", "code": "200"}},
+		{Kind: "counter", ID: `http_requests_total{code="500"}`, Value: 1, Labels: map[string]string{"code": "500"}},
+		{Kind: "gauge", ID: `http_requests_total{code="404"}`, Value: 1, Labels: map[string]string{"code": "404"}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, FormatText, metrics))
+	assert.Equal(t, `# HELP http_requests_total counter http_requests_total
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="get"} 3
+http_requests_total{code="500"} 1
+`, buf.String())
+
+	// labels are taken from the ID when they were not kept
+	for i := range metrics {
+		metrics[i].Labels = nil
+	}
+	buf.Reset()
+	require.NoError(t, Encode(&buf, FormatText, metrics))
+	assert.Equal(t, `# HELP http_requests_total counter http_requests_total
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="get"} 3
+http_requests_total{code="500"} 1
+`, buf.String())
+}
+
+func TestParseSeriesID(t *testing.T) {
+	l := map[string]string{"path": `C:\dir "a"`, "note": "x,y\nz", "code": "200"}
+	name, parsed := ParseSeriesID(SeriesID("requests", l))
+	assert.Equal(t, "requests", name)
+	assert.Equal(t, l, parsed)
+
+	for _, id := range []string{"up", `up{code}`, `up{code="200}`, `up{code="200"x}`} {
+		name, parsed = ParseSeriesID(id)
+		assert.Equal(t, id, name, id)
+		assert.Nil(t, parsed, id)
+	}
+
+	name, parsed = ParseSeriesID("up{}")
+	assert.Equal(t, "up", name)
+	assert.Nil(t, parsed)
+}
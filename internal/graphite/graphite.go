@@ -0,0 +1,79 @@
+// Package graphite receives the Graphite plaintext protocol and maps it onto isaac metrics
+package graphite
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+// Point is one line of the plaintext protocol
+type Point struct {
+	Path  string
+	Tags  map[string]string
+	Value float64
+	// Timestamp is in seconds, -1 or a missing timestamp is the time of receipt
+	Timestamp int64
+}
+
+// ParseLine parses "path value [timestamp]", the path may carry the tags of a tagged
+// series as path;tag=value;tag=value
+func ParseLine(line string) (Point, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Point{}, errors.Errorf("[graphite.ParseLine] expected \"path value timestamp\", got %q", line)
+	}
+
+	p := Point{Timestamp: -1}
+
+	path, tags, _ := strings.Cut(fields[0], ";")
+	if path == "" {
+		return Point{}, errors.Errorf("[graphite.ParseLine] empty path in %q", line)
+	}
+	p.Path = path
+	if tags != "" {
+		p.Tags = make(map[string]string)
+		for _, tag := range strings.Split(tags, ";") {
+			name, value, ok := strings.Cut(tag, "=")
+			if !ok || name == "" || value == "" {
+				return Point{}, errors.Errorf("[graphite.ParseLine] invalid tag %q in %q", tag, line)
+			}
+			p.Tags[name] = value
+		}
+	}
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Point{}, errors.Errorf("[graphite.ParseLine] invalid value %q of %s", fields[1], path)
+	}
+	p.Value = v
+
+	if len(fields) == 3 {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return Point{}, errors.Errorf("[graphite.ParseLine] invalid timestamp %q of %s", fields[2], path)
+		}
+		p.Timestamp = int64(ts)
+	}
+
+	return p, nil
+}
+
+// Map applies the rules to the points. NaN values, which Graphite uses for missing data,
+// and points dropped by a rule are skipped.
+func Map(rules *ingest.Rules, points []Point) []ingest.Series {
+	res := make([]ingest.Series, 0, len(points))
+	for _, p := range points {
+		if math.IsNaN(p.Value) {
+			continue
+		}
+		if s, ok := rules.MapGraphite(p.Path, p.Tags, p.Value); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
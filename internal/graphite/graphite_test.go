@@ -0,0 +1,37 @@
+package graphite
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+func TestParseLine(t *testing.T) {
+	p, err := ParseLine("servers.web1.cpu 12.5 1700000000")
+	require.NoError(t, err)
+	assert.Equal(t, Point{Path: "servers.web1.cpu", Value: 12.5, Timestamp: 1700000000}, p)
+
+	p, err = ParseLine("disk.used;host=web1;mount=/ 42")
+	require.NoError(t, err)
+	assert.Equal(t, Point{Path: "disk.used", Tags: map[string]string{"host": "web1", "mount": "/"}, Value: 42, Timestamp: -1}, p)
+
+	for _, line := range []string{"", "cpu", "cpu x 1", "cpu 1 x", "cpu;host 1 1", "cpu 1 2 3"} {
+		_, err = ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestMap(t *testing.T) {
+	rules := &ingest.Rules{Graphite: []ingest.Rule{{Match: "carbon.**", Drop: true}}}
+
+	series := Map(rules, []Point{
+		{Path: "cpu", Value: 1},
+		{Path: "memory", Value: math.NaN()},
+		{Path: "carbon.agents.a", Value: 1},
+	})
+	assert.Equal(t, []ingest.Series{{Kind: "gauge", ID: "cpu", Value: 1}}, series)
+}
@@ -0,0 +1,149 @@
+package graphite
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+
+	pkgerrors "github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/ingest"
+	inet "github.com/sshirox/isaac/internal/net"
+)
+
+const (
+	// maxLineSize is the longest line accepted before the connection is closed
+	maxLineSize = 64 * 1024
+	// maxBatch is the number of points written at once
+	maxBatch = 1000
+)
+
+// Listener receives newline separated plaintext lines over TCP
+type Listener struct {
+	rules *ingest.Rules
+	write func([]ingest.Series)
+	tcp   net.Listener
+	// trusted are the networks connections are accepted from, empty accepts all
+	trusted []*net.IPNet
+}
+
+// NewListener binds addr, received points are mapped by rules and passed to write
+func NewListener(addr string, rules *ingest.Rules, write func([]ingest.Series)) (*Listener, error) {
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, pkgerrors.Wrap(err, "[graphite.NewListener] listen tcp")
+	}
+
+	return &Listener{rules: rules, write: write, tcp: tcp}, nil
+}
+
+// Addr returns the address the listener is bound to
+func (l *Listener) Addr() net.Addr {
+	return l.tcp.Addr()
+}
+
+// Trust accepts connections from the subnets only, it is called before Serve
+func (l *Listener) Trust(subnets []*net.IPNet) {
+	l.trusted = subnets
+}
+
+func (l *Listener) allows(addr net.Addr) bool {
+	if len(l.trusted) == 0 {
+		return true
+	}
+	a, ok := addr.(*net.TCPAddr)
+	return ok && inet.ContainsIP(l.trusted, a.IP)
+}
+
+// Serve accepts connections until stop is closed, then closes them and waits for their
+// last points to be written
+func (l *Listener) Serve(stop chan struct{}) {
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+	var connsMu sync.Mutex
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.tcp.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("accept graphite connection", "err", err)
+				}
+				return
+			}
+			if !l.allows(conn.RemoteAddr()) {
+				slog.Debug("close graphite connection from untrusted address", "remote", conn.RemoteAddr().String())
+				conn.Close()
+				continue
+			}
+
+			connsMu.Lock()
+			conns[conn] = struct{}{}
+			connsMu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.read(conn)
+
+				connsMu.Lock()
+				delete(conns, conn)
+				connsMu.Unlock()
+			}()
+		}
+	}()
+
+	<-stop
+	l.tcp.Close()
+	connsMu.Lock()
+	for conn := range conns {
+		conn.Close()
+	}
+	connsMu.Unlock()
+
+	wg.Wait()
+	slog.Info("stop graphite listener")
+}
+
+// read writes the points of a connection whenever no more input is buffered
+func (l *Listener) read(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReaderSize(conn, maxLineSize)
+	var points []Point
+	flush := func() {
+		if len(points) > 0 {
+			l.write(Map(l.rules, points))
+			points = points[:0]
+		}
+	}
+	defer flush()
+
+	for {
+		line, err := r.ReadSlice('\n')
+		// a line longer than the buffer is not parsed, the connection is closed below
+		if s := strings.TrimSpace(string(line)); s != "" && (err == nil || errors.Is(err, io.EOF)) {
+			if p, perr := ParseLine(s); perr != nil {
+				slog.Debug("parse graphite line", "err", perr)
+			} else {
+				points = append(points, p)
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Debug("read graphite connection", "err", err)
+			}
+			return
+		}
+
+		if len(points) >= maxBatch || r.Buffered() == 0 {
+			flush()
+		}
+	}
+}
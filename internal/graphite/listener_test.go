@@ -0,0 +1,76 @@
+package graphite
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+func TestListener(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		values = make(map[string]float64)
+	)
+	l, err := NewListener("127.0.0.1:0", nil, func(series []ingest.Series) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range series {
+			values[s.ID] = s.Value
+		}
+	})
+	require.NoError(t, err)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(stop)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("cpu 1 1700000000\ninvalid\nmemory 2 1700000000\n"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return values["cpu"] == 1 && values["memory"] == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	close(stop)
+	<-done
+}
+
+func TestListener_Trust(t *testing.T) {
+	l, err := NewListener("127.0.0.1:0", nil, func([]ingest.Series) {})
+	require.NoError(t, err)
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	l.Trust([]*net.IPNet{subnet})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(stop)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	// the connection is closed right after it was accepted
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	close(stop)
+	<-done
+}
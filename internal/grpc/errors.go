@@ -0,0 +1,28 @@
+package grpc
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sshirox/isaac/internal/auth"
+	errs "github.com/sshirox/isaac/internal/errors"
+)
+
+// toStatus maps storage errors onto gRPC codes the same way the HTTP handlers
+// map them onto 400 and 404 statuses.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, errs.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errs.ErrEmptyName),
+		errors.Is(err, errs.ErrEmptyValue),
+		errors.Is(err, errs.ErrInvalidType):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
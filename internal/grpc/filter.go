@@ -0,0 +1,105 @@
+package grpc
+
+import (
+	"encoding/base64"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	errs "github.com/sshirox/isaac/internal/errors"
+	"github.com/sshirox/isaac/internal/metric"
+	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
+)
+
+const (
+	maxPageSize = 1000
+)
+
+type metricsFilter struct {
+	glob   string
+	prefix string
+	kind   string
+	labels map[string]string
+}
+
+func newMetricsFilter(glob, prefix, kind string, labels map[string]string) (*metricsFilter, error) {
+	if kind != "" && kind != metric.GaugeMetricType && kind != metric.CounterMetricType {
+		return nil, errs.ErrInvalidType
+	}
+
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, errors.Wrap(err, "invalid filter")
+		}
+	}
+
+	return &metricsFilter{
+		glob:   glob,
+		prefix: prefix,
+		kind:   kind,
+		labels: labels,
+	}, nil
+}
+
+func (f *metricsFilter) match(m *pb.Metric) bool {
+	if f.kind != "" && m.Kind != f.kind {
+		return false
+	}
+
+	if f.prefix != "" && !strings.HasPrefix(m.Name, f.prefix) {
+		return false
+	}
+
+	if f.glob != "" {
+		if ok, _ := path.Match(f.glob, m.Name); !ok {
+			return false
+		}
+	}
+
+	for name, value := range f.labels {
+		if v, ok := m.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// paginate sorts metrics by name and kind and cuts out the page that follows
+// the metric encoded in token.
+func paginate(metrics []*pb.Metric, size int32, token string) ([]*pb.Metric, string, error) {
+	sort.Slice(metrics, func(i, j int) bool {
+		return pageKey(metrics[i]) < pageKey(metrics[j])
+	})
+
+	start := 0
+	if token != "" {
+		after, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "invalid page token")
+		}
+		start = sort.Search(len(metrics), func(i int) bool {
+			return pageKey(metrics[i]) > string(after)
+		})
+	}
+
+	if size <= 0 || size > maxPageSize {
+		size = maxPageSize
+	}
+
+	end := start + int(size)
+	if end >= len(metrics) {
+		return metrics[start:], "", nil
+	}
+
+	page := metrics[start:end]
+	next := base64.RawURLEncoding.EncodeToString([]byte(pageKey(page[len(page)-1])))
+
+	return page, next, nil
+}
+
+func pageKey(m *pb.Metric) string {
+	return m.Name + "\x00" + m.Kind
+}
@@ -0,0 +1,145 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/sshirox/isaac/internal/audit"
+	"github.com/sshirox/isaac/internal/auth"
+	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
+)
+
+var methodScopes = map[string]auth.Scope{
+	pb.MetricsService_SendMetrics_FullMethodName:   auth.ScopeWrite,
+	pb.MetricsService_UpdateMetric_FullMethodName:  auth.ScopeWrite,
+	pb.MetricsService_StreamMetrics_FullMethodName: auth.ScopeWrite,
+	pb.MetricsService_DeleteMetric_FullMethodName:  auth.ScopeAdmin,
+	pb.MetricsService_GetMetrics_FullMethodName:    auth.ScopeRead,
+	pb.MetricsService_GetMetric_FullMethodName:     auth.ScopeRead,
+	pb.MetricsService_WatchMetrics_FullMethodName:  auth.ScopeRead,
+
+	otlpExportMethod: auth.ScopeWrite,
+}
+
+var methodActions = map[string]audit.Action{
+	pb.MetricsService_SendMetrics_FullMethodName:   audit.ActionBulkUpdate,
+	pb.MetricsService_StreamMetrics_FullMethodName: audit.ActionBulkUpdate,
+	pb.MetricsService_UpdateMetric_FullMethodName:  audit.ActionUpdate,
+	pb.MetricsService_DeleteMetric_FullMethodName:  audit.ActionDelete,
+
+	otlpExportMethod: audit.ActionBulkUpdate,
+}
+
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
+
+// AuthUnaryInterceptor checks the bearer token sent in the authorization metadata.
+func AuthUnaryInterceptor(authn *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, authn, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor checks the bearer token sent in the authorization metadata.
+func AuthStreamInterceptor(authn *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), authn, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, authn *auth.Authenticator, method string) (context.Context, error) {
+	scope, ok := methodScopes[method]
+	if !ok {
+		// reflection and other services are not protected
+		return ctx, nil
+	}
+
+	var value string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			value = auth.BearerToken(v[0])
+		}
+	}
+
+	t, err := authn.Authenticate(ctx, value, scope)
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		slog.ErrorContext(ctx, "authenticate token", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "authenticate token")
+	}
+
+	return auth.WithToken(ctx, t), nil
+}
+
+// AuditUnaryInterceptor records mutations made by the call, it has to run after the auth interceptor.
+func AuditUnaryInterceptor(l *audit.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(auditContext(ctx, l, info.FullMethod), req)
+	}
+}
+
+// AuditStreamInterceptor records mutations made by the stream, it has to run after the auth interceptor.
+func AuditStreamInterceptor(l *audit.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: auditContext(ss.Context(), l, info.FullMethod)})
+	}
+}
+
+func auditContext(ctx context.Context, l *audit.Logger, method string) context.Context {
+	action, ok := methodActions[method]
+	if !ok {
+		return ctx
+	}
+
+	actor := audit.Actor{
+		Action:    action,
+		Transport: audit.TransportGRPC,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		actor.Source = hostOf(p.Addr.String())
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(audit.AgentIDHeader); len(v) > 0 {
+			actor.AgentID = v[0]
+		}
+	}
+	if t := auth.FromContext(ctx); t != nil {
+		actor.Token = t.ID
+	}
+
+	return l.NewContext(ctx, actor)
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,43 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sshirox/isaac/internal/auth"
+	"github.com/sshirox/isaac/internal/ingest"
+	"github.com/sshirox/isaac/internal/otlp"
+)
+
+// otlpExportMethod is the full method name of the OTLP export call
+const otlpExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// OTLPServer implements the OTLP/gRPC metrics service.
+type OTLPServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	writer *ingest.Writer
+}
+
+// NewOTLPServer creates the OTLP metrics service writing with writer.
+func NewOTLPServer(writer *ingest.Writer) *OTLPServer {
+	return &OTLPServer{writer: writer}
+}
+
+// Export stores the data points, points that cannot be stored are reported as a partial success.
+func (s *OTLPServer) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	series, stats := otlp.Map(req)
+	for _, m := range series {
+		if !auth.AllowsName(ctx, m.ID) {
+			return nil, status.Errorf(codes.PermissionDenied, "metric name %s is not allowed", m.ID)
+		}
+	}
+
+	s.writer.Write(ctx, series)
+	slog.Debug("otlp export", "points", stats.DataPoints, "rejected", stats.Rejected)
+
+	return otlp.Response(stats), nil
+}
@@ -0,0 +1,63 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/sshirox/isaac/internal/ingest"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestOTLPServer_Export(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(srv, NewOTLPServer(ingest.NewWriter(s)))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	sum := func(v int64) *colmetricspb.ExportMetricsServiceRequest {
+		return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: "requests",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					IsMonotonic:            true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					DataPoints: []*metricspb.NumberDataPoint{
+						{Value: &metricspb.NumberDataPoint_AsInt{AsInt: v}},
+					},
+				}},
+			}}}},
+		}}}
+	}
+
+	client := colmetricspb.NewMetricsServiceClient(conn)
+	for _, v := range []int64{2, 3} {
+		res, err := client.Export(context.Background(), sum(v))
+		require.NoError(t, err)
+		assert.Nil(t, res.GetPartialSuccess())
+	}
+
+	val, ok := s.ReceiveCounter("requests")
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), val)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/sshirox/isaac/internal/audit"
+	"github.com/sshirox/isaac/internal/auth"
 	"github.com/sshirox/isaac/internal/metric"
 	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
 	"github.com/sshirox/isaac/internal/storage"
@@ -12,6 +14,8 @@ import (
 	"log/slog"
 	"strings"
 	"sync"
+
+	errs "github.com/sshirox/isaac/internal/errors"
 )
 
 // Server implements the gRPC server for handling metrics.
@@ -39,26 +43,9 @@ func (s *Server) SendMetrics(ctx context.Context, req *pb.SendMetricsRequest) (*
 	var errorMessages []string
 
 	for _, m := range req.Metrics {
-		switch m.Kind {
-		case metric.CounterMetricType:
-			if m.Delta == nil {
-				slog.Warn("Skipped counter update: delta is nil", slog.String("metric", m.Name))
-				errorMessages = append(errorMessages, fmt.Sprintf("delta is nil for metric: %s", m.Name))
-				continue
-			}
-			s.storage.UpdateCounter(m.Name, *m.Delta)
-
-		case metric.GaugeMetricType:
-			if m.Value == nil {
-				slog.Warn("Skipped gauge update: value is nil", slog.String("metric", m.Name))
-				errorMessages = append(errorMessages, fmt.Sprintf("value is nil for metric: %s", m.Name))
-				continue
-			}
-			s.storage.UpdateGauge(m.Name, *m.Value)
-
-		default:
-			slog.Warn("Unknown metric type", slog.String("type", m.Kind), slog.String("metric", m.Name))
-			errorMessages = append(errorMessages, fmt.Sprintf("unknown metric type: %s", m.Kind))
+		if err := s.update(ctx, m); err != nil {
+			slog.Warn("Skipped metric update", slog.String("metric", m.Name), slog.Any("error", err))
+			errorMessages = append(errorMessages, fmt.Sprintf("%v for metric: %s", err, m.Name))
 			continue
 		}
 		updatedMetrics = append(updatedMetrics, m)
@@ -72,29 +59,199 @@ func (s *Server) SendMetrics(ctx context.Context, req *pb.SendMetricsRequest) (*
 	return &pb.SendMetricsResponse{Metrics: updatedMetrics}, nil
 }
 
-// GetMetrics returns all stored metrics.
+// GetMetrics returns stored metrics matching the request filters, page by page.
 func (s *Server) GetMetrics(ctx context.Context, req *pb.GetMetricsRequest) (*pb.GetMetricsResponse, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, status.Errorf(codes.Canceled, "request canceled: %v", err)
 	}
 
-	var metrics []*pb.Metric
+	filter, err := newMetricsFilter(req.Filter, req.Prefix, req.Kind, req.Labels)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
+	s.mu.Lock()
+	var metrics []*pb.Metric
 	for name, value := range s.storage.ReceiveAllGauges() {
-		metrics = append(metrics, &pb.Metric{
-			Name:  name,
-			Kind:  metric.GaugeMetricType,
-			Value: &value,
-		})
+		m := s.gauge(name, value)
+		if filter.match(m) && auth.AllowsName(ctx, name) {
+			metrics = append(metrics, m)
+		}
 	}
 	for name, value := range s.storage.ReceiveAllCounters() {
-		metrics = append(metrics, &pb.Metric{
-			Name:  name,
-			Kind:  metric.CounterMetricType,
-			Delta: &value,
-		})
+		m := s.counter(name, value)
+		if filter.match(m) && auth.AllowsName(ctx, name) {
+			metrics = append(metrics, m)
+		}
+	}
+	s.mu.Unlock()
+
+	page, next, err := paginate(metrics, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	slog.Info("Metrics requested", slog.Int("count", len(page)))
+	return &pb.GetMetricsResponse{Metrics: page, NextPageToken: next}, nil
+}
+
+// GetMetric returns a single metric by name and kind.
+func (s *Server) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.Errorf(codes.Canceled, "request canceled: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.receive(ctx, req.Name, req.Kind)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.GetMetricResponse{Metric: m}, nil
+}
+
+// UpdateMetric applies a single metric and returns its stored state.
+func (s *Server) UpdateMetric(ctx context.Context, req *pb.UpdateMetricRequest) (*pb.UpdateMetricResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.Errorf(codes.Canceled, "request canceled: %v", err)
+	}
+
+	if req.Metric == nil {
+		return nil, toStatus(errs.ErrEmptyName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.update(ctx, req.Metric); err != nil {
+		return nil, toStatus(err)
+	}
+
+	m, err := s.receive(ctx, req.Metric.Name, req.Metric.Kind)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.UpdateMetricResponse{Metric: m}, nil
+}
+
+// DeleteMetric removes a single metric by name and kind.
+func (s *Server) DeleteMetric(ctx context.Context, req *pb.DeleteMetricRequest) (*pb.DeleteMetricResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.Errorf(codes.Canceled, "request canceled: %v", err)
 	}
 
-	slog.Info("All metrics requested", slog.Int("count", len(metrics)))
-	return &pb.GetMetricsResponse{Metrics: metrics}, nil
+	if req.Name == "" {
+		return nil, toStatus(errs.ErrEmptyName)
+	}
+
+	if !auth.AllowsName(ctx, req.Name) {
+		return nil, toStatus(auth.ErrForbidden)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Kind {
+	case metric.GaugeMetricType:
+		old, ok := s.storage.ReceiveGauge(req.Name)
+		if !ok || !s.storage.DeleteGauge(req.Name) {
+			return nil, toStatus(errs.ErrNotFound)
+		}
+		audit.Deleted(ctx, req.Kind, req.Name, &old, nil)
+	case metric.CounterMetricType:
+		old, ok := s.storage.ReceiveCounter(req.Name)
+		if !ok || !s.storage.DeleteCounter(req.Name) {
+			return nil, toStatus(errs.ErrNotFound)
+		}
+		audit.Deleted(ctx, req.Kind, req.Name, nil, &old)
+	default:
+		return nil, toStatus(errs.ErrInvalidType)
+	}
+
+	slog.Info("Metric deleted", slog.String("metric", req.Name), slog.String("type", req.Kind))
+	return &pb.DeleteMetricResponse{}, nil
+}
+
+func (s *Server) update(ctx context.Context, m *pb.Metric) error {
+	if m.Name == "" {
+		return errs.ErrEmptyName
+	}
+
+	if !auth.AllowsName(ctx, m.Name) {
+		return auth.ErrForbidden
+	}
+
+	switch m.Kind {
+	case metric.CounterMetricType:
+		if m.Delta == nil {
+			return errs.ErrEmptyValue
+		}
+	case metric.GaugeMetricType:
+		if m.Value == nil {
+			return errs.ErrEmptyValue
+		}
+	default:
+		return errs.ErrInvalidType
+	}
+
+	// labels are set first, so subscribers get them with the update
+	if m.Labels != nil {
+		s.storage.SetLabels(m.Kind, m.Name, m.Labels)
+	}
+
+	if m.Kind == metric.CounterMetricType {
+		audit.UpdateCounter(ctx, s.storage, m.Name, *m.Delta)
+	} else {
+		audit.UpdateGauge(ctx, s.storage, m.Name, *m.Value)
+	}
+
+	return nil
+}
+
+func (s *Server) receive(ctx context.Context, name, kind string) (*pb.Metric, error) {
+	if name == "" {
+		return nil, errs.ErrEmptyName
+	}
+
+	if !auth.AllowsName(ctx, name) {
+		return nil, auth.ErrForbidden
+	}
+
+	switch kind {
+	case metric.GaugeMetricType:
+		value, ok := s.storage.ReceiveGauge(name)
+		if !ok {
+			return nil, errs.ErrNotFound
+		}
+		return s.gauge(name, value), nil
+	case metric.CounterMetricType:
+		delta, ok := s.storage.ReceiveCounter(name)
+		if !ok {
+			return nil, errs.ErrNotFound
+		}
+		return s.counter(name, delta), nil
+	default:
+		return nil, errs.ErrInvalidType
+	}
+}
+
+func (s *Server) gauge(name string, value float64) *pb.Metric {
+	return &pb.Metric{
+		Name:   name,
+		Kind:   metric.GaugeMetricType,
+		Value:  &value,
+		Labels: s.storage.ReceiveLabels(metric.GaugeMetricType, name),
+	}
+}
+
+func (s *Server) counter(name string, delta int64) *pb.Metric {
+	return &pb.Metric{
+		Name:   name,
+		Kind:   metric.CounterMetricType,
+		Delta:  &delta,
+		Labels: s.storage.ReceiveLabels(metric.CounterMetricType, name),
+	}
 }
@@ -0,0 +1,221 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func newTestClient(t *testing.T, s *storage.MemStorage) pb.MetricsServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterMetricsServiceServer(srv, NewServer(s))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewMetricsServiceClient(conn)
+}
+
+func newTestStorage() *storage.MemStorage {
+	s := storage.NewMemStorage()
+	s.UpdateGauge("Alloc", 10.5)
+	s.UpdateGauge("HeapAlloc", 20)
+	s.UpdateGauge("HeapSys", 30)
+	s.UpdateCounter("PollCount", 5)
+	s.SetLabels("gauge", "HeapSys", map[string]string{"host": "a"})
+
+	return s
+}
+
+func names(metrics []*pb.Metric) []string {
+	var res []string
+	for _, m := range metrics {
+		res = append(res, m.Name)
+	}
+	return res
+}
+
+func TestServer_GetMetrics(t *testing.T) {
+	client := newTestClient(t, newTestStorage())
+
+	testCases := []struct {
+		name string
+		req  *pb.GetMetricsRequest
+		want []string
+		code codes.Code
+	}{
+		{
+			name: "All metrics",
+			req:  &pb.GetMetricsRequest{},
+			want: []string{"Alloc", "HeapAlloc", "HeapSys", "PollCount"},
+		},
+		{
+			name: "Glob filter",
+			req:  &pb.GetMetricsRequest{Filter: "*Alloc"},
+			want: []string{"Alloc", "HeapAlloc"},
+		},
+		{
+			name: "Prefix filter",
+			req:  &pb.GetMetricsRequest{Prefix: "Heap"},
+			want: []string{"HeapAlloc", "HeapSys"},
+		},
+		{
+			name: "Kind filter",
+			req:  &pb.GetMetricsRequest{Kind: "counter"},
+			want: []string{"PollCount"},
+		},
+		{
+			name: "Label filter",
+			req:  &pb.GetMetricsRequest{Labels: map[string]string{"host": "a"}},
+			want: []string{"HeapSys"},
+		},
+		{
+			name: "Invalid glob",
+			req:  &pb.GetMetricsRequest{Filter: "[a"},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "Invalid kind",
+			req:  &pb.GetMetricsRequest{Kind: "invalid"},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "Invalid page token",
+			req:  &pb.GetMetricsRequest{PageToken: "%%%"},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client.GetMetrics(context.Background(), tc.req)
+			if tc.code != codes.OK {
+				assert.Equal(t, tc.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, names(resp.Metrics))
+		})
+	}
+}
+
+func TestServer_GetMetricsPagination(t *testing.T) {
+	client := newTestClient(t, newTestStorage())
+
+	var got []string
+	token := ""
+	for i := 0; i < 10; i++ {
+		resp, err := client.GetMetrics(context.Background(), &pb.GetMetricsRequest{PageSize: 3, PageToken: token})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(resp.Metrics), 3)
+		got = append(got, names(resp.Metrics)...)
+		token = resp.NextPageToken
+		if token == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"Alloc", "HeapAlloc", "HeapSys", "PollCount"}, got)
+}
+
+func TestServer_GetMetric(t *testing.T) {
+	client := newTestClient(t, newTestStorage())
+
+	testCases := []struct {
+		name string
+		req  *pb.GetMetricRequest
+		code codes.Code
+	}{
+		{name: "Existing gauge", req: &pb.GetMetricRequest{Name: "Alloc", Kind: "gauge"}, code: codes.OK},
+		{name: "Existing counter", req: &pb.GetMetricRequest{Name: "PollCount", Kind: "counter"}, code: codes.OK},
+		{name: "Not found", req: &pb.GetMetricRequest{Name: "Alloc1", Kind: "gauge"}, code: codes.NotFound},
+		{name: "Invalid kind", req: &pb.GetMetricRequest{Name: "Alloc", Kind: "invalid"}, code: codes.InvalidArgument},
+		{name: "Empty name", req: &pb.GetMetricRequest{Kind: "gauge"}, code: codes.InvalidArgument},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client.GetMetric(context.Background(), tc.req)
+			assert.Equal(t, tc.code, status.Code(err))
+			if tc.code == codes.OK {
+				assert.Equal(t, tc.req.Name, resp.Metric.Name)
+			}
+		})
+	}
+}
+
+func TestServer_UpdateMetric(t *testing.T) {
+	client := newTestClient(t, newTestStorage())
+
+	delta := int64(3)
+	resp, err := client.UpdateMetric(context.Background(), &pb.UpdateMetricRequest{
+		Metric: &pb.Metric{Name: "PollCount", Kind: "counter", Delta: &delta},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), resp.Metric.GetDelta())
+
+	_, err = client.UpdateMetric(context.Background(), &pb.UpdateMetricRequest{
+		Metric: &pb.Metric{Name: "Alloc", Kind: "gauge"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.UpdateMetric(context.Background(), &pb.UpdateMetricRequest{
+		Metric: &pb.Metric{Name: "Alloc", Kind: "invalid", Delta: &delta},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_UpdateMetricLabels(t *testing.T) {
+	s := storage.NewMemStorage()
+	client := newTestClient(t, s)
+	sub := s.Subscribe(1)
+	defer sub.Close()
+
+	// the first update of a new series is published with its labels
+	value := 0.5
+	_, err := client.UpdateMetric(context.Background(), &pb.UpdateMetricRequest{
+		Metric: &pb.Metric{Name: `cpu{host="a"}`, Kind: "gauge", Value: &value, Labels: map[string]string{"host": "a"}},
+	})
+	require.NoError(t, err)
+	u := <-sub.C()
+	assert.Equal(t, map[string]string{"host": "a"}, u.Labels)
+}
+
+func TestServer_DeleteMetric(t *testing.T) {
+	s := newTestStorage()
+	client := newTestClient(t, s)
+
+	_, err := client.DeleteMetric(context.Background(), &pb.DeleteMetricRequest{Name: "HeapSys", Kind: "gauge"})
+	require.NoError(t, err)
+
+	_, ok := s.ReceiveGauge("HeapSys")
+	assert.False(t, ok)
+
+	_, err = client.DeleteMetric(context.Background(), &pb.DeleteMetricRequest{Name: "HeapSys", Kind: "gauge"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.DeleteMetric(context.Background(), &pb.DeleteMetricRequest{Name: "HeapSys", Kind: "invalid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
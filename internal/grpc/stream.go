@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sshirox/isaac/internal/auth"
+	"github.com/sshirox/isaac/internal/metric"
+	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+const (
+	maxBatchSize    = 10000
+	watchBufferSize = 1024
+)
+
+// StreamMetrics applies batches pushed over a single stream and acknowledges each of them.
+// The next batch is not received until the previous ack is sent, so a client that does not
+// read acks is slowed down by the transport flow control.
+func (s *Server) StreamMetrics(stream pb.MetricsService_StreamMetricsServer) error {
+	ctx := stream.Context()
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &pb.BatchAck{Seq: batch.Seq}
+
+		if len(batch.Metrics) > maxBatchSize {
+			ack.Errors = append(ack.Errors, fmt.Sprintf("batch of %d metrics exceeds limit of %d", len(batch.Metrics), maxBatchSize))
+		} else {
+			s.mu.Lock()
+			for _, m := range batch.Metrics {
+				if err = s.update(ctx, m); err != nil {
+					ack.Errors = append(ack.Errors, fmt.Sprintf("%v for metric: %s", err, m.Name))
+					continue
+				}
+				ack.Accepted++
+			}
+			s.mu.Unlock()
+		}
+
+		if err = stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// WatchMetrics pushes storage updates matching the filter until the client goes away.
+// A client that reads slower than updates arrive is disconnected with ResourceExhausted.
+func (s *Server) WatchMetrics(req *pb.WatchMetricsRequest, stream pb.MetricsService_WatchMetricsServer) error {
+	filter, err := newMetricsFilter(req.Filter, req.Prefix, req.Kind, req.Labels)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sub := s.storage.Subscribe(watchBufferSize)
+	defer sub.Close()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case u, ok := <-sub.C():
+			if !ok {
+				slog.Warn("Watcher dropped", slog.Any("error", sub.Err()))
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+
+			m := toMetric(u)
+			if !filter.match(m) || !auth.AllowsName(ctx, m.Name) {
+				continue
+			}
+
+			err = stream.Send(&pb.MetricUpdate{
+				Metric:    m,
+				Deleted:   u.Deleted,
+				Timestamp: u.Time.UnixNano(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toMetric(u storage.Update) *pb.Metric {
+	m := &pb.Metric{
+		Name:   u.ID,
+		Kind:   u.Kind,
+		Labels: u.Labels,
+	}
+
+	if u.Deleted {
+		return m
+	}
+
+	switch u.Kind {
+	case metric.GaugeMetricType:
+		m.Value = &u.Value
+	case metric.CounterMetricType:
+		m.Delta = &u.Delta
+	}
+
+	return m
+}
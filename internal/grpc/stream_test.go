@@ -0,0 +1,88 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestServer_StreamMetrics(t *testing.T) {
+	s := storage.NewMemStorage()
+	client := newTestClient(t, s)
+
+	stream, err := client.StreamMetrics(context.Background())
+	require.NoError(t, err)
+
+	delta := int64(2)
+	value := 1.5
+	for seq := uint64(1); seq <= 3; seq++ {
+		err = stream.Send(&pb.MetricsBatch{
+			Seq: seq,
+			Metrics: []*pb.Metric{
+				{Name: "PollCount", Kind: "counter", Delta: &delta},
+				{Name: "Alloc", Kind: "gauge", Value: &value},
+				{Name: "Broken", Kind: "gauge"},
+			},
+		})
+		require.NoError(t, err)
+
+		ack, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, seq, ack.Seq)
+		assert.Equal(t, int32(2), ack.Accepted)
+		assert.Len(t, ack.Errors, 1)
+	}
+	require.NoError(t, stream.CloseSend())
+
+	got, _ := s.ReceiveCounter("PollCount")
+	assert.Equal(t, int64(6), got)
+}
+
+func TestServer_WatchMetrics(t *testing.T) {
+	s := storage.NewMemStorage()
+	client := newTestClient(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchMetrics(ctx, &pb.WatchMetricsRequest{Prefix: "Heap"})
+	require.NoError(t, err)
+
+	// keep producing updates until the subscription picks them up
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.UpdateGauge("Alloc", 2)
+				s.UpdateGauge("HeapSys", 3)
+			}
+		}
+	}()
+
+	u, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "HeapSys", u.Metric.Name)
+	assert.Equal(t, 3.0, u.Metric.GetValue())
+}
+
+func TestServer_WatchMetricsInvalidFilter(t *testing.T) {
+	client := newTestClient(t, storage.NewMemStorage())
+
+	stream, err := client.WatchMetrics(context.Background(), &pb.WatchMetricsRequest{Kind: "invalid"})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
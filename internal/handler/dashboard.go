@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sshirox/isaac/internal/auth"
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+//go:embed web
+var webFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"metricURL": metricURL,
+}).ParseFS(webFS, "web/templates/*.html"))
+
+// UpdateTracker returns when a stored metric was last changed
+type UpdateTracker interface {
+	ReceiveUpdated(kind, id string) (time.Time, bool)
+}
+
+type dashboardRow struct {
+	Name    string
+	Type    string
+	Value   string
+	Labels  map[string]string
+	Updated time.Time
+
+	number float64
+}
+
+type dashboardColumn struct {
+	Title  string
+	URL    string
+	Active bool
+	Desc   bool
+}
+
+type indexPage struct {
+	Rows    []dashboardRow
+	Columns []dashboardColumn
+	Query   string
+	Sort    string
+	Desc    bool
+	Total   int
+}
+
+type metricPage struct {
+	Row dashboardRow
+}
+
+// sortColumns are the columns of the index the rows can be sorted by
+var sortColumns = []struct{ key, title string }{
+	{"name", "Name"},
+	{"type", "Type"},
+	{"value", "Value"},
+	{"updated", "Updated"},
+}
+
+// IndexHandler serves the dashboard listing the metrics the client may read. The sort and
+// order parameters pick the column and direction, q keeps the metrics whose name or label
+// values contain it.
+func IndexHandler(repo Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		search := strings.TrimSpace(q.Get("q"))
+		sortKey := q.Get("sort")
+		if sortKey == "" {
+			sortKey = "name"
+		}
+		desc := q.Get("order") == "desc"
+
+		rows := dashboardRows(r, repo)
+		total := len(rows)
+		if search != "" {
+			rows = filterRows(rows, search)
+		}
+		sortRows(rows, sortKey, desc)
+
+		page := indexPage{Rows: rows, Query: search, Sort: sortKey, Desc: desc, Total: total}
+		for _, c := range sortColumns {
+			col := dashboardColumn{Title: c.title, Active: c.key == sortKey, Desc: c.key == sortKey && desc}
+
+			v := url.Values{"sort": {c.key}}
+			if col.Active && !desc {
+				v.Set("order", "desc")
+			}
+			if search != "" {
+				v.Set("q", search)
+			}
+			col.URL = "/?" + v.Encode()
+			page.Columns = append(page.Columns, col)
+		}
+
+		renderPage(rw, "index.html", page)
+	}
+}
+
+// MetricPageHandler serves the dashboard page of one metric with its type, labels, last
+// update and history
+func MetricPageHandler(repo Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		mType := chi.URLParam(r, "type")
+		name := chi.URLParam(r, "name")
+
+		if !auth.AllowsName(r.Context(), name) {
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte("metric name is not allowed"))
+			return
+		}
+
+		row := dashboardRow{Name: name, Type: mType}
+		switch mType {
+		case metric.GaugeMetricType:
+			val, ok := repo.ReceiveGauge(name)
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			row.Value = strconv.FormatFloat(val, 'g', -1, 64)
+		case metric.CounterMetricType:
+			val, ok := repo.ReceiveCounter(name)
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			row.Value = strconv.FormatInt(val, 10)
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid metric type"))
+			return
+		}
+
+		describeRow(repo, &row)
+		renderPage(rw, "metric.html", metricPage{Row: row})
+	}
+}
+
+// StaticHandler serves the scripts and styles of the dashboard
+func StaticHandler() http.Handler {
+	static, _ := fs.Sub(webFS, "web/static")
+	return http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+}
+
+func renderPage(rw http.ResponseWriter, name string, data any) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	if err := templates.ExecuteTemplate(rw, name, data); err != nil {
+		slog.Error("render dashboard", "page", name, "err", err)
+	}
+}
+
+func dashboardRows(r *http.Request, repo Repository) []dashboardRow {
+	var rows []dashboardRow
+
+	for name, val := range repo.ReceiveAllGauges() {
+		if !auth.AllowsName(r.Context(), name) {
+			continue
+		}
+		rows = append(rows, dashboardRow{
+			Name:   name,
+			Type:   metric.GaugeMetricType,
+			Value:  strconv.FormatFloat(val, 'g', -1, 64),
+			number: val,
+		})
+	}
+	for name, val := range repo.ReceiveAllCounters() {
+		if !auth.AllowsName(r.Context(), name) {
+			continue
+		}
+		rows = append(rows, dashboardRow{
+			Name:   name,
+			Type:   metric.CounterMetricType,
+			Value:  strconv.FormatInt(val, 10),
+			number: float64(val),
+		})
+	}
+
+	for i := range rows {
+		describeRow(repo, &rows[i])
+	}
+	return rows
+}
+
+// describeRow adds the labels and the last update when repo keeps them
+func describeRow(repo Repository, row *dashboardRow) {
+	if labeler, ok := repo.(Labeler); ok {
+		row.Labels = labeler.ReceiveLabels(row.Type, row.Name)
+	}
+	if tracker, ok := repo.(UpdateTracker); ok {
+		row.Updated, _ = tracker.ReceiveUpdated(row.Type, row.Name)
+	}
+}
+
+func filterRows(rows []dashboardRow, search string) []dashboardRow {
+	search = strings.ToLower(search)
+
+	res := rows[:0]
+	for _, row := range rows {
+		match := strings.Contains(strings.ToLower(row.Name), search)
+		for _, v := range row.Labels {
+			match = match || strings.Contains(strings.ToLower(v), search)
+		}
+		if match {
+			res = append(res, row)
+		}
+	}
+	return res
+}
+
+// sortRows sorts by the column, ties are broken by name and type so the order is stable
+func sortRows(rows []dashboardRow, key string, desc bool) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if desc {
+			a, b = b, a
+		}
+
+		switch key {
+		case "type":
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+		case "value":
+			if a.number != b.number {
+				return a.number < b.number
+			}
+		case "updated":
+			if !a.Updated.Equal(b.Updated) {
+				return a.Updated.Before(b.Updated)
+			}
+		}
+
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+}
+
+func metricURL(mType, name string) string {
+	return "/metric/" + mType + "/" + url.PathEscape(name)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestIndexHandler(t *testing.T) {
+	s := storage.NewMemStorage()
+	s.UpdateGauge("memory", 512)
+	s.UpdateGauge("cpu", 0.5)
+	s.UpdateCounter("requests", 7)
+	s.SetLabels("counter", "requests", map[string]string{"service": "api"})
+
+	r := chi.NewRouter()
+	r.Get("/", IndexHandler(s))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	get := func(query string) string {
+		res, err := http.Get(srv.URL + "/" + query)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	order := func(body string, names ...string) []int {
+		var pos []int
+		for _, name := range names {
+			pos = append(pos, strings.Index(body, `data-name="`+name+`"`))
+		}
+		return pos
+	}
+
+	body := get("")
+	assert.Contains(t, body, `<span id="shown">3</span> of 3 metrics`)
+	assert.Contains(t, body, `<span class="label">service=api</span>`)
+	assert.Contains(t, body, `href="/metric/gauge/cpu"`)
+	pos := order(body, "cpu", "memory", "requests")
+	assert.True(t, pos[0] >= 0 && pos[0] < pos[1] && pos[1] < pos[2], "sorted by name")
+
+	pos = order(get("?sort=value&order=desc"), "memory", "requests", "cpu")
+	assert.True(t, pos[0] >= 0 && pos[0] < pos[1] && pos[1] < pos[2], "sorted by value descending")
+
+	body = get("?q=API")
+	assert.Contains(t, body, `data-name="requests"`)
+	assert.NotContains(t, body, `data-name="cpu"`)
+	assert.Contains(t, body, `<span id="shown">1</span> of 3 metrics`)
+}
+
+func TestMetricPageHandler(t *testing.T) {
+	s := storage.NewMemStorage()
+	s.UpdateGauge(`cpu{host="a"}`, 0.5)
+	s.SetLabels("gauge", `cpu{host="a"}`, map[string]string{"host": "a"})
+
+	r := chi.NewRouter()
+	r.Get("/metric/{type}/{name}", MetricPageHandler(s))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/metric/gauge/" + "cpu%7Bhost=%22a%22%7D")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(body), `<dd class="value">0.5</dd>`)
+	assert.Contains(t, string(body), `host=a`)
+	assert.Contains(t, string(body), `<time datetime=`)
+
+	res, err = http.Get(srv.URL + "/metric/counter/cpu")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Get(srv.URL + "/metric/histogram/cpu")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestStaticHandler(t *testing.T) {
+	r := chi.NewRouter()
+	r.Handle("/static/*", StaticHandler())
+
+	for _, file := range []string{"dashboard.js", "dashboard.css"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/"+file, nil))
+		assert.Equal(t, http.StatusOK, w.Code, file)
+		assert.NotEmpty(t, w.Body.String(), file)
+	}
+}
@@ -2,18 +2,30 @@ package handler
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
-	"html/template"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-
+	"github.com/golang/snappy"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/sshirox/isaac/internal/audit"
+	"github.com/sshirox/isaac/internal/auth"
+	"github.com/sshirox/isaac/internal/expfmt"
+	"github.com/sshirox/isaac/internal/influx"
+	"github.com/sshirox/isaac/internal/ingest"
 	"github.com/sshirox/isaac/internal/metric"
+	"github.com/sshirox/isaac/internal/otlp"
+	"github.com/sshirox/isaac/internal/remotewrite"
 )
 
 type Repository interface {
@@ -33,7 +45,7 @@ func UpdateMetricsHandler(repo Repository) http.HandlerFunc {
 
 func updateMetrics(repo Repository, rw http.ResponseWriter, r *http.Request) {
 	mType := chi.URLParam(r, "type")
-	name := chi.URLParam(r, "name")
+	name := pathParam(r, "name")
 	value := chi.URLParam(r, "value")
 
 	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -46,6 +58,10 @@ func updateMetrics(repo Repository, rw http.ResponseWriter, r *http.Request) {
 		rw.WriteHeader(http.StatusBadRequest)
 		rw.Write([]byte("empty metric value"))
 		return
+	} else if !auth.AllowsName(r.Context(), name) {
+		rw.WriteHeader(http.StatusForbidden)
+		rw.Write([]byte("metric name is not allowed"))
+		return
 	}
 
 	switch mType {
@@ -56,7 +72,7 @@ func updateMetrics(repo Repository, rw http.ResponseWriter, r *http.Request) {
 			rw.Write([]byte("metric value is not a float"))
 			return
 		}
-		repo.UpdateGauge(name, val)
+		audit.UpdateGauge(r.Context(), repo, name, val)
 		rw.WriteHeader(http.StatusOK)
 		rw.Write([]byte("gauge successfully updated"))
 	case metric.CounterMetricType:
@@ -66,7 +82,7 @@ func updateMetrics(repo Repository, rw http.ResponseWriter, r *http.Request) {
 			rw.Write([]byte("metric value is not a integer"))
 			return
 		}
-		repo.UpdateCounter(name, val)
+		audit.UpdateCounter(r.Context(), repo, name, val)
 		rw.WriteHeader(http.StatusOK)
 		rw.Write([]byte("counter successfully updated"))
 	default:
@@ -82,12 +98,31 @@ func ValueMetricHandler(repo Repository) http.HandlerFunc {
 	}
 }
 
+// pathParam returns the URL parameter key decoded, chi leaves it escaped when
+// the path holds an escaped slash, e.g. a metric name with a slash in it
+func pathParam(r *http.Request, key string) string {
+	v := chi.URLParam(r, key)
+	if r.URL.RawPath == "" {
+		return v
+	}
+	if unescaped, err := url.PathUnescape(v); err == nil {
+		return unescaped
+	}
+	return v
+}
+
 func valueMetric(repo Repository, rw http.ResponseWriter, r *http.Request) {
 	mType := chi.URLParam(r, "type")
-	name := chi.URLParam(r, "name")
+	name := pathParam(r, "name")
 
 	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
+	if !auth.AllowsName(r.Context(), name) {
+		rw.WriteHeader(http.StatusForbidden)
+		rw.Write([]byte("metric name is not allowed"))
+		return
+	}
+
 	switch mType {
 	case metric.GaugeMetricType:
 		val, ok := repo.ReceiveGauge(name)
@@ -133,6 +168,12 @@ func UpdateByContentTypeHandler(repo Repository) http.HandlerFunc {
 				return
 			}
 
+			if !auth.AllowsName(r.Context(), m.ID) {
+				rw.WriteHeader(http.StatusForbidden)
+				rw.Write([]byte("metric name is not allowed"))
+				return
+			}
+
 			switch m.MType {
 			case metric.GaugeMetricType:
 				id, value := m.ID, m.Value
@@ -141,7 +182,7 @@ func UpdateByContentTypeHandler(repo Repository) http.HandlerFunc {
 					rw.Write([]byte("empty value"))
 					return
 				}
-				repo.UpdateGauge(id, *value)
+				audit.UpdateGauge(r.Context(), repo, id, *value)
 				newVal, _ := repo.ReceiveGauge(id)
 				m.Value = &newVal
 
@@ -154,7 +195,7 @@ func UpdateByContentTypeHandler(repo Repository) http.HandlerFunc {
 					rw.Write([]byte("empty delta"))
 					return
 				}
-				repo.UpdateCounter(id, *delta)
+				audit.UpdateCounter(r.Context(), repo, id, *delta)
 				newDelta, _ := repo.ReceiveCounter(id)
 				m.Delta = &newDelta
 
@@ -189,6 +230,22 @@ func BulkUpdateHandler(repo Repository) http.HandlerFunc {
 		}
 
 		for _, m := range metrics {
+			if !auth.AllowsName(r.Context(), m.ID) {
+				rw.WriteHeader(http.StatusForbidden)
+				rw.Write([]byte("metric name is not allowed"))
+				return
+			}
+		}
+
+		setter, _ := repo.(LabelSetter)
+		for _, m := range metrics {
+			// labels are set first, so the update is published with them
+			setLabels := func() {
+				if setter != nil && len(m.Labels) > 0 {
+					setter.SetLabels(m.MType, m.ID, m.Labels)
+				}
+			}
+
 			switch m.MType {
 			case metric.GaugeMetricType:
 				id, value := m.ID, m.Value
@@ -197,7 +254,8 @@ func BulkUpdateHandler(repo Repository) http.HandlerFunc {
 					rw.Write([]byte("empty value"))
 					return
 				}
-				repo.UpdateGauge(id, *value)
+				setLabels()
+				audit.UpdateGauge(r.Context(), repo, id, *value)
 			case metric.CounterMetricType:
 				id, delta := m.ID, m.Delta
 				if delta == nil {
@@ -205,7 +263,8 @@ func BulkUpdateHandler(repo Repository) http.HandlerFunc {
 					rw.Write([]byte("empty delta"))
 					return
 				}
-				repo.UpdateCounter(id, *delta)
+				setLabels()
+				audit.UpdateCounter(r.Context(), repo, id, *delta)
 			default:
 				rw.WriteHeader(http.StatusBadRequest)
 				rw.Write([]byte("invalid metric type"))
@@ -238,6 +297,12 @@ func ValueByContentTypeHandler(repo Repository) http.HandlerFunc {
 				return
 			}
 
+			if !auth.AllowsName(r.Context(), m.ID) {
+				rw.WriteHeader(http.StatusForbidden)
+				rw.Write([]byte("metric name is not allowed"))
+				return
+			}
+
 			id := m.ID
 			switch m.MType {
 			case metric.GaugeMetricType:
@@ -272,44 +337,376 @@ func ValueByContentTypeHandler(repo Repository) http.HandlerFunc {
 	}
 }
 
-func IndexHandler(repo Repository) http.HandlerFunc {
+// Labeler returns the labels of a stored metric
+type Labeler interface {
+	ReceiveLabels(kind, id string) map[string]string
+}
+
+// LabelSetter stores the labels of a metric
+type LabelSetter interface {
+	SetLabels(kind, id string, labels map[string]string)
+}
+
+// PrometheusHandler renders the stored metrics in the Prometheus text format, or in
+// OpenMetrics when the Accept header asks for it. Labels are added when repo keeps them.
+func PrometheusHandler(repo Repository) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		var tpl = template.Must(template.ParseFiles("templates/index.html"))
-		type metrics struct {
-			Gauges   map[string]float64
-			Counters map[string]int64
+		labeler, _ := repo.(Labeler)
+		labels := func(kind, id string) map[string]string {
+			if labeler == nil {
+				return nil
+			}
+			return labeler.ReceiveLabels(kind, id)
+		}
+
+		var metrics []expfmt.Metric
+		for id, val := range repo.ReceiveAllGauges() {
+			if auth.AllowsName(r.Context(), id) {
+				metrics = append(metrics, expfmt.Metric{
+					Kind: metric.GaugeMetricType, ID: id, Value: val, Labels: labels(metric.GaugeMetricType, id),
+				})
+			}
 		}
-		m := &metrics{
-			Gauges:   repo.ReceiveAllGauges(),
-			Counters: repo.ReceiveAllCounters(),
+		for id, val := range repo.ReceiveAllCounters() {
+			if auth.AllowsName(r.Context(), id) {
+				metrics = append(metrics, expfmt.Metric{
+					Kind: metric.CounterMetricType, ID: id, Value: float64(val), Labels: labels(metric.CounterMetricType, id),
+				})
+			}
 		}
 
-		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		format := expfmt.Negotiate(r.Header.Get("Accept"))
+		rw.Header().Set("Content-Type", format.ContentType())
 		rw.WriteHeader(http.StatusOK)
-		err := tpl.Execute(rw, m)
+		expfmt.Encode(rw, format, metrics)
+	}
+}
+
+const (
+	// maxIngestSize limits the decoded size of a remote write, OTLP or line protocol request
+	maxIngestSize = 32 << 20
+
+	remoteWriteSamplesHeader = "X-Prometheus-Remote-Write-Samples-Written"
+)
+
+// RemoteWriteHandler serves POST /api/v1/write, the Prometheus remote write 1.0 receiver.
+// It answers 204 with the number of stored samples in the X-Prometheus-Remote-Write-Samples-Written
+// header, only the latest sample of a series is stored.
+func RemoteWriteHandler(writer *ingest.Writer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/x-protobuf" || (params["proto"] != "" && params["proto"] != "prometheus.WriteRequest") {
+			rw.WriteHeader(http.StatusUnsupportedMediaType)
+			rw.Write([]byte("only snappy compressed prometheus.WriteRequest is supported"))
+			return
+		}
+
+		compressed, err := io.ReadAll(io.LimitReader(r.Body, maxIngestSize+1))
 		if err != nil {
-			panic(err)
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid body"))
+			return
 		}
+		if len(compressed) > maxIngestSize {
+			rw.WriteHeader(http.StatusRequestEntityTooLarge)
+			rw.Write([]byte("request is too large"))
+			return
+		}
+
+		size, err := snappy.DecodedLen(compressed)
+		if err != nil || size > maxIngestSize {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid snappy body"))
+			return
+		}
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid snappy body"))
+			return
+		}
+
+		req, err := remotewrite.Unmarshal(body)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid write request"))
+			return
+		}
+
+		series, stats := remotewrite.Map(req)
+		for _, s := range series {
+			if !auth.AllowsName(r.Context(), s.ID) {
+				rw.WriteHeader(http.StatusForbidden)
+				rw.Write([]byte("metric name is not allowed"))
+				return
+			}
+		}
+
+		writer.Write(r.Context(), series)
+		slog.Debug("remote write", "series", stats.Series, "samples", stats.Samples, "skipped", stats.Skipped)
+
+		rw.Header().Set(remoteWriteSamplesHeader, strconv.Itoa(stats.Series))
+		rw.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func PingDBHandler(db *sql.DB) http.HandlerFunc {
+// OTLPHandler serves POST /v1/metrics, the OTLP/HTTP metrics receiver for protobuf and JSON
+// requests. Points that cannot be stored are reported as a partial success.
+func OTLPHandler(writer *ingest.Writer) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		var (
+			unmarshal func([]byte, proto.Message) error
+			marshal   func(proto.Message) ([]byte, error)
+		)
+		switch mediaType {
+		case "application/x-protobuf":
+			unmarshal, marshal = proto.Unmarshal, proto.Marshal
+		case "application/json":
+			unmarshal, marshal = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal, protojson.Marshal
+		default:
+			rw.WriteHeader(http.StatusUnsupportedMediaType)
+			rw.Write([]byte("only application/x-protobuf and application/json are supported"))
+			return
+		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-		defer cancel()
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIngestSize+1))
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid body"))
+			return
+		}
+		if len(body) > maxIngestSize {
+			rw.WriteHeader(http.StatusRequestEntityTooLarge)
+			rw.Write([]byte("request is too large"))
+			return
+		}
+
+		req := &colmetricspb.ExportMetricsServiceRequest{}
+		if err = unmarshal(body, req); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid export request"))
+			return
+		}
 
-		if err := db.PingContext(ctx); err != nil {
+		series, stats := otlp.Map(req)
+		for _, s := range series {
+			if !auth.AllowsName(r.Context(), s.ID) {
+				rw.WriteHeader(http.StatusForbidden)
+				rw.Write([]byte("metric name is not allowed"))
+				return
+			}
+		}
+
+		writer.Write(r.Context(), series)
+		slog.Debug("otlp export", "points", stats.DataPoints, "rejected", stats.Rejected)
+
+		res, err := marshal(otlp.Response(stats))
+		if err != nil {
 			rw.WriteHeader(http.StatusInternalServerError)
-			rw.Write([]byte(err.Error()))
+			return
+		}
 
-			cancel()
+		rw.Header().Set("Content-Type", mediaType)
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(res)
+	}
+}
 
+// InfluxWriteHandler serves POST /write for the InfluxDB line protocol, fields are mapped
+// onto metrics by rules. Valid lines are written even when others fail to parse, which is
+// reported like InfluxDB reports a partial write.
+func InfluxWriteHandler(writer *ingest.Writer, rules *ingest.Rules) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIngestSize+1))
+		if err != nil {
+			influxError(rw, http.StatusBadRequest, "invalid body")
+			return
+		}
+		if len(body) > maxIngestSize {
+			influxError(rw, http.StatusRequestEntityTooLarge, "request is too large")
+			return
+		}
+
+		points, errs := influx.Parse(body)
+		series, stats := influx.Map(rules, points)
+		for _, s := range series {
+			if !auth.AllowsName(r.Context(), s.ID) {
+				influxError(rw, http.StatusForbidden, "metric name is not allowed")
+				return
+			}
+		}
+
+		writer.Write(r.Context(), series)
+		slog.Debug("influx write", "fields", stats.Fields, "skipped", stats.Skipped, "errors", len(errs))
+
+		if len(errs) > 0 {
+			influxError(rw, http.StatusBadRequest, fmt.Sprintf("partial write: %d lines failed, first: %v", len(errs), errs[0]))
 			return
 		}
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func influxError(rw http.ResponseWriter, status int, msg string) {
+	res, _ := json.Marshal(map[string]string{"error": msg})
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("X-Influxdb-Error", msg)
+	rw.WriteHeader(status)
+	rw.Write(res)
+}
+
+// HealthReporter reports the health of the storage backend, a nil error means healthy
+type HealthReporter interface {
+	Health() error
+}
+
+// PingHandler reports whether the storage backend is healthy, a nil reporter is always healthy
+func PingHandler(h HealthReporter) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		if h != nil {
+			if err := h.Health(); err != nil {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+		}
 
 		rw.WriteHeader(http.StatusOK)
 		rw.Write([]byte("success ping"))
 	}
 }
+
+type readiness struct {
+	Status  string `json:"status"`
+	Storage string `json:"storage"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReadyHandler serves the readiness check: 200 with status "ready" or 503 with status
+// "degraded" while the storage backend is unhealthy and metrics are kept in memory only
+func ReadyHandler(storage string, h HealthReporter) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		res := readiness{Status: "ready", Storage: storage}
+		code := http.StatusOK
+
+		if h != nil {
+			if err := h.Health(); err != nil {
+				res.Status = "degraded"
+				res.Error = err.Error()
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		rw.WriteHeader(code)
+		json.NewEncoder(rw).Encode(res)
+	}
+}
+
+func AuditHandler(l *audit.Logger) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		q := audit.Query{
+			Name:   r.URL.Query().Get("id"),
+			Action: audit.Action(r.URL.Query().Get("action")),
+			Limit:  100,
+		}
+
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			val, err := strconv.Atoi(limit)
+			if err != nil || val <= 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("invalid limit"))
+				return
+			}
+			q.Limit = val
+		}
+
+		if since := r.URL.Query().Get("since"); since != "" {
+			val, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("invalid since"))
+				return
+			}
+			q.Since = val
+		}
+
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(l.Recent(q))
+	}
+}
+
+// HistoryReader serves historical samples of a metric
+type HistoryReader interface {
+	Query(ctx context.Context, kind, name string, from, to time.Time, limit int) ([]metric.Sample, error)
+}
+
+// HistoryHandler serves GET /history/{type}/{name}?from=&to=&limit=, the last hour by default
+func HistoryHandler(h HistoryReader) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		mType := chi.URLParam(r, "type")
+		name := pathParam(r, "name")
+
+		if !auth.AllowsName(r.Context(), name) {
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte("metric name is not allowed"))
+			return
+		}
+
+		if mType != metric.GaugeMetricType && mType != metric.CounterMetricType {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid metric type"))
+			return
+		}
+
+		to := time.Now()
+		from := to.Add(-time.Hour)
+		limit := 0
+
+		if val := r.URL.Query().Get("from"); val != "" {
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("invalid from"))
+				return
+			}
+			from = t
+		}
+
+		if val := r.URL.Query().Get("to"); val != "" {
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("invalid to"))
+				return
+			}
+			to = t
+		}
+
+		if val := r.URL.Query().Get("limit"); val != "" {
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("invalid limit"))
+				return
+			}
+			limit = n
+		}
+
+		samples, err := h.Query(r.Context(), mType, name, from, to, limit)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte("read history"))
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		rw.WriteHeader(http.StatusOK)
+		json.NewEncoder(rw).Encode(samples)
+	}
+}
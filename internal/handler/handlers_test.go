@@ -2,16 +2,26 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/sshirox/isaac/internal/ingest"
 	"github.com/sshirox/isaac/internal/metric"
+	"github.com/sshirox/isaac/internal/remotewrite"
 	"github.com/sshirox/isaac/internal/storage"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/golang/snappy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestUpdateMetricsHandler(t *testing.T) {
@@ -133,6 +143,15 @@ func TestValueMetricHandler(t *testing.T) {
 			},
 			request: "/value/counter/PollCount/",
 		},
+		{
+			name: "Escaped counter name",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  200,
+				body:        "3",
+			},
+			request: "/value/counter/http%2Frequests%7Bcode=%22200%22%7D/",
+		},
 		{
 			name: "Not found gauge metric",
 			want: want{
@@ -166,6 +185,7 @@ func TestValueMetricHandler(t *testing.T) {
 	s := storage.NewMemStorage()
 	s.UpdateGauge("Alloc", 789765.77)
 	s.UpdateCounter("PollCount", 10)
+	s.UpdateCounter(`http/requests{code="200"}`, 3)
 
 	r.Get("/value/{type}/{name}/", ValueMetricHandler(s))
 
@@ -321,3 +341,222 @@ func TestGetMetricJSONHandler(t *testing.T) {
 		})
 	}
 }
+
+type fakeHistory struct {
+	kind, name string
+	from, to   time.Time
+	limit      int
+}
+
+func (f *fakeHistory) Query(_ context.Context, kind, name string, from, to time.Time, limit int) ([]metric.Sample, error) {
+	f.kind, f.name, f.from, f.to, f.limit = kind, name, from, to, limit
+
+	val := 1.5
+	return []metric.Sample{{Time: from, Value: &val}}, nil
+}
+
+func TestHistoryHandler(t *testing.T) {
+	h := &fakeHistory{}
+	r := chi.NewRouter()
+	r.Get("/history/{type}/{name}", HistoryHandler(h))
+
+	request := httptest.NewRequest(http.MethodGet, "/history/gauge/Alloc?from=2024-01-02T03:00:00Z&to=2024-01-02T04:00:00Z&limit=10", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"ts":"2024-01-02T03:00:00Z","value":1.5}]`, w.Body.String())
+	assert.Equal(t, "gauge", h.kind)
+	assert.Equal(t, "Alloc", h.name)
+	assert.Equal(t, time.Hour, h.to.Sub(h.from))
+	assert.Equal(t, 10, h.limit)
+
+	for _, req := range []string{"/history/invalid/Alloc", "/history/gauge/Alloc?from=yesterday", "/history/gauge/Alloc?limit=-1"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, req, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+}
+
+type fakeHealth struct {
+	err error
+}
+
+func (h *fakeHealth) Health() error {
+	return h.err
+}
+
+func TestPingAndReadyHandler(t *testing.T) {
+	h := &fakeHealth{}
+
+	w := httptest.NewRecorder()
+	PingHandler(h)(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	ReadyHandler("database", h)(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ready","storage":"database"}`, w.Body.String())
+
+	h.err = errors.New("connection refused")
+
+	w = httptest.NewRecorder()
+	PingHandler(h)(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "connection refused", w.Body.String())
+
+	w = httptest.NewRecorder()
+	ReadyHandler("database", h)(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"degraded","storage":"database","error":"connection refused"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	PingHandler(nil)(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	s := storage.NewMemStorage()
+	s.UpdateGauge("Alloc", 1.5)
+	s.UpdateCounter("PollCount", 3)
+	s.SetLabels(metric.GaugeMetricType, "Alloc", map[string]string{"host": `a"b`})
+
+	w := httptest.NewRecorder()
+	PrometheusHandler(s)(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP Alloc gauge Alloc
+# TYPE Alloc gauge
+Alloc{host="a\"b"} 1.5
+# HELP PollCount counter PollCount
+# TYPE PollCount counter
+PollCount 3
+`, w.Body.String())
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w = httptest.NewRecorder()
+	PrometheusHandler(s)(w, request)
+	assert.Equal(t, "application/openmetrics-text; version=1.0.0; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "# TYPE PollCount counter\nPollCount_total 3\n")
+	assert.True(t, bytes.HasSuffix(w.Body.Bytes(), []byte("# EOF\n")))
+}
+
+func TestBulkUpdateHandler(t *testing.T) {
+	s := storage.NewMemStorage()
+	body := `[{"id":"requests{env=\"prod\"}","type":"counter","delta":2,"labels":{"env":"prod"}},{"id":"load","type":"gauge","value":0.5}]`
+
+	w := httptest.NewRecorder()
+	BulkUpdateHandler(s)(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	val, ok := s.ReceiveCounter(`requests{env="prod"}`)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), val)
+	assert.Equal(t, map[string]string{"env": "prod"}, s.ReceiveLabels(metric.CounterMetricType, `requests{env="prod"}`))
+	assert.Nil(t, s.ReceiveLabels(metric.GaugeMetricType, "load"))
+}
+
+func TestRemoteWriteHandler(t *testing.T) {
+	s := storage.NewMemStorage()
+	req := &remotewrite.WriteRequest{Timeseries: []remotewrite.TimeSeries{{
+		Labels:  []remotewrite.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "200"}},
+		Samples: []remotewrite.Sample{{Value: 1, Timestamp: 1}, {Value: 3, Timestamp: 2}},
+	}}}
+
+	send := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		request.Header.Set("Content-Encoding", "snappy")
+		w := httptest.NewRecorder()
+		RemoteWriteHandler(ingest.NewWriter(s))(w, request)
+		return w
+	}
+
+	w := send("application/x-protobuf", snappy.Encode(nil, req.Marshal()))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Prometheus-Remote-Write-Samples-Written"))
+
+	val, ok := s.ReceiveCounter(`http_requests_total{code="200"}`)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), val)
+	assert.Equal(t, map[string]string{"code": "200"}, s.ReceiveLabels(metric.CounterMetricType, `http_requests_total{code="200"}`))
+
+	w = send("application/x-protobuf;proto=io.prometheus.write.v2.Request", snappy.Encode(nil, req.Marshal()))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = send("application/x-protobuf", req.Marshal())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestInfluxWriteHandler(t *testing.T) {
+	s := storage.NewMemStorage()
+	rules := &ingest.Rules{Influx: []ingest.Rule{{Measurement: "http", Field: "requests", Name: "http_requests_total", Type: "counter"}}}
+
+	send := func(body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/write?db=telegraf", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		InfluxWriteHandler(ingest.NewWriter(s), rules)(w, request)
+		return w
+	}
+
+	w := send("cpu,host=a usage=12.5\nhttp,host=a requests=7i\n")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	val, ok := s.ReceiveGauge(`cpu_usage{host="a"}`)
+	assert.True(t, ok)
+	assert.Equal(t, 12.5, val)
+	count, ok := s.ReceiveCounter(`http_requests_total{host="a"}`)
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), count)
+
+	w = send("http,host=a requests=10i\ninvalid\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "partial write")
+	count, _ = s.ReceiveCounter(`http_requests_total{host="a"}`)
+	assert.Equal(t, int64(10), count)
+}
+
+func TestOTLPHandler(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	send := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		OTLPHandler(ingest.NewWriter(s))(w, request)
+		return w
+	}
+
+	w := send("application/json", []byte(`{"resourceMetrics":[{
+		"resource":{"attributes":[{"key":"host","value":{"stringValue":"a"}}]},
+		"scopeMetrics":[{"metrics":[
+			{"name":"temperature","gauge":{"dataPoints":[{"asDouble":21.5}]}},
+			{"name":"requests","sum":{"isMonotonic":true,"aggregationTemporality":2,"dataPoints":[{"asInt":"7"}]}},
+			{"name":"latency","summary":{"dataPoints":[{}]}}
+		]}]
+	}]}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"partialSuccess":{"rejectedDataPoints":"1",
+		"errorMessage":"exponential histograms, summaries, points without a value and unspecified temporality are not supported"}}`, w.Body.String())
+
+	val, ok := s.ReceiveGauge(`temperature{host="a"}`)
+	assert.True(t, ok)
+	assert.Equal(t, 21.5, val)
+	delta, ok := s.ReceiveCounter(`requests{host="a"}`)
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), delta)
+
+	body, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{})
+	require.NoError(t, err)
+	w = send("application/x-protobuf", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-protobuf", w.Header().Get("Content-Type"))
+
+	w = send("application/json", []byte(`{"resourceMetrics":`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send("text/plain", nil)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sshirox/isaac/internal/auth"
+	"github.com/sshirox/isaac/internal/metric"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+// streamBufferSize is the number of updates a stream client may fall behind before it is dropped
+const streamBufferSize = 1024
+
+// Subscriber delivers storage updates as they are applied
+type Subscriber interface {
+	Subscribe(size int) *storage.Subscription
+}
+
+// StreamOptions are the server side limits of metric streams
+type StreamOptions struct {
+	// Throttle is the shortest interval between events sent to a client, updates of a
+	// metric in between are coalesced into its latest value. Clients may ask for more.
+	Throttle time.Duration
+	// Heartbeat is the interval of keep-alive messages, zero disables them
+	Heartbeat time.Duration
+	// Done ends all streams when closed
+	Done <-chan struct{}
+}
+
+type streamEvent struct {
+	ID      string            `json:"id"`
+	MType   string            `json:"type"`
+	Delta   *int64            `json:"delta,omitempty"`
+	Value   *float64          `json:"value,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Deleted bool              `json:"deleted,omitempty"`
+	Time    time.Time         `json:"ts"`
+}
+
+type streamFilter struct {
+	glob   string
+	prefix string
+	kind   string
+	labels map[string]string
+}
+
+func (f *streamFilter) match(u storage.Update) bool {
+	if f.kind != "" && u.Kind != f.kind {
+		return false
+	}
+	if f.prefix != "" && !strings.HasPrefix(u.ID, f.prefix) {
+		return false
+	}
+	if f.glob != "" {
+		if ok, _ := path.Match(f.glob, u.ID); !ok {
+			return false
+		}
+	}
+	for name, value := range f.labels {
+		if v, ok := u.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+var upgrader = websocket.Upgrader{}
+
+// StreamHandler serves GET /stream, pushing metric updates as Server-Sent Events or, when
+// the client asks for an upgrade, as WebSocket text messages. The filter, prefix, kind and
+// label=name=value parameters select metrics like WatchMetrics does, interval asks for a
+// longer throttle than the server one.
+func StreamHandler(s Subscriber, opts StreamOptions) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		f := &streamFilter{glob: q.Get("filter"), prefix: q.Get("prefix"), kind: q.Get("kind")}
+		if f.kind != "" && f.kind != metric.GaugeMetricType && f.kind != metric.CounterMetricType {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid kind"))
+			return
+		}
+		if _, err := path.Match(f.glob, ""); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("invalid filter"))
+			return
+		}
+		for _, l := range q["label"] {
+			name, value, ok := strings.Cut(l, "=")
+			if !ok || name == "" {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("invalid label, expected name=value"))
+				return
+			}
+			if f.labels == nil {
+				f.labels = make(map[string]string)
+			}
+			f.labels[name] = value
+		}
+
+		interval := opts.Throttle
+		if v := q.Get("interval"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("invalid interval"))
+				return
+			}
+			interval = max(interval, d)
+		}
+
+		if websocket.IsWebSocketUpgrade(r) {
+			streamWebSocket(rw, r, s, f, interval, opts)
+		} else {
+			streamSSE(rw, r, s, f, interval, opts)
+		}
+	}
+}
+
+func streamSSE(rw http.ResponseWriter, r *http.Request, s Subscriber, f *streamFilter, interval time.Duration, opts StreamOptions) {
+	rc := http.NewResponseController(rw)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Error("stream is not supported by the response writer", "err", err)
+		return
+	}
+
+	send := func(events []streamEvent) error {
+		for _, ev := range events {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(rw, "event: update\ndata: %s\n\n", data); err != nil {
+				return err
+			}
+		}
+		return rc.Flush()
+	}
+	beat := func() error {
+		if _, err := rw.Write([]byte(": heartbeat\n\n")); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	err := runStream(r.Context(), s, f, interval, opts, send, beat)
+	if errors.Is(err, storage.ErrSlowSubscriber) {
+		fmt.Fprintf(rw, "event: error\ndata: %s\n\n", err)
+		rc.Flush()
+	}
+}
+
+func streamWebSocket(rw http.ResponseWriter, r *http.Request, s Subscriber, f *streamFilter, interval time.Duration, opts StreamOptions) {
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		slog.Debug("upgrade stream", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// clients only send control frames, reading processes them and notices the close
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(events []streamEvent) error {
+		for _, ev := range events {
+			if err := conn.WriteJSON(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	beat := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+	}
+
+	code, reason := websocket.CloseNormalClosure, ""
+	err = runStream(ctx, s, f, interval, opts, send, beat)
+	if errors.Is(err, storage.ErrSlowSubscriber) {
+		code, reason = websocket.CloseTryAgainLater, err.Error()
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
+
+// runStream passes matching updates to send until the client goes away, the server stops
+// or the subscription is dropped for falling behind
+func runStream(
+	ctx context.Context,
+	s Subscriber,
+	f *streamFilter,
+	interval time.Duration,
+	opts StreamOptions,
+	send func([]streamEvent) error,
+	beat func() error,
+) error {
+	sub := s.Subscribe(streamBufferSize)
+	defer sub.Close()
+
+	var flush, heartbeat <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		flush = t.C
+	}
+	if opts.Heartbeat > 0 {
+		t := time.NewTicker(opts.Heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+
+	// pending keeps the latest update of every metric until the next flush, in order of arrival
+	pending := make(map[storage.Key]int)
+	var events []streamEvent
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-opts.Done:
+			return nil
+		case u, ok := <-sub.C():
+			if !ok {
+				slog.Warn("Stream client dropped", "err", sub.Err())
+				return sub.Err()
+			}
+			if !f.match(u) || !auth.AllowsName(ctx, u.ID) {
+				continue
+			}
+
+			ev := toStreamEvent(u)
+			if flush == nil {
+				if err := send([]streamEvent{ev}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			key := storage.Key{Kind: u.Kind, ID: u.ID}
+			if i, ok := pending[key]; ok {
+				events[i] = ev
+			} else {
+				pending[key] = len(events)
+				events = append(events, ev)
+			}
+		case <-flush:
+			if len(events) == 0 {
+				continue
+			}
+			if err := send(events); err != nil {
+				return err
+			}
+			clear(pending)
+			events = events[:0]
+		case <-heartbeat:
+			if err := beat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toStreamEvent(u storage.Update) streamEvent {
+	ev := streamEvent{
+		ID:      u.ID,
+		MType:   u.Kind,
+		Labels:  u.Labels,
+		Deleted: u.Deleted,
+		Time:    u.Time,
+	}
+	if u.Deleted {
+		return ev
+	}
+
+	switch u.Kind {
+	case metric.GaugeMetricType:
+		ev.Value = &u.Value
+	case metric.CounterMetricType:
+		ev.Delta = &u.Delta
+	}
+	return ev
+}
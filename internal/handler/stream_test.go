@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestStreamHandler_SSE(t *testing.T) {
+	s := storage.NewMemStorage()
+	done := make(chan struct{})
+	srv := httptest.NewServer(StreamHandler(s, StreamOptions{Heartbeat: 20 * time.Millisecond, Done: done}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?prefix=cpu&kind=gauge")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	// the subscription starts with the request, wait for the first heartbeat
+	require.Equal(t, ": heartbeat", <-lines)
+
+	s.UpdateGauge("memory", 1)
+	s.UpdateCounter("cpu_total", 1)
+	s.UpdateGauge("cpu", 0.5)
+
+	var data string
+	for line := range lines {
+		if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+			break
+		}
+	}
+
+	var ev streamEvent
+	require.NoError(t, json.Unmarshal([]byte(data), &ev))
+	assert.Equal(t, "cpu", ev.ID)
+	assert.Equal(t, "gauge", ev.MType)
+	require.NotNil(t, ev.Value)
+	assert.Equal(t, 0.5, *ev.Value)
+
+	// closing done ends the stream
+	close(done)
+	for range lines {
+	}
+}
+
+func TestStreamHandler_WebSocket(t *testing.T) {
+	s := storage.NewMemStorage()
+	srv := httptest.NewServer(StreamHandler(s, StreamOptions{Throttle: 50 * time.Millisecond}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?filter=req*", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the subscription starts after the handshake, so updates are repeated until one arrives
+	var ev streamEvent
+	require.Eventually(t, func() bool {
+		s.UpdateGauge("ignored", 1)
+		s.UpdateCounter("requests", 1)
+
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		return conn.ReadJSON(&ev) == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "requests", ev.ID)
+	assert.Equal(t, "counter", ev.MType)
+	require.NotNil(t, ev.Delta)
+}
+
+func TestRunStream_throttle(t *testing.T) {
+	s := storage.NewMemStorage()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sent := make(chan []streamEvent)
+	go runStream(ctx, s, &streamFilter{}, 50*time.Millisecond, StreamOptions{}, func(events []streamEvent) error {
+		select {
+		case sent <- append([]streamEvent(nil), events...):
+		case <-ctx.Done():
+		}
+		return nil
+	}, nil)
+
+	// updates of a metric within an interval are coalesced into its latest value
+	var events []streamEvent
+	require.Eventually(t, func() bool {
+		for i := 0; i < 10; i++ {
+			s.UpdateGauge("load", float64(i))
+		}
+		select {
+		case events = <-sent:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "load", events[0].ID)
+}
+
+func TestStreamHandler_invalid(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	for _, query := range []string{"?kind=histogram", "?filter=[", "?label=env", "?interval=soon"} {
+		w := httptest.NewRecorder()
+		StreamHandler(s, StreamOptions{})(w, httptest.NewRequest(http.MethodGet, "/stream"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
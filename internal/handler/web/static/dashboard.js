@@ -0,0 +1,325 @@
+// Dashboard of isaac: live values from /stream, sparklines and charts from /history.
+// History is kept in the database only, without it charts show the values seen live.
+(function () {
+  "use strict";
+
+  const sparkPoints = 60;
+
+  function key(type, name) {
+    return type + "\u0000" + name;
+  }
+
+  function historyURL(type, name, from) {
+    return "/history/" + type + "/" + encodeURIComponent(name) + "?from=" + from.toISOString();
+  }
+
+  // fetchHistory resolves to the points of the metric since from, or null without history
+  function fetchHistory(type, name, from) {
+    return fetch(historyURL(type, name, from), { credentials: "same-origin" })
+      .then(function (res) {
+        return res.ok ? res.json() : null;
+      })
+      .then(function (samples) {
+        if (!samples) {
+          return null;
+        }
+        return samples.map(function (s) {
+          return { t: new Date(s.ts), v: s.value !== undefined ? s.value : s.delta };
+        });
+      })
+      .catch(function () {
+        return null;
+      });
+  }
+
+  function valueOf(ev) {
+    return ev.type === "gauge" ? ev.value : ev.delta;
+  }
+
+  function formatTime(t) {
+    return t.toLocaleTimeString();
+  }
+
+  // scale maps the points onto a box of width by height, leaving pad around
+  function scale(points, width, height, pad) {
+    const t0 = points[0].t.getTime();
+    const t1 = points[points.length - 1].t.getTime();
+    let min = Infinity;
+    let max = -Infinity;
+    points.forEach(function (p) {
+      min = Math.min(min, p.v);
+      max = Math.max(max, p.v);
+    });
+    const dt = t1 - t0 || 1;
+    const dv = max - min || 1;
+
+    return {
+      min: min,
+      max: max,
+      x: function (p) {
+        return pad + ((p.t.getTime() - t0) / dt) * (width - 2 * pad);
+      },
+      y: function (p) {
+        return height - pad - ((p.v - min) / dv) * (height - 2 * pad);
+      },
+    };
+  }
+
+  function linePath(points, s) {
+    return points
+      .map(function (p, i) {
+        return (i === 0 ? "M" : "L") + s.x(p).toFixed(1) + "," + s.y(p).toFixed(1);
+      })
+      .join(" ");
+  }
+
+  function svgElement(name, attrs) {
+    const el = document.createElementNS("http://www.w3.org/2000/svg", name);
+    Object.keys(attrs).forEach(function (k) {
+      el.setAttribute(k, attrs[k]);
+    });
+    return el;
+  }
+
+  function drawSparkline(svg, points) {
+    svg.replaceChildren();
+    if (points.length < 2) {
+      return;
+    }
+    svg.appendChild(svgElement("path", { d: linePath(points, scale(points, 120, 24, 2)) }));
+  }
+
+  function drawChart(svg, points) {
+    svg.replaceChildren();
+    if (points.length < 2) {
+      return;
+    }
+
+    const width = 800;
+    const height = 240;
+    const s = scale(points, width, height, 30);
+
+    svg.appendChild(svgElement("line", { x1: 30, y1: height - 30, x2: width - 30, y2: height - 30 }));
+    svg.appendChild(svgElement("path", { d: linePath(points, s) }));
+
+    const labels = [
+      { x: 2, y: 34, text: String(s.max) },
+      { x: 2, y: height - 34, text: String(s.min) },
+      { x: 30, y: height - 10, text: formatTime(points[0].t) },
+      { x: width - 90, y: height - 10, text: formatTime(points[points.length - 1].t) },
+    ];
+    labels.forEach(function (l) {
+      const text = svgElement("text", { x: l.x, y: l.y });
+      text.textContent = l.text;
+      svg.appendChild(text);
+    });
+  }
+
+  function flash(el) {
+    el.classList.remove("changed");
+    void el.offsetWidth;
+    el.classList.add("changed");
+  }
+
+  function setUpdated(cell, t) {
+    const time = document.createElement("time");
+    time.dateTime = t.toISOString();
+    time.textContent = formatTime(t);
+    cell.replaceChildren(time);
+  }
+
+  // stream follows /stream with the query, EventSource reconnects by itself. Without
+  // EventSource support it returns null.
+  function stream(query, onUpdate) {
+    if (!window.EventSource) {
+      return null;
+    }
+    const source = new EventSource("/stream" + query);
+    source.addEventListener("update", function (e) {
+      onUpdate(JSON.parse(e.data));
+    });
+    return source;
+  }
+
+  // globEscape quotes the characters the stream filter treats as patterns
+  function globEscape(s) {
+    return s.replace(/[\\*?[]/g, "\\$&");
+  }
+
+  function initIndex(table) {
+    const rows = new Map();
+    table.querySelectorAll("tbody tr[data-name]").forEach(function (tr) {
+      rows.set(key(tr.dataset.type, tr.dataset.name), {
+        tr: tr,
+        spark: tr.querySelector("svg.spark"),
+        points: [],
+        loaded: false,
+      });
+    });
+
+    // History is requested for visible rows only, the first miss means there is none
+    let history = true;
+    const observer = window.IntersectionObserver
+      ? new IntersectionObserver(function (entries) {
+          entries.forEach(function (entry) {
+            if (!entry.isIntersecting) {
+              return;
+            }
+            observer.unobserve(entry.target);
+            const row = rows.get(key(entry.target.dataset.type, entry.target.dataset.name));
+            if (!history || row.loaded) {
+              return;
+            }
+            row.loaded = true;
+            const from = new Date(Date.now() - 3600 * 1000);
+            fetchHistory(entry.target.dataset.type, entry.target.dataset.name, from).then(function (points) {
+              if (points === null) {
+                history = false;
+                return;
+              }
+              row.points = points.concat(row.points).slice(-sparkPoints);
+              drawSparkline(row.spark, row.points);
+            });
+          });
+        })
+      : null;
+    if (observer) {
+      rows.forEach(function (row) {
+        observer.observe(row.tr);
+      });
+    }
+
+    const notice = document.getElementById("notice");
+    function onUpdate(ev) {
+      const row = rows.get(key(ev.type, ev.id));
+      if (!row) {
+        if (!ev.deleted) {
+          notice.hidden = false;
+        }
+        return;
+      }
+      if (ev.deleted) {
+        row.tr.classList.add("deleted");
+        return;
+      }
+
+      row.tr.classList.remove("deleted");
+      const t = new Date(ev.ts);
+      const v = valueOf(ev);
+      row.tr.querySelector(".value").textContent = String(v);
+      setUpdated(row.tr.querySelector(".updated"), t);
+      flash(row.tr);
+
+      row.points.push({ t: t, v: v });
+      row.points = row.points.slice(-sparkPoints);
+      drawSparkline(row.spark, row.points);
+    }
+
+    // Without EventSource the page reloads itself instead
+    const live = document.getElementById("live");
+    let source = null;
+    let reload = null;
+    function follow() {
+      if (source) {
+        source.close();
+        source = null;
+      }
+      clearTimeout(reload);
+      if (!live.checked) {
+        return;
+      }
+      source = stream("", onUpdate);
+      if (!source) {
+        reload = setTimeout(function () {
+          location.reload();
+        }, 10000);
+      }
+    }
+    live.addEventListener("change", follow);
+    follow();
+
+    // Typing narrows the rows at once, submitting searches on the server
+    const search = document.querySelector(".search input[type=search]");
+    const shown = document.getElementById("shown");
+    search.addEventListener("input", function () {
+      const q = search.value.trim().toLowerCase();
+      let n = 0;
+      rows.forEach(function (row) {
+        const text = (row.tr.dataset.name + " " + row.tr.querySelector(".labels").textContent).toLowerCase();
+        row.tr.hidden = q !== "" && text.indexOf(q) < 0;
+        if (!row.tr.hidden) {
+          n++;
+        }
+      });
+      shown.textContent = String(n);
+    });
+  }
+
+  function initMetric(details) {
+    const type = details.dataset.type;
+    const name = details.dataset.name;
+    const chart = document.getElementById("chart");
+    const note = document.getElementById("chart-note");
+
+    let range = 3600 * 1000;
+    let points = [];
+
+    function trim() {
+      const from = Date.now() - range;
+      points = points.filter(function (p) {
+        return p.t.getTime() >= from;
+      });
+    }
+
+    function load() {
+      fetchHistory(type, name, new Date(Date.now() - range)).then(function (history) {
+        if (history === null) {
+          note.textContent = "History is not kept, the chart shows the values received while the page is open.";
+        } else {
+          note.textContent = history.length === 0 ? "No history in this range." : "";
+          points = history;
+        }
+        trim();
+        drawChart(chart, points);
+      });
+    }
+
+    document.querySelectorAll(".ranges button").forEach(function (button) {
+      button.addEventListener("click", function () {
+        document.querySelectorAll(".ranges button").forEach(function (b) {
+          b.classList.toggle("active", b === button);
+        });
+        range = parseInt(button.dataset.range, 10) * 3600 * 1000;
+        load();
+      });
+    });
+    load();
+
+    const query = "?kind=" + encodeURIComponent(type) + "&filter=" + encodeURIComponent(globEscape(name));
+    stream(query, function (ev) {
+      const value = details.querySelector(".value");
+      if (ev.deleted) {
+        value.textContent = "deleted";
+        return;
+      }
+      const t = new Date(ev.ts);
+      const v = valueOf(ev);
+      value.textContent = String(v);
+      setUpdated(details.querySelector(".updated"), t);
+      flash(value);
+
+      points.push({ t: t, v: v });
+      trim();
+      drawChart(chart, points);
+    });
+  }
+
+  const table = document.getElementById("metrics");
+  if (table) {
+    initIndex(table);
+  }
+  const details = document.getElementById("metric");
+  if (details) {
+    initMetric(details);
+  }
+})();
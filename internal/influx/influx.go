@@ -0,0 +1,242 @@
+// Package influx parses the InfluxDB line protocol and maps it onto isaac metrics
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+// Point is one line of the line protocol. String fields are kept apart because they
+// cannot be stored as metrics.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	Strings     map[string]string
+	// Timestamp is zero when the line has none
+	Timestamp int64
+}
+
+// Stats counts the fields of a write
+type Stats struct {
+	Fields  int
+	Skipped int
+}
+
+// ParseLine parses measurement[,tag=value...] field=value[,field=value...] [timestamp].
+// Integers and unsigned integers are read as floats, booleans as 1 and 0.
+func ParseLine(line string) (Point, error) {
+	var p Point
+
+	measurement, i := scan(line, 0, ", ")
+	if measurement == "" {
+		return Point{}, errors.Errorf("[influx.ParseLine] missing measurement in %q", line)
+	}
+	p.Measurement = measurement
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = scan(line, i+1, ",= ")
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return Point{}, errors.Errorf("[influx.ParseLine] invalid tag in %q", line)
+		}
+		value, i = scan(line, i+1, ", ")
+		if value == "" {
+			return Point{}, errors.Errorf("[influx.ParseLine] missing value of tag %s in %q", key, line)
+		}
+		if p.Tags == nil {
+			p.Tags = make(map[string]string)
+		}
+		p.Tags[key] = value
+	}
+
+	if i >= len(line) || line[i] != ' ' {
+		return Point{}, errors.Errorf("[influx.ParseLine] missing fields in %q", line)
+	}
+	i = skipSpaces(line, i)
+
+	for {
+		var key string
+		key, i = scan(line, i, ",= ")
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return Point{}, errors.Errorf("[influx.ParseLine] invalid field in %q", line)
+		}
+		i++
+
+		if i < len(line) && line[i] == '"' {
+			var s string
+			var err error
+			s, i, err = scanString(line, i)
+			if err != nil {
+				return Point{}, errors.Wrapf(err, "[influx.ParseLine] field %s in %q", key, line)
+			}
+			if p.Strings == nil {
+				p.Strings = make(map[string]string)
+			}
+			p.Strings[key] = s
+		} else {
+			var raw string
+			raw, i = scan(line, i, ", ")
+			v, err := parseValue(raw)
+			if err != nil {
+				return Point{}, errors.Wrapf(err, "[influx.ParseLine] field %s in %q", key, line)
+			}
+			if p.Fields == nil {
+				p.Fields = make(map[string]float64)
+			}
+			p.Fields[key] = v
+		}
+
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+		i++
+	}
+
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		ts, err := strconv.ParseInt(strings.TrimSpace(line[i:]), 10, 64)
+		if err != nil {
+			return Point{}, errors.Errorf("[influx.ParseLine] invalid timestamp %q", line[i:])
+		}
+		p.Timestamp = ts
+	}
+
+	return p, nil
+}
+
+// Parse parses the lines of a write body, skipping empty lines and comments. Lines that
+// fail to parse are reported and do not stop the others.
+func Parse(body []byte) ([]Point, []error) {
+	var (
+		points []Point
+		errs   []error
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		points = append(points, p)
+	}
+
+	return points, errs
+}
+
+// Map applies the rules to every numeric field. String fields and NaN values are skipped.
+func Map(rules *ingest.Rules, points []Point) ([]ingest.Series, Stats) {
+	var (
+		res   []ingest.Series
+		stats Stats
+	)
+
+	for _, p := range points {
+		stats.Skipped += len(p.Strings)
+		for field, v := range p.Fields {
+			if math.IsNaN(v) {
+				stats.Skipped++
+				continue
+			}
+			s, ok := rules.MapInflux(p.Measurement, field, p.Tags, v)
+			if !ok {
+				stats.Skipped++
+				continue
+			}
+			res = append(res, s)
+			stats.Fields++
+		}
+	}
+
+	return res, stats
+}
+
+// scan reads from i up to the first unescaped stop byte and returns the unescaped token
+func scan(line string, i int, stops string) (string, int) {
+	var b strings.Builder
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && (strings.IndexByte(stops, line[i+1]) >= 0 || line[i+1] == '\\') {
+			i++
+			b.WriteByte(line[i])
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), i
+}
+
+// scanString reads a double quoted field value starting at i
+func scanString(line string, i int) (string, int, error) {
+	var b strings.Builder
+	for i++; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+			i++
+			b.WriteByte(line[i])
+			continue
+		}
+		if c == '"' {
+			return b.String(), i + 1, nil
+		}
+		b.WriteByte(c)
+	}
+	return "", i, errors.New("unterminated string")
+}
+
+func skipSpaces(line string, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+func parseValue(raw string) (float64, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+
+	switch {
+	case raw == "":
+		return 0, errors.New("missing value")
+	case strings.HasSuffix(raw, "i"):
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid integer %q", raw)
+		}
+		return float64(v), nil
+	case strings.HasSuffix(raw, "u"):
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid unsigned integer %q", raw)
+		}
+		return float64(v), nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid float %q", raw)
+	}
+	return v, nil
+}
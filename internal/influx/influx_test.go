@@ -0,0 +1,85 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Point
+	}{
+		{
+			line: "cpu usage=12.5",
+			want: Point{Measurement: "cpu", Fields: map[string]float64{"usage": 12.5}},
+		},
+		{
+			line: `cpu,host=web1,region=eu\ west usage_idle=90,cores=8i,online=true 1700000000000000000`,
+			want: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "web1", "region": "eu west"},
+				Fields:      map[string]float64{"usage_idle": 90, "cores": 8, "online": 1},
+				Timestamp:   1700000000000000000,
+			},
+		},
+		{
+			line: `disk\,io,path=C:\\ reads=3u,msg="hello, \"world\"" 1`,
+			want: Point{
+				Measurement: "disk,io",
+				Tags:        map[string]string{"path": `C:\`},
+				Fields:      map[string]float64{"reads": 3},
+				Strings:     map[string]string{"msg": `hello, "world"`},
+				Timestamp:   1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, line := range []string{
+		"cpu",
+		"cpu,host usage=1",
+		"cpu,host= usage=1",
+		"cpu usage",
+		"cpu usage=",
+		"cpu usage=abc",
+		`cpu msg="open`,
+		"cpu usage=1 now",
+		",host=a usage=1",
+	} {
+		_, err := ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParse(t *testing.T) {
+	points, errs := Parse([]byte("# comment\ncpu usage=1\n\ninvalid\nmem used=2i\n"))
+	assert.Len(t, points, 2)
+	assert.Len(t, errs, 1)
+}
+
+func TestMap(t *testing.T) {
+	rules := &ingest.Rules{Influx: []ingest.Rule{{Measurement: "http", Field: "requests", Name: "http_requests_total", Type: "counter"}}}
+
+	series, stats := Map(rules, []Point{
+		{Measurement: "http", Tags: map[string]string{"host": "a"}, Fields: map[string]float64{"requests": 5}, Strings: map[string]string{"status": "ok"}},
+	})
+	assert.Equal(t, []ingest.Series{{
+		Kind:   "counter",
+		ID:     `http_requests_total{host="a"}`,
+		Labels: map[string]string{"host": "a"},
+		Value:  5,
+	}}, series)
+	assert.Equal(t, Stats{Fields: 1, Skipped: 1}, stats)
+}
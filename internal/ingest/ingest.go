@@ -0,0 +1,125 @@
+// Package ingest applies series received in foreign protocols to the storage
+package ingest
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/sshirox/isaac/internal/audit"
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+// Repository is the storage series are written to
+type Repository interface {
+	audit.Repository
+	SetLabels(kind, id string, labels map[string]string)
+	ReceiveLabels(kind, id string) map[string]string
+}
+
+// Series is one received series mapped onto an isaac metric
+type Series struct {
+	Kind   string
+	ID     string
+	Labels map[string]string
+	Value  float64
+	// Delta marks a value relative to the stored one instead of a cumulative total or a current value
+	Delta bool
+}
+
+// Writer applies series to the storage. One writer is shared by all ingest paths so the
+// read-modify-write of a series is serialized between them.
+type Writer struct {
+	repo Repository
+	// mu makes reading a metric and writing its new value atomic between requests
+	mu sync.Mutex
+	// last is the latest cumulative total received for a counter, the stored isaac total
+	// drifts from it once the source resets
+	last map[string]float64
+	// fraction is the part of a counter increase not added yet, isaac counters are integers
+	fraction map[string]float64
+}
+
+func NewWriter(repo Repository) *Writer {
+	return &Writer{
+		repo:     repo,
+		last:     make(map[string]float64),
+		fraction: make(map[string]float64),
+	}
+}
+
+// Write stores the series. A gauge takes the value, or adds it when it is a delta. isaac
+// counters add deltas, for a cumulative counter the increase since the previous total is
+// added; a total below the previous one is a counter reset and is added as a whole. The
+// first total of a counter already stored, e.g. after a restart, adds its increase over
+// the stored value. The whole part of a counter increase is added, the fraction is carried
+// over to the next series of the counter, so fractional values are not lost over time.
+func (w *Writer) Write(ctx context.Context, series []Series) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, s := range series {
+		// labels are set first, so subscribers get them with the first update
+		if len(s.Labels) > 0 && w.repo.ReceiveLabels(s.Kind, s.ID) == nil {
+			w.repo.SetLabels(s.Kind, s.ID, s.Labels)
+		}
+
+		switch s.Kind {
+		case metric.GaugeMetricType:
+			value := s.Value
+			if s.Delta {
+				old, _ := w.repo.ReceiveGauge(s.ID)
+				value += old
+			}
+			audit.UpdateGauge(ctx, w.repo, s.ID, value)
+		case metric.CounterMetricType:
+			inc := s.Value
+			_, ok := w.repo.ReceiveCounter(s.ID)
+			if !s.Delta {
+				inc = w.increase(s.ID, inc)
+			}
+			delta := w.whole(s.ID, inc)
+			if !ok || delta != 0 {
+				audit.UpdateCounter(ctx, w.repo, s.ID, delta)
+			}
+		}
+	}
+}
+
+// whole adds inc to the fraction carried for the counter and returns the whole part of it
+func (w *Writer) whole(id string, inc float64) int64 {
+	sum := inc + w.fraction[id]
+	delta := math.Trunc(sum)
+
+	if rest := sum - delta; rest != 0 {
+		w.fraction[id] = rest
+	} else {
+		delete(w.fraction, id)
+	}
+
+	return int64(delta)
+}
+
+// increase returns what the cumulative total adds to the counter and remembers the total
+func (w *Writer) increase(id string, total float64) float64 {
+	last, seen := w.last[id]
+	w.last[id] = total
+
+	if !seen {
+		stored, ok := w.repo.ReceiveCounter(id)
+		switch {
+		case !ok:
+			return total
+		case total >= float64(stored):
+			return total - float64(stored)
+		default:
+			// the source was reset while it was not watched, the total is the new baseline
+			return 0
+		}
+	}
+
+	if total < last {
+		return total
+	}
+	return total - last
+}
@@ -0,0 +1,67 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestWriter_Write(t *testing.T) {
+	ctx := context.Background()
+	ms := storage.NewMemStorage()
+	w := NewWriter(ms)
+	labels := map[string]string{"job": "api"}
+
+	w.Write(ctx, []Series{
+		{Kind: "counter", ID: "requests_total", Value: 10, Labels: labels},
+		{Kind: "gauge", ID: "temperature", Value: 21.5},
+	})
+	w.Write(ctx, []Series{{Kind: "counter", ID: "requests_total", Value: 15}})
+
+	val, _ := ms.ReceiveCounter("requests_total")
+	assert.Equal(t, int64(15), val)
+	assert.Equal(t, labels, ms.ReceiveLabels("counter", "requests_total"))
+
+	// the source restarted, the counter keeps growing by the new value
+	w.Write(ctx, []Series{{Kind: "counter", ID: "requests_total", Value: 4}})
+	val, _ = ms.ReceiveCounter("requests_total")
+	assert.Equal(t, int64(19), val)
+
+	// after the reset the increase is taken from the last total, not the stored one
+	w.Write(ctx, []Series{{Kind: "counter", ID: "requests_total", Value: 6}})
+	w.Write(ctx, []Series{{Kind: "counter", ID: "requests_total", Value: 8}})
+	val, _ = ms.ReceiveCounter("requests_total")
+	assert.Equal(t, int64(23), val)
+
+	w.Write(ctx, []Series{
+		{Kind: "counter", ID: "requests_total", Value: 2, Delta: true},
+		{Kind: "gauge", ID: "temperature", Value: -1.5, Delta: true},
+	})
+	val, _ = ms.ReceiveCounter("requests_total")
+	assert.Equal(t, int64(25), val)
+	gauge, _ := ms.ReceiveGauge("temperature")
+	assert.Equal(t, 20.0, gauge)
+}
+
+func TestWriter_WriteFractionalCounters(t *testing.T) {
+	ctx := context.Background()
+	ms := storage.NewMemStorage()
+	w := NewWriter(ms)
+
+	// the fraction of every increase is carried over instead of being dropped
+	for _, total := range []float64{0.4, 0.8, 1.2, 1.6, 2.0} {
+		w.Write(ctx, []Series{{Kind: "counter", ID: "cpu_seconds_total", Value: total}})
+	}
+	val, _ := ms.ReceiveCounter("cpu_seconds_total")
+	assert.Equal(t, int64(2), val)
+
+	for i := 0; i < 10; i++ {
+		w.Write(ctx, []Series{{Kind: "counter", ID: "bytes", Value: 0.25, Delta: true}})
+	}
+	val, ok := ms.ReceiveCounter("bytes")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), val)
+}
@@ -0,0 +1,228 @@
+package ingest
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/expfmt"
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+// Rule maps a Graphite path or an InfluxDB measurement field onto an isaac metric. Name
+// and label values are templates: {1}, {2}... are the wildcard segments of a Graphite
+// path and {0} the whole path, {measurement}, {field} and the tag names are the parts
+// of an InfluxDB point.
+type Rule struct {
+	// Match is a dot separated Graphite path pattern, a segment with wildcards matches one
+	// path segment, a trailing ** matches the rest of the path
+	Match string `json:"match"`
+	// Measurement and Field are InfluxDB glob patterns, empty patterns match anything
+	Measurement string `json:"measurement"`
+	Field       string `json:"field"`
+
+	Name string `json:"name"`
+	// Type is gauge or counter, counters are cumulative totals
+	Type       string            `json:"type"`
+	Labels     map[string]string `json:"labels"`
+	DropLabels []string          `json:"drop_labels"`
+	// Drop discards matching series
+	Drop bool `json:"drop"`
+}
+
+// Rules are applied in order, the first matching rule wins
+type Rules struct {
+	Graphite []Rule `json:"graphite"`
+	Influx   []Rule `json:"influx"`
+}
+
+// LoadRules reads the rules from a JSON file
+func LoadRules(filename string) (*Rules, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "[ingest.LoadRules] read rules")
+	}
+
+	var r Rules
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, errors.Wrap(err, "[ingest.LoadRules] decode rules")
+	}
+
+	for i, rule := range r.Graphite {
+		if rule.Match == "" {
+			return nil, errors.Errorf("[ingest.LoadRules] graphite rule %d has no match", i)
+		}
+		for _, seg := range strings.Split(rule.Match, ".") {
+			if _, err = path.Match(seg, ""); err != nil {
+				return nil, errors.Wrapf(err, "[ingest.LoadRules] graphite rule %d", i)
+			}
+		}
+		if err = rule.validate(); err != nil {
+			return nil, errors.Wrapf(err, "[ingest.LoadRules] graphite rule %d", i)
+		}
+	}
+
+	for i, rule := range r.Influx {
+		for _, pattern := range []string{rule.Measurement, rule.Field} {
+			if _, err = path.Match(pattern, ""); err != nil {
+				return nil, errors.Wrapf(err, "[ingest.LoadRules] influx rule %d", i)
+			}
+		}
+		if err = rule.validate(); err != nil {
+			return nil, errors.Wrapf(err, "[ingest.LoadRules] influx rule %d", i)
+		}
+	}
+
+	return &r, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Drop {
+		return nil
+	}
+	switch r.Type {
+	case "", metric.GaugeMetricType, metric.CounterMetricType:
+	default:
+		return errors.Errorf("unknown type %q", r.Type)
+	}
+	return nil
+}
+
+// MapGraphite maps a Graphite path with the tags of a tagged series. Without a matching rule
+// the path is the name of a gauge.
+func (r *Rules) MapGraphite(p string, tags map[string]string, value float64) (Series, bool) {
+	segments := strings.Split(p, ".")
+
+	if r != nil {
+		for i := range r.Graphite {
+			rule := &r.Graphite[i]
+			captures, ok := matchPath(rule.Match, segments)
+			if !ok {
+				continue
+			}
+
+			vars := make(map[string]string, len(captures)+1)
+			vars["0"] = p
+			for j, c := range captures {
+				vars[strconv.Itoa(j+1)] = c
+			}
+			return rule.apply(p, vars, tags, value)
+		}
+	}
+
+	return series(metric.GaugeMetricType, p, tags, value), true
+}
+
+// MapInflux maps a field of an InfluxDB point. Without a matching rule the name is
+// measurement_field, or the measurement for a field called value, of a gauge.
+func (r *Rules) MapInflux(measurement, field string, tags map[string]string, value float64) (Series, bool) {
+	name := measurement + "_" + field
+	if field == "value" {
+		name = measurement
+	}
+
+	if r != nil {
+		for i := range r.Influx {
+			rule := &r.Influx[i]
+			if !matchGlob(rule.Measurement, measurement) || !matchGlob(rule.Field, field) {
+				continue
+			}
+
+			vars := make(map[string]string, len(tags)+2)
+			for k, v := range tags {
+				vars[k] = v
+			}
+			vars["measurement"] = measurement
+			vars["field"] = field
+			return rule.apply(name, vars, tags, value)
+		}
+	}
+
+	return series(metric.GaugeMetricType, name, tags, value), true
+}
+
+func (r *Rule) apply(name string, vars, tags map[string]string, value float64) (Series, bool) {
+	if r.Drop {
+		return Series{}, false
+	}
+
+	if r.Name != "" {
+		name = expand(r.Name, vars)
+	}
+	kind := r.Type
+	if kind == "" {
+		kind = metric.GaugeMetricType
+	}
+
+	labels := make(map[string]string, len(tags)+len(r.Labels))
+	for k, v := range tags {
+		labels[k] = v
+	}
+	for _, k := range r.DropLabels {
+		delete(labels, k)
+	}
+	for k, tmpl := range r.Labels {
+		if v := expand(tmpl, vars); v != "" {
+			labels[k] = v
+		} else {
+			delete(labels, k)
+		}
+	}
+
+	return series(kind, name, labels, value), true
+}
+
+func series(kind, name string, labels map[string]string, value float64) Series {
+	if len(labels) == 0 {
+		labels = nil
+	}
+	return Series{Kind: kind, ID: expfmt.SeriesID(name, labels), Labels: labels, Value: value}
+}
+
+// matchPath matches the path segments against the pattern and returns the segments
+// matched by wildcards
+func matchPath(pattern string, segments []string) ([]string, bool) {
+	var captures []string
+
+	parts := strings.Split(pattern, ".")
+	for i, part := range parts {
+		if part == "**" && i == len(parts)-1 {
+			if len(segments) <= i {
+				return nil, false
+			}
+			return append(captures, strings.Join(segments[i:], ".")), true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if ok, _ := path.Match(part, segments[i]); !ok {
+			return nil, false
+		}
+		if strings.ContainsAny(part, "*?[") {
+			captures = append(captures, segments[i])
+		}
+	}
+
+	return captures, len(parts) == len(segments)
+}
+
+func matchGlob(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+var templateVar = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func expand(tmpl string, vars map[string]string) string {
+	return templateVar.ReplaceAllStringFunc(tmpl, func(v string) string {
+		return vars[v[1:len(v)-1]]
+	})
+}
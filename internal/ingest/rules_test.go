@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "rules.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	rules, err := LoadRules(write(`{
+		"graphite": [{"match": "servers.*.cpu.*", "name": "cpu_{2}", "labels": {"host": "{1}"}}],
+		"influx": [{"measurement": "http", "field": "requests", "type": "counter"}]
+	}`))
+	require.NoError(t, err)
+	assert.Len(t, rules.Graphite, 1)
+	assert.Len(t, rules.Influx, 1)
+
+	_, err = LoadRules(write(`{"graphite": [{"name": "x"}]}`))
+	assert.Error(t, err)
+	_, err = LoadRules(write(`{"influx": [{"field": "[", "name": "x"}]}`))
+	assert.Error(t, err)
+	_, err = LoadRules(write(`{"influx": [{"type": "histogram"}]}`))
+	assert.Error(t, err)
+	_, err = LoadRules(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestRules_MapGraphite(t *testing.T) {
+	rules := &Rules{Graphite: []Rule{
+		{Match: "servers.*.cpu.*", Name: "cpu_{2}", Labels: map[string]string{"host": "{1}"}},
+		{Match: "stats.counters.**", Name: "{1}_total", Type: "counter"},
+		{Match: "carbon.**", Drop: true},
+	}}
+
+	tests := []struct {
+		path string
+		tags map[string]string
+		want Series
+		ok   bool
+	}{
+		{
+			path: "servers.web1.cpu.user",
+			want: Series{Kind: "gauge", ID: `cpu_user{host="web1"}`, Labels: map[string]string{"host": "web1"}, Value: 1},
+			ok:   true,
+		},
+		{
+			path: "stats.counters.api.requests",
+			want: Series{Kind: "counter", ID: "api.requests_total", Value: 1},
+			ok:   true,
+		},
+		{
+			path: "servers.web1.memory",
+			tags: map[string]string{"dc": "eu"},
+			want: Series{Kind: "gauge", ID: `servers.web1.memory{dc="eu"}`, Labels: map[string]string{"dc": "eu"}, Value: 1},
+			ok:   true,
+		},
+		{path: "carbon.agents.a.cpu"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := rules.MapGraphite(tt.path, tt.tags, 1)
+			assert.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+
+	got, ok := (*Rules)(nil).MapGraphite("a.b", nil, 2)
+	assert.True(t, ok)
+	assert.Equal(t, Series{Kind: "gauge", ID: "a.b", Value: 2}, got)
+}
+
+func TestRules_MapInflux(t *testing.T) {
+	rules := &Rules{Influx: []Rule{
+		{Measurement: "http", Field: "requests", Name: "http_requests_total", Type: "counter", DropLabels: []string{"path"}},
+		{Measurement: "cpu", Field: "usage_*", Name: "cpu_{field}", Labels: map[string]string{"core": "{cpu}", "cpu": ""}},
+		{Measurement: "debug", Drop: true},
+	}}
+
+	got, ok := rules.MapInflux("http", "requests", map[string]string{"host": "a", "path": "/"}, 7)
+	assert.True(t, ok)
+	assert.Equal(t, Series{Kind: "counter", ID: `http_requests_total{host="a"}`, Labels: map[string]string{"host": "a"}, Value: 7}, got)
+
+	got, ok = rules.MapInflux("cpu", "usage_idle", map[string]string{"cpu": "cpu0"}, 90)
+	assert.True(t, ok)
+	assert.Equal(t, Series{Kind: "gauge", ID: `cpu_usage_idle{core="cpu0"}`, Labels: map[string]string{"core": "cpu0"}, Value: 90}, got)
+
+	_, ok = rules.MapInflux("debug", "x", nil, 1)
+	assert.False(t, ok)
+
+	got, _ = rules.MapInflux("mem", "used", nil, 1)
+	assert.Equal(t, "mem_used", got.ID)
+	got, _ = rules.MapInflux("temperature", "value", nil, 1)
+	assert.Equal(t, "temperature", got.ID)
+}
@@ -28,6 +28,11 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
+// Unwrap lets http.ResponseController reach the flusher and hijacker of the wrapped writer
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 var Log = zap.NewNop()
 
 func Initialize(level string) error {
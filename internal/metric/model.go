@@ -1,8 +1,18 @@
 package metric
 
+import "time"
+
 type Metrics struct {
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Delta  *int64            `json:"delta,omitempty"`
+	Value  *float64          `json:"value,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Sample is a historical value of a metric
+type Sample struct {
+	Time  time.Time `json:"ts"`
+	Delta *int64    `json:"delta,omitempty"`
+	Value *float64  `json:"value,omitempty"`
 }
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/sshirox/isaac/internal/audit"
+	"github.com/sshirox/isaac/internal/auth"
+)
+
+// AuditMiddleware records mutations made by the request as action, auditing is disabled when l is nil.
+// It has to run after TokenAuth so the token is known.
+func AuditMiddleware(l *audit.Logger, action audit.Action, proxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor := audit.Actor{
+				Action:    action,
+				Transport: audit.TransportHTTP,
+				AgentID:   r.Header.Get(audit.AgentIDHeader),
+			}
+			if ip := ClientIP(r, proxies); ip != nil {
+				actor.Source = ip.String()
+			}
+			if t := auth.FromContext(r.Context()); t != nil {
+				actor.Token = t.ID
+			}
+
+			next.ServeHTTP(w, r.WithContext(l.NewContext(r.Context(), actor)))
+		})
+	}
+}
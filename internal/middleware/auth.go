@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/sshirox/isaac/internal/auth"
+)
+
+// TokenAuth requires a bearer token granting scope, authentication is disabled when authn is nil
+func TokenAuth(authn *auth.Authenticator, scope auth.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authn == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			t, err := authn.Authenticate(ctx, auth.BearerToken(r.Header.Get("Authorization")), scope)
+			switch {
+			case errors.Is(err, auth.ErrUnauthenticated):
+				slog.InfoContext(ctx, "token rejected", slog.String("uri", r.RequestURI))
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			case errors.Is(err, auth.ErrForbidden):
+				slog.InfoContext(ctx, "token scope is insufficient", slog.String("uri", r.RequestURI), slog.String("scope", string(scope)))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			case err != nil:
+				slog.ErrorContext(ctx, "authenticate token", slog.Any("error", err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithToken(ctx, t)))
+		})
+	}
+}
@@ -11,6 +11,9 @@ import (
 type compressWriter struct {
 	w  http.ResponseWriter
 	zw *gzip.Writer
+	// status is the code sent, compress is set for the ones with a body worth compressing
+	status   int
+	compress bool
 }
 
 func newCompressWriter(w http.ResponseWriter) *compressWriter {
@@ -27,17 +30,47 @@ func (c *compressWriter) Header() http.Header {
 }
 
 func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.compress {
+		return c.w.Write(p)
+	}
 	return c.zw.Write(p)
 }
 
+// WriteHeader compresses successful responses, except 204 that has no body
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode < http.StatusMultipleChoices {
-		c.w.Header().Set("Content-Encoding", "gzip")
+	if c.status == 0 {
+		c.status = statusCode
+		c.compress = statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices &&
+			statusCode != http.StatusNoContent
+		if c.compress {
+			c.w.Header().Set("Content-Encoding", "gzip")
+		}
 	}
 	c.w.WriteHeader(statusCode)
 }
 
+// Flush sends the data compressed so far, streaming responses rely on it
+func (c *compressWriter) Flush() {
+	if c.compress {
+		if err := c.zw.Flush(); err != nil {
+			return
+		}
+	}
+	http.NewResponseController(c.w).Flush()
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+// Close ends the compressed body, responses without one are left untouched
 func (c *compressWriter) Close() error {
+	if !c.compress {
+		return nil
+	}
 	return c.zw.Close()
 }
 
@@ -74,7 +107,8 @@ func GZipMiddleware(h http.Handler) http.Handler {
 		ow := w
 
 		acceptEncoding := r.Header.Get("Accept-Encoding")
-		supportsGzip := strings.Contains(acceptEncoding, "gzip")
+		// a connection upgraded to another protocol is not an HTTP response to compress
+		supportsGzip := strings.Contains(acceptEncoding, "gzip") && r.Header.Get("Upgrade") == ""
 		if supportsGzip {
 			cw := newCompressWriter(w)
 			ow = cw
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGZipMiddleware(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		body     string
+		wantGzip bool
+	}{
+		{name: "OK with body", status: http.StatusOK, body: "hello", wantGzip: true},
+		{name: "Implicit OK", body: "hello", wantGzip: true},
+		{name: "No content", status: http.StatusNoContent},
+		{name: "Not modified", status: http.StatusNotModified},
+		{name: "Bad request", status: http.StatusBadRequest, body: "invalid"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := GZipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				if tc.body != "" {
+					w.Write([]byte(tc.body))
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if !tc.wantGzip {
+				assert.Empty(t, w.Header().Get("Content-Encoding"))
+				assert.Equal(t, tc.body, w.Body.String())
+				return
+			}
+
+			assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+			zr, err := gzip.NewReader(w.Body)
+			require.NoError(t, err)
+			body, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.body, string(body))
+		})
+	}
+}
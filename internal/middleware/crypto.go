@@ -6,7 +6,6 @@ import (
 	"crypto/rsa"
 	"io"
 	"log/slog"
-	"net"
 	"net/http"
 
 	"github.com/sshirox/isaac/internal/crypto"
@@ -90,47 +89,46 @@ func (d *CryptoDecoder) Decode(next http.Handler) http.Handler {
 	})
 }
 
-// TrustedSubnetMiddleware verifies that the client's IP address is within the trusted subnet.
-func TrustedSubnetMiddleware(trustedSubnet string) (func(http.Handler) http.Handler, error) {
-	if trustedSubnet == "" {
-		return func(next http.Handler) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				next.ServeHTTP(w, r)
-			})
-		}, nil
-	}
+type SignatureVerifier struct {
+	verifier *crypto.KeyVerifier
+}
 
-	_, subnet, err := net.ParseCIDR(trustedSubnet)
-	if err != nil {
-		slog.Error("Failed to parse trusted subnet",
-			slog.String("subnet", trustedSubnet),
-			slog.Any("error", err),
-		)
-		return nil, err
+func NewSignatureVerifier(v *crypto.KeyVerifier) *SignatureVerifier {
+	return &SignatureVerifier{
+		verifier: v,
 	}
+}
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-
-			ipStr := r.Header.Get("X-Real-IP")
-			if ipStr == "" {
-				slog.WarnContext(ctx, "X-Real-IP header not found")
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
-			ip := net.ParseIP(ipStr)
-			if ip == nil || !subnet.Contains(ip) {
-				slog.WarnContext(ctx, "Invalid X-Real-IP header",
-					slog.String("IP", ipStr),
-					slog.String("subnet", trustedSubnet),
-				)
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
+// Verify checks the public key signature of the request body, requests pass as is when no key is configured.
+func (s *SignatureVerifier) Verify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.verifier == nil {
 			next.ServeHTTP(w, r)
-		})
-	}, nil
+			return
+		}
+
+		sign := r.Header.Get(crypto.SignatureHeader)
+		if len(sign) == 0 {
+			slog.Info("signature required")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("read request body", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = r.Body.Close()
+
+		if !s.verifier.Verify(body, sign) {
+			slog.Info("signature is invalid")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewBuffer(body))
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	inet "github.com/sshirox/isaac/internal/net"
+)
+
+// TrustedSubnetMiddleware verifies that the client's IP address is within one of the trusted subnets.
+// Both lists are comma separated CIDRs or addresses. X-Forwarded-For and X-Real-IP are only
+// honoured when the request comes from a trusted proxy, otherwise the peer address is used.
+func TrustedSubnetMiddleware(trustedSubnets, trustedProxies string) (func(http.Handler) http.Handler, error) {
+	if trustedSubnets == "" {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+
+	subnets, err := inet.ParseCIDRs(trustedSubnets)
+	if err != nil {
+		slog.Error("Failed to parse trusted subnet",
+			slog.String("subnet", trustedSubnets),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+
+	proxies, err := inet.ParseCIDRs(trustedProxies)
+	if err != nil {
+		slog.Error("Failed to parse trusted proxies",
+			slog.String("proxies", trustedProxies),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			ip := ClientIP(r, proxies)
+			if ip == nil || !inet.ContainsIP(subnets, ip) {
+				slog.WarnContext(ctx, "Client IP is not trusted",
+					slog.Any("IP", ip),
+					slog.String("remote", r.RemoteAddr),
+					slog.String("subnet", trustedSubnets),
+				)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// ClientIP resolves the address of the client. Forwarding headers are walked from the
+// nearest hop while hops belong to trusted proxies, the first untrusted hop is the client.
+func ClientIP(r *http.Request, proxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !inet.ContainsIP(proxies, ip) {
+		return ip
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				return ip
+			}
+			ip = hop
+			if !inet.ContainsIP(proxies, hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+
+	if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+		return real
+	}
+
+	return ip
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       int
+	}{
+		{
+			name:       "Trusted peer",
+			remoteAddr: "192.168.1.10:5000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "Trusted IPv6 peer",
+			remoteAddr: "[fd00::5]:5000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "Untrusted peer",
+			remoteAddr: "10.1.1.1:5000",
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "Spoofed header from untrusted peer",
+			remoteAddr: "10.1.1.1:5000",
+			headers:    map[string]string{"X-Real-IP": "192.168.1.10", "X-Forwarded-For": "192.168.1.10"},
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "Header from trusted proxy",
+			remoteAddr: "172.16.0.1:5000",
+			headers:    map[string]string{"X-Real-IP": "192.168.1.10"},
+			want:       http.StatusOK,
+		},
+		{
+			name:       "Forwarded chain from trusted proxy",
+			remoteAddr: "172.16.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "192.168.1.10, 172.16.0.2"},
+			want:       http.StatusOK,
+		},
+		{
+			name:       "Spoofed first hop behind trusted proxy",
+			remoteAddr: "172.16.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "192.168.1.10, 10.1.1.1"},
+			want:       http.StatusForbidden,
+		},
+	}
+
+	mw, err := TrustedSubnetMiddleware("192.168.1.0/24, fd00::/8", "172.16.0.0/16")
+	require.NoError(t, err)
+
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			request.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				request.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, request)
+
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+}
+
+func TestTrustedSubnetMiddleware_InvalidSubnet(t *testing.T) {
+	_, err := TrustedSubnetMiddleware("192.168.1.0/33", "")
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package net
 import (
 	"github.com/pkg/errors"
 	"net"
+	"strings"
 )
 
 func RetrieveLocalIP() (string, error) {
@@ -21,3 +22,65 @@ func RetrieveLocalIP() (string, error) {
 
 	return "", errors.New("unable to determine local IP")
 }
+
+// RetrieveSourceIP returns the local address the system routes traffic to serverAddr from.
+// No packets are sent: connecting a UDP socket only selects the route.
+func RetrieveSourceIP(serverAddr string) (string, error) {
+	conn, err := net.Dial("udp", serverAddr)
+	if err != nil {
+		return "", errors.Wrap(err, "resolve route to server")
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return "", errors.New("unable to determine source IP")
+	}
+
+	return addr.IP.String(), nil
+}
+
+// ParseCIDRs parses a comma separated list of CIDRs, bare IPv4 and IPv6 addresses
+// are treated as single host networks
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, errors.Errorf("invalid IP address %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid CIDR %q", item)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// ContainsIP reports whether any of nets contains ip
+func ContainsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
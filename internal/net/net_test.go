@@ -0,0 +1,30 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs("10.0.0.0/8, 192.168.1.1, 2001:db8::/32, ::1")
+	require.NoError(t, err)
+	require.Len(t, nets, 4)
+
+	assert.True(t, ContainsIP(nets, net.ParseIP("10.2.3.4")))
+	assert.True(t, ContainsIP(nets, net.ParseIP("192.168.1.1")))
+	assert.False(t, ContainsIP(nets, net.ParseIP("192.168.1.2")))
+	assert.True(t, ContainsIP(nets, net.ParseIP("2001:db8::1")))
+	assert.True(t, ContainsIP(nets, net.ParseIP("::1")))
+
+	_, err = ParseCIDRs("not-an-ip")
+	assert.Error(t, err)
+}
+
+func TestRetrieveSourceIP(t *testing.T) {
+	ip, err := RetrieveSourceIP("127.0.0.1:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip)
+}
@@ -0,0 +1,219 @@
+// Package otlp maps OpenTelemetry metrics onto isaac gauges and counters
+package otlp
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/sshirox/isaac/internal/expfmt"
+	"github.com/sshirox/isaac/internal/ingest"
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+// noRecordedValue is the data point flag of a point without a value
+const noRecordedValue = uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+
+// Stats counts the data points of one export request
+type Stats struct {
+	DataPoints int
+	// Rejected are points of unsupported metric types or temporality and points without a value
+	Rejected int
+}
+
+// Map converts the data points of the request into isaac metrics. Resource and point
+// attributes become labels, every series is stored under its name followed by its labels,
+// see expfmt.SeriesID.
+//
+// Gauges and non-monotonic sums are gauges, monotonic sums are counters. Points with delta
+// temporality are added to the stored value, cumulative counters add their increase.
+// A histogram becomes the counters name_count and name_bucket with an le label and the
+// gauge name_sum.
+func Map(req *colmetricspb.ExportMetricsServiceRequest) ([]ingest.Series, Stats) {
+	var (
+		res   []ingest.Series
+		stats Stats
+	)
+
+	for _, rm := range req.GetResourceMetrics() {
+		resource := attributes(nil, rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				var points []ingest.Series
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					points = numberPoints(&stats, m.GetName(), metric.GaugeMetricType, false, resource, data.Gauge.GetDataPoints())
+				case *metricspb.Metric_Sum:
+					sum := data.Sum
+					n := len(sum.GetDataPoints())
+					temporality := sum.GetAggregationTemporality()
+					if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED {
+						stats.DataPoints += n
+						stats.Rejected += n
+						continue
+					}
+
+					kind := metric.GaugeMetricType
+					if sum.GetIsMonotonic() {
+						kind = metric.CounterMetricType
+					}
+					delta := temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+					points = numberPoints(&stats, m.GetName(), kind, delta, resource, sum.GetDataPoints())
+				case *metricspb.Metric_Histogram:
+					points = histogramPoints(&stats, m.GetName(), resource, data.Histogram)
+				case *metricspb.Metric_ExponentialHistogram:
+					n := len(data.ExponentialHistogram.GetDataPoints())
+					stats.DataPoints += n
+					stats.Rejected += n
+				case *metricspb.Metric_Summary:
+					n := len(data.Summary.GetDataPoints())
+					stats.DataPoints += n
+					stats.Rejected += n
+				}
+				res = append(res, points...)
+			}
+		}
+	}
+
+	return res, stats
+}
+
+func numberPoints(
+	stats *Stats,
+	name, kind string,
+	delta bool,
+	resource map[string]string,
+	points []*metricspb.NumberDataPoint,
+) []ingest.Series {
+	var res []ingest.Series
+
+	for _, p := range points {
+		stats.DataPoints++
+
+		var value float64
+		switch v := p.GetValue().(type) {
+		case *metricspb.NumberDataPoint_AsDouble:
+			value = v.AsDouble
+		case *metricspb.NumberDataPoint_AsInt:
+			value = float64(v.AsInt)
+		}
+		if p.GetFlags()&noRecordedValue != 0 || p.GetValue() == nil || math.IsNaN(value) {
+			stats.Rejected++
+			continue
+		}
+
+		labels := attributes(resource, p.GetAttributes())
+		res = append(res, ingest.Series{
+			Kind:   kind,
+			ID:     expfmt.SeriesID(name, labels),
+			Labels: labels,
+			Value:  value,
+			Delta:  delta,
+		})
+	}
+
+	return res
+}
+
+func histogramPoints(stats *Stats, name string, resource map[string]string, h *metricspb.Histogram) []ingest.Series {
+	var res []ingest.Series
+
+	temporality := h.GetAggregationTemporality()
+	delta := temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	for _, p := range h.GetDataPoints() {
+		stats.DataPoints++
+
+		bounds, counts := p.GetExplicitBounds(), p.GetBucketCounts()
+		if p.GetFlags()&noRecordedValue != 0 ||
+			temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED ||
+			(len(counts) > 0 && len(counts) != len(bounds)+1) {
+			stats.Rejected++
+			continue
+		}
+
+		labels := attributes(resource, p.GetAttributes())
+		add := func(kind, suffix string, l map[string]string, value float64) {
+			res = append(res, ingest.Series{
+				Kind:   kind,
+				ID:     expfmt.SeriesID(name+suffix, l),
+				Labels: l,
+				Value:  value,
+				Delta:  delta,
+			})
+		}
+
+		add(metric.CounterMetricType, "_count", labels, float64(p.GetCount()))
+		if p.Sum != nil {
+			add(metric.GaugeMetricType, "_sum", labels, p.GetSum())
+		}
+
+		// OTLP buckets count the points of their own range, Prometheus style buckets
+		// count every point up to their upper bound.
+		var cumulative uint64
+		for i, c := range counts {
+			cumulative += c
+			le := "+Inf"
+			if i < len(bounds) {
+				le = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+			}
+
+			l := make(map[string]string, len(labels)+1)
+			for k, v := range labels {
+				l[k] = v
+			}
+			l["le"] = le
+			add(metric.CounterMetricType, "_bucket", l, float64(cumulative))
+		}
+	}
+
+	return res
+}
+
+// attributes returns base extended with the attributes, values that are not scalars are skipped
+func attributes(base map[string]string, attrs []*commonpb.KeyValue) map[string]string {
+	res := make(map[string]string, len(base)+len(attrs))
+	for k, v := range base {
+		res[k] = v
+	}
+
+	for _, kv := range attrs {
+		var value string
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			value = v.StringValue
+		case *commonpb.AnyValue_BoolValue:
+			value = strconv.FormatBool(v.BoolValue)
+		case *commonpb.AnyValue_IntValue:
+			value = strconv.FormatInt(v.IntValue, 10)
+		case *commonpb.AnyValue_DoubleValue:
+			value = strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+		case *commonpb.AnyValue_BytesValue:
+			value = base64.StdEncoding.EncodeToString(v.BytesValue)
+		default:
+			continue
+		}
+		if value != "" {
+			res[kv.GetKey()] = value
+		}
+	}
+
+	return res
+}
+
+// Response returns the export response, reporting rejected points as a partial success
+func Response(stats Stats) *colmetricspb.ExportMetricsServiceResponse {
+	res := &colmetricspb.ExportMetricsServiceResponse{}
+	if stats.Rejected > 0 {
+		res.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: int64(stats.Rejected),
+			ErrorMessage:       "exponential histograms, summaries, points without a value and unspecified temporality are not supported",
+		}
+	}
+	return res
+}
@@ -0,0 +1,109 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+func attr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func request(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource:     &resourcepb.Resource{Attributes: []*commonpb.KeyValue{attr("service.name", "api")}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}}
+}
+
+func intPoint(v int64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{Attributes: attrs, Value: &metricspb.NumberDataPoint_AsInt{AsInt: v}}
+}
+
+func TestMap(t *testing.T) {
+	req := request(
+		&metricspb.Metric{Name: "queue.size", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{
+				{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1.5}},
+				{Flags: noRecordedValue},
+			},
+		}}},
+		&metricspb.Metric{Name: "requests", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            true,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints:             []*metricspb.NumberDataPoint{intPoint(7, attr("code", "200"))},
+		}}},
+		&metricspb.Metric{Name: "connections", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			DataPoints:             []*metricspb.NumberDataPoint{intPoint(-2)},
+		}}},
+		&metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+			DataPoints: []*metricspb.SummaryDataPoint{{}},
+		}}},
+	)
+
+	series, stats := Map(req)
+	assert.Equal(t, Stats{DataPoints: 5, Rejected: 2}, stats)
+	assert.Equal(t, []ingest.Series{
+		{
+			Kind:   "gauge",
+			ID:     `queue.size{service_name="api"}`,
+			Labels: map[string]string{"service.name": "api"},
+			Value:  1.5,
+		},
+		{
+			Kind:   "counter",
+			ID:     `requests{code="200",service_name="api"}`,
+			Labels: map[string]string{"service.name": "api", "code": "200"},
+			Value:  7,
+		},
+		{
+			Kind:   "gauge",
+			ID:     `connections{service_name="api"}`,
+			Labels: map[string]string{"service.name": "api"},
+			Value:  -2,
+			Delta:  true,
+		},
+	}, series)
+
+	assert.Equal(t, int64(2), Response(stats).GetPartialSuccess().GetRejectedDataPoints())
+	assert.Nil(t, Response(Stats{DataPoints: 1}).GetPartialSuccess())
+}
+
+func TestMap_histogram(t *testing.T) {
+	sum := 12.5
+	req := request(&metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+		AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		DataPoints: []*metricspb.HistogramDataPoint{
+			{Count: 6, Sum: &sum, ExplicitBounds: []float64{0.5, 1}, BucketCounts: []uint64{1, 2, 3}},
+			{Count: 1, ExplicitBounds: []float64{0.5}, BucketCounts: []uint64{1}},
+		},
+	}}})
+
+	series, stats := Map(req)
+	assert.Equal(t, Stats{DataPoints: 2, Rejected: 1}, stats)
+	require.Len(t, series, 5)
+
+	values := make(map[string]float64)
+	for _, s := range series {
+		assert.True(t, s.Delta)
+		values[s.ID] = s.Value
+	}
+	assert.Equal(t, map[string]float64{
+		`latency_count{service_name="api"}`:            6,
+		`latency_sum{service_name="api"}`:              12.5,
+		`latency_bucket{le="0.5",service_name="api"}`:  1,
+		`latency_bucket{le="1",service_name="api"}`:    3,
+		`latency_bucket{le="+Inf",service_name="api"}`: 6,
+	}, values)
+	assert.Equal(t, "gauge", series[1].Kind)
+	assert.Equal(t, "counter", series[4].Kind)
+}
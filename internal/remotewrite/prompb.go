@@ -0,0 +1,258 @@
+package remotewrite
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MetricType is the type of a metric family in the remote write metadata
+type MetricType int32
+
+const (
+	MetricTypeUnknown MetricType = iota
+	MetricTypeCounter
+	MetricTypeGauge
+	MetricTypeHistogram
+	MetricTypeGaugeHistogram
+	MetricTypeSummary
+	MetricTypeInfo
+	MetricTypeStateset
+)
+
+// WriteRequest is the prometheus.WriteRequest message of remote write 1.0,
+// exemplars and native histograms are not decoded
+type WriteRequest struct {
+	Timeseries []TimeSeries
+	Metadata   []MetricMetadata
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+type MetricMetadata struct {
+	Type             MetricType
+	MetricFamilyName string
+	Help             string
+	Unit             string
+}
+
+// Unmarshal decodes a protobuf encoded WriteRequest
+func Unmarshal(b []byte) (*WriteRequest, error) {
+	req := &WriteRequest{}
+
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			ts, err := unmarshalTimeSeries(v)
+			if err != nil {
+				return 0, err
+			}
+			req.Timeseries = append(req.Timeseries, ts)
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			md, err := unmarshalMetadata(v)
+			if err != nil {
+				return 0, err
+			}
+			req.Metadata = append(req.Metadata, md)
+			return n, nil
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "[remotewrite.Unmarshal] decode write request")
+	}
+
+	return req, nil
+}
+
+func unmarshalTimeSeries(b []byte) (TimeSeries, error) {
+	var ts TimeSeries
+
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType || (num != 1 && num != 2) {
+			return 0, nil
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+
+		var err error
+		if num == 1 {
+			var l Label
+			l, err = unmarshalLabel(v)
+			ts.Labels = append(ts.Labels, l)
+		} else {
+			var s Sample
+			s, err = unmarshalSample(v)
+			ts.Samples = append(ts.Samples, s)
+		}
+		return n, err
+	})
+
+	return ts, err
+}
+
+func unmarshalLabel(b []byte) (Label, error) {
+	var l Label
+
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType || (num != 1 && num != 2) {
+			return 0, nil
+		}
+		v, n := protowire.ConsumeString(b)
+		if num == 1 {
+			l.Name = v
+		} else {
+			l.Value = v
+		}
+		return n, nil
+	})
+
+	return l, err
+}
+
+func unmarshalSample(b []byte) (Sample, error) {
+	var s Sample
+
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			s.Value = math.Float64frombits(v)
+			return n, nil
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			s.Timestamp = int64(v)
+			return n, nil
+		}
+		return 0, nil
+	})
+
+	return s, err
+}
+
+func unmarshalMetadata(b []byte) (MetricMetadata, error) {
+	var md MetricMetadata
+
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			md.Type = MetricType(v)
+			return n, nil
+		case typ == protowire.BytesType && (num == 2 || num == 4 || num == 5):
+			v, n := protowire.ConsumeString(b)
+			switch num {
+			case 2:
+				md.MetricFamilyName = v
+			case 4:
+				md.Help = v
+			case 5:
+				md.Unit = v
+			}
+			return n, nil
+		}
+		return 0, nil
+	})
+
+	return md, err
+}
+
+// decodeMessage calls field for every field of the message. field returns the length of the
+// value it consumed, zero to skip the field or a negative protowire error code.
+func decodeMessage(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// Marshal encodes the request in the protobuf wire format
+func (req *WriteRequest) Marshal() []byte {
+	var b []byte
+
+	for _, ts := range req.Timeseries {
+		var m []byte
+		for _, l := range ts.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+
+			m = protowire.AppendTag(m, 1, protowire.BytesType)
+			m = protowire.AppendBytes(m, lb)
+		}
+		for _, s := range ts.Samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+
+			m = protowire.AppendTag(m, 2, protowire.BytesType)
+			m = protowire.AppendBytes(m, sb)
+		}
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+
+	for _, md := range req.Metadata {
+		var m []byte
+		m = protowire.AppendTag(m, 1, protowire.VarintType)
+		m = protowire.AppendVarint(m, uint64(md.Type))
+		m = protowire.AppendTag(m, 2, protowire.BytesType)
+		m = protowire.AppendString(m, md.MetricFamilyName)
+		m = protowire.AppendTag(m, 4, protowire.BytesType)
+		m = protowire.AppendString(m, md.Help)
+		m = protowire.AppendTag(m, 5, protowire.BytesType)
+		m = protowire.AppendString(m, md.Unit)
+
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+
+	return b
+}
@@ -0,0 +1,112 @@
+// Package remotewrite maps Prometheus remote write requests onto isaac gauges and counters
+package remotewrite
+
+import (
+	"math"
+	"strings"
+
+	"github.com/sshirox/isaac/internal/expfmt"
+	"github.com/sshirox/isaac/internal/ingest"
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+const nameLabel = "__name__"
+
+// Stats counts the samples of one request
+type Stats struct {
+	Series  int
+	Samples int
+	// Skipped are samples dropped as staleness markers or belonging to series without a name
+	Skipped int
+}
+
+// Map converts the series of the request into isaac metrics with the value of their latest
+// sample, Prometheus counters are cumulative. Every series is stored under
+// its name followed by its labels, see expfmt.SeriesID. The type comes from the request
+// metadata of the family and falls back to the name suffix: _total, _count and _bucket are
+// counters, everything else is a gauge.
+func Map(req *WriteRequest) ([]ingest.Series, Stats) {
+	types := make(map[string]MetricType, len(req.Metadata))
+	for _, md := range req.Metadata {
+		types[md.MetricFamilyName] = md.Type
+	}
+
+	var (
+		res   []ingest.Series
+		stats Stats
+	)
+	for _, ts := range req.Timeseries {
+		stats.Samples += len(ts.Samples)
+
+		var name string
+		labels := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l.Name == nameLabel {
+				name = l.Value
+			} else if l.Value != "" {
+				labels[l.Name] = l.Value
+			}
+		}
+
+		latest := -1
+		for i, s := range ts.Samples {
+			// NaN is the staleness marker, isaac has no way to store it
+			if math.IsNaN(s.Value) {
+				continue
+			}
+			if latest < 0 || s.Timestamp >= ts.Samples[latest].Timestamp {
+				latest = i
+			}
+		}
+		if name == "" || latest < 0 {
+			stats.Skipped += len(ts.Samples)
+			continue
+		}
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) {
+				stats.Skipped++
+			}
+		}
+
+		stats.Series++
+		res = append(res, ingest.Series{
+			Kind:   kindOf(name, types),
+			ID:     expfmt.SeriesID(name, labels),
+			Labels: labels,
+			Value:  ts.Samples[latest].Value,
+		})
+	}
+
+	return res, stats
+}
+
+// kindOf returns the isaac type of a series by the metadata of its family or its name suffix
+func kindOf(name string, types map[string]MetricType) string {
+	family, suffix := name, ""
+	for _, sfx := range []string{"_total", "_count", "_sum", "_bucket"} {
+		if strings.HasSuffix(name, sfx) {
+			family, suffix = strings.TrimSuffix(name, sfx), sfx
+			break
+		}
+	}
+
+	t, ok := types[name]
+	if !ok && suffix != "" {
+		t, ok = types[family]
+	}
+
+	switch {
+	case !ok:
+		if suffix == "_total" || suffix == "_count" || suffix == "_bucket" {
+			return metric.CounterMetricType
+		}
+	case t == MetricTypeCounter:
+		return metric.CounterMetricType
+	case t == MetricTypeHistogram || t == MetricTypeSummary:
+		if suffix == "_count" || suffix == "_bucket" {
+			return metric.CounterMetricType
+		}
+	}
+
+	return metric.GaugeMetricType
+}
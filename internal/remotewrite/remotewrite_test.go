@@ -0,0 +1,67 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+func series(name string, samples ...Sample) TimeSeries {
+	return TimeSeries{
+		Labels:  []Label{{Name: "__name__", Value: name}, {Name: "job", Value: "api"}},
+		Samples: samples,
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	req := &WriteRequest{
+		Timeseries: []TimeSeries{series("up", Sample{Value: 1, Timestamp: 1000}, Sample{Value: -2.5, Timestamp: -1})},
+		Metadata:   []MetricMetadata{{Type: MetricTypeCounter, MetricFamilyName: "http_requests", Help: "Requests.", Unit: "1"}},
+	}
+
+	got, err := Unmarshal(req.Marshal())
+	require.NoError(t, err)
+	assert.Equal(t, req, got)
+
+	_, err = Unmarshal([]byte{0x0a, 0x05, 0x01})
+	assert.Error(t, err)
+}
+
+func TestMap(t *testing.T) {
+	stale := math.Float64frombits(0x7ff0000000000002)
+	req := &WriteRequest{
+		Timeseries: []TimeSeries{
+			series("http_requests_total", Sample{Value: 5, Timestamp: 2}, Sample{Value: 3, Timestamp: 1}),
+			series("temperature", Sample{Value: stale, Timestamp: 3}, Sample{Value: 21.5, Timestamp: 2}),
+			series("latency_sum", Sample{Value: 1.5, Timestamp: 1}),
+			series("latency_count", Sample{Value: 4, Timestamp: 1}),
+			series("queue_total", Sample{Value: 7, Timestamp: 1}),
+			series("gone", Sample{Value: stale, Timestamp: 1}),
+			{Samples: []Sample{{Value: 1}}},
+		},
+		Metadata: []MetricMetadata{
+			{Type: MetricTypeHistogram, MetricFamilyName: "latency"},
+			{Type: MetricTypeGauge, MetricFamilyName: "queue_total"},
+		},
+	}
+
+	got, stats := Map(req)
+	assert.Equal(t, Stats{Series: 5, Samples: 9, Skipped: 3}, stats)
+	require.Len(t, got, 5)
+
+	assert.Equal(t, ingest.Series{
+		Kind:   "counter",
+		ID:     `http_requests_total{job="api"}`,
+		Labels: map[string]string{"job": "api"},
+		Value:  5,
+	}, got[0])
+	assert.Equal(t, "gauge", got[1].Kind)
+	assert.Equal(t, 21.5, got[1].Value)
+	assert.Equal(t, "gauge", got[2].Kind)
+	assert.Equal(t, "counter", got[3].Kind)
+	assert.Equal(t, "gauge", got[4].Kind)
+}
@@ -1,6 +1,7 @@
 package retries
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -9,6 +10,11 @@ import (
 
 // Retry repeats a function with an error at preset intervals
 func Retry(op func() error) error {
+	return RetryContext(context.Background(), op)
+}
+
+// RetryContext is Retry that stops waiting for the next attempt once ctx is done
+func RetryContext(ctx context.Context, op func() error) error {
 	var err error
 	for _, interval := range intervals {
 		err = op()
@@ -18,7 +24,14 @@ func Retry(op func() error) error {
 		if errors.Is(err, errs.ErrNonRetry) {
 			return err
 		}
-		time.Sleep(interval)
+
+		t := time.NewTimer(interval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
 	}
 
 	return err
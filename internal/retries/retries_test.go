@@ -1,7 +1,11 @@
 package retries
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 
 	"github.com/sshirox/isaac/internal/errors"
 )
@@ -38,3 +42,19 @@ func TestRetry(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	start := time.Now()
+	err := RetryContext(ctx, func() error {
+		calls++
+		return errors.ErrRetryPG
+	})
+
+	assert.ErrorIs(t, err, errors.ErrRetryPG)
+	assert.Equal(t, 1, calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -3,21 +3,45 @@ package server
 import (
 	"encoding/json"
 	"os"
+	"time"
 )
 
 type Config struct {
-	StoreInterval   int64  `json:"store_interval"`
-	Address         string `json:"address"`
-	GRPCAddress     string `json:"grpc_address"`
-	Level           string `json:"level"`
-	FilePath        string `json:"file_path"`
-	RestoreStr      string `json:"restore_str"`
-	DatabaseAddress string `json:"database_address"`
-	StorePlace      string `json:"store_place"`
-	HashKey         string `json:"hash_key"`
-	CryptoKeyPath   string `json:"crypto_key"`
-	Restore         string `json:"restore"`
-	TrustedSubnet   string `json:"trusted_subnet"`
+	StoreInterval       int64  `json:"store_interval"`
+	Address             string `json:"address"`
+	GRPCAddress         string `json:"grpc_address"`
+	Level               string `json:"level"`
+	FilePath            string `json:"file_path"`
+	RestoreStr          string `json:"restore_str"`
+	DatabaseAddress     string `json:"database_address"`
+	StorePlace          string `json:"store_place"`
+	HashKey             string `json:"hash_key"`
+	CryptoKeyPath       string `json:"crypto_key"`
+	CryptoKeyPassphrase string `json:"crypto_key_passphrase"`
+	SignKeyPath         string `json:"sign_key"`
+	Restore             string `json:"restore"`
+	TrustedSubnet       string `json:"trusted_subnet"`
+	TrustedProxies      string `json:"trusted_proxies"`
+	TLSCertPath         string `json:"tls_cert"`
+	TLSKeyPath          string `json:"tls_key"`
+	TLSClientCAPath     string `json:"tls_client_ca"`
+	TLSClientAuth       string `json:"tls_client_auth"`
+	TokenStore          string `json:"token_store"`
+	AuditFile           string `json:"audit_file"`
+	AuditURL            string `json:"audit_url"`
+	BackupKeyPath       string `json:"backup_key"`
+	BackupGenerations   int    `json:"backup_generations"`
+	BackupMaxSize       int64  `json:"backup_max_size"`
+	HistoryRetention    string `json:"history_retention"`
+	HistoryPartition    string `json:"history_partition"`
+	Cluster             bool   `json:"cluster"`
+	Persistence         string `json:"persistence"`
+	StatsdAddress       string `json:"statsd_address"`
+	StatsdFlushInterval string `json:"statsd_flush_interval"`
+	GraphiteAddress     string `json:"graphite_address"`
+	IngestRules         string `json:"ingest_rules"`
+	StreamThrottle      string `json:"stream_throttle"`
+	StreamHeartbeat     string `json:"stream_heartbeat"`
 }
 
 func loadConfigs(path string) error {
@@ -59,13 +83,121 @@ func loadConfigs(path string) error {
 		flagCryptoKeyPath = cfg.CryptoKeyPath
 	}
 
+	if cfg.CryptoKeyPassphrase != "" && flagCryptoKeyPassphrase == "" {
+		flagCryptoKeyPassphrase = cfg.CryptoKeyPassphrase
+	}
+
+	if cfg.SignKeyPath != "" && flagSignKeyPath == "" {
+		flagSignKeyPath = cfg.SignKeyPath
+	}
+
 	if cfg.TrustedSubnet != "" {
 		flagTrustedSubnet = cfg.TrustedSubnet
 	}
 
+	if cfg.TrustedProxies != "" && flagTrustedProxies == "" {
+		flagTrustedProxies = cfg.TrustedProxies
+	}
+
 	if cfg.GRPCAddress != "" {
 		flagGRPCAddr = cfg.GRPCAddress
 	}
 
+	if cfg.TLSCertPath != "" && flagTLSCertPath == "" {
+		flagTLSCertPath = cfg.TLSCertPath
+	}
+
+	if cfg.TLSKeyPath != "" && flagTLSKeyPath == "" {
+		flagTLSKeyPath = cfg.TLSKeyPath
+	}
+
+	if cfg.TLSClientCAPath != "" && flagTLSClientCAPath == "" {
+		flagTLSClientCAPath = cfg.TLSClientCAPath
+	}
+
+	if cfg.TLSClientAuth != "" && flagTLSClientAuth == "" {
+		flagTLSClientAuth = cfg.TLSClientAuth
+	}
+
+	if cfg.TokenStore != "" && flagTokenStore == "" {
+		flagTokenStore = cfg.TokenStore
+	}
+
+	if cfg.AuditFile != "" && flagAuditFile == "" {
+		flagAuditFile = cfg.AuditFile
+	}
+
+	if cfg.AuditURL != "" && flagAuditURL == "" {
+		flagAuditURL = cfg.AuditURL
+	}
+
+	if cfg.BackupKeyPath != "" && flagBackupKeyPath == "" {
+		flagBackupKeyPath = cfg.BackupKeyPath
+	}
+
+	if cfg.HistoryRetention != "" && flagHistoryRetention == 0 {
+		retention, err := time.ParseDuration(cfg.HistoryRetention)
+		if err != nil {
+			return err
+		}
+		flagHistoryRetention = retention
+	}
+
+	if cfg.HistoryPartition != "" {
+		flagHistoryPartition = cfg.HistoryPartition
+	}
+
+	if cfg.Persistence != "" && flagPersistence == "" {
+		flagPersistence = cfg.Persistence
+	}
+
+	if cfg.Cluster {
+		flagCluster = true
+	}
+
+	if cfg.StatsdAddress != "" && flagStatsdAddr == "" {
+		flagStatsdAddr = cfg.StatsdAddress
+	}
+
+	if cfg.StatsdFlushInterval != "" {
+		interval, err := time.ParseDuration(cfg.StatsdFlushInterval)
+		if err != nil {
+			return err
+		}
+		flagStatsdFlushInterval = interval
+	}
+
+	if cfg.GraphiteAddress != "" && flagGraphiteAddr == "" {
+		flagGraphiteAddr = cfg.GraphiteAddress
+	}
+
+	if cfg.IngestRules != "" && flagIngestRulesPath == "" {
+		flagIngestRulesPath = cfg.IngestRules
+	}
+
+	if cfg.StreamThrottle != "" {
+		throttle, err := time.ParseDuration(cfg.StreamThrottle)
+		if err != nil {
+			return err
+		}
+		flagStreamThrottle = throttle
+	}
+
+	if cfg.StreamHeartbeat != "" {
+		heartbeat, err := time.ParseDuration(cfg.StreamHeartbeat)
+		if err != nil {
+			return err
+		}
+		flagStreamHeartbeat = heartbeat
+	}
+
+	if cfg.BackupGenerations != 0 {
+		flagBackupGenerations = cfg.BackupGenerations
+	}
+
+	if cfg.BackupMaxSize != 0 {
+		flagBackupMaxSize = cfg.BackupMaxSize
+	}
+
 	return nil
 }
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sshirox/isaac/internal/handler"
+	"github.com/sshirox/isaac/internal/storage"
+	"github.com/sshirox/isaac/internal/storage/pg"
+)
+
+// databaseSink persists the storage in Postgres or an embedded SQLite file. The server does not wait for the database:
+// while it is unreachable metrics are served from memory, once it connects the schema is
+// bootstrapped and, when the database is the restore source, the collected metrics are
+// merged with the stored ones.
+type databaseSink struct {
+	kind      string
+	db        *sql.DB
+	interval  int64
+	saver     *pg.Saver
+	history   *pg.History
+	connector *pg.Connector
+	elector   *pg.Elector
+	stop      chan struct{}
+	workers   *sync.WaitGroup
+
+	// load and merged are only accessed by setup, run sets load before the connector starts
+	load   bool
+	merged bool
+}
+
+func newDatabaseSink(
+	kind string,
+	db *sql.DB,
+	interval int64,
+	s *storage.MemStorage,
+	r chi.Router,
+	readAuth func(http.Handler) http.Handler,
+	stop chan struct{},
+	workers *sync.WaitGroup,
+) (*databaseSink, error) {
+	d := &databaseSink{
+		kind:     kind,
+		db:       db,
+		interval: interval,
+		saver:    pg.NewSaver(db),
+		stop:     stop,
+		workers:  workers,
+	}
+	d.connector = pg.NewConnector(db, func(ctx context.Context) error {
+		return d.setup(ctx, s)
+	})
+
+	if flagHistoryRetention > 0 {
+		history, err := pg.NewHistory(db, flagHistoryPartition, flagHistoryRetention)
+		if err != nil {
+			return nil, err
+		}
+		d.history = history
+		d.saver.RecordSamples()
+
+		r.With(readAuth).Get("/history/{type}/{name}", handler.HistoryHandler(history))
+		slog.Info("History is kept in the database", "retention", flagHistoryRetention, "partition", flagHistoryPartition)
+	}
+
+	// With several replicas only the leader persists metrics and maintains history,
+	// every replica keeps its storage up to date with the changes of the others.
+	if flagCluster {
+		d.elector = pg.NewElector(db)
+	}
+
+	d.saver.SetGate(d.active)
+	if d.history != nil {
+		d.history.SetGate(d.active)
+	}
+
+	return d, nil
+}
+
+func (d *databaseSink) name() string {
+	return d.kind
+}
+
+// active reports whether this server should write to the database now
+func (d *databaseSink) active() bool {
+	if !d.connector.Available() {
+		return false
+	}
+	return d.elector == nil || d.elector.IsLeader()
+}
+
+func (d *databaseSink) restore(ctx context.Context, _ *storage.MemStorage) (bool, error) {
+	d.load = true
+
+	if err := d.connector.Connect(ctx); err != nil {
+		slog.Warn("database is unreachable, starting in memory-only mode", "err", err)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (d *databaseSink) setup(ctx context.Context, s *storage.MemStorage) error {
+	if err := pg.Bootstrap(d.db, ctx); err != nil {
+		return err
+	}
+
+	// Steps below are not repeated when a later one fails and setup is retried.
+	if d.load && !d.merged {
+		synced := s.Seq() == 0
+		if err := pg.ListMetrics(d.db, s); err != nil {
+			return err
+		}
+		if synced {
+			d.saver.MarkSynced(s)
+		}
+		d.merged = true
+	}
+
+	if d.elector != nil {
+		replicator, err := pg.NewReplicator(d.db, flagDatabaseDSN, s)
+		if err != nil {
+			return err
+		}
+		slog.Info("Replica coordination is enabled", "replica", replicator.ID())
+
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			replicator.Run(d.stop)
+		}()
+
+		// A new leader may have missed increments the previous one already saved.
+		d.elector.OnElected(replicator.CatchUp)
+		if d.history != nil {
+			d.elector.OnElected(d.maintain)
+		}
+		if _, err = d.elector.Campaign(ctx); err != nil {
+			slog.Error("leader election", "err", err)
+		}
+		slog.Info("Leader election", "leader", d.elector.IsLeader())
+
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			d.elector.Run(d.stop)
+		}()
+	} else if d.history != nil {
+		d.maintain()
+	}
+
+	slog.Info("Database is used as a storage", "dialect", pg.DialectOf(flagDatabaseDSN), "store_interval", d.interval)
+	return nil
+}
+
+func (d *databaseSink) maintain() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := d.history.Maintain(ctx, time.Now()); err != nil {
+		slog.Error("maintain history partitions", "err", err)
+	}
+}
+
+// run starts the saver and the reconnect loop, load tells whether a database that did not
+// restore yet should merge its metrics into the storage once it connects
+func (d *databaseSink) run(s *storage.MemStorage, load bool) {
+	d.load = load
+
+	if d.history != nil {
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			d.history.Run(d.stop)
+		}()
+	}
+
+	d.workers.Add(2)
+	go func() {
+		defer d.workers.Done()
+		d.connector.Run(d.stop)
+	}()
+	go func() {
+		defer d.workers.Done()
+		pg.RunSaver(d.saver, s, d.interval, d.stop)
+	}()
+}
+
+func (d *databaseSink) writeThrough(s *storage.MemStorage) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if _, err := d.saver.Save(ctx, s); err != nil {
+		slog.Error("write through database", "err", err)
+	}
+}
+
+func (d *databaseSink) storeInterval() int64 {
+	return d.interval
+}
+
+func (d *databaseSink) Health() error {
+	return d.connector.Health()
+}
+
+// close releases leadership once the workers are done
+func (d *databaseSink) close() {
+	if err := d.connector.Health(); err != nil {
+		slog.Warn("database is unavailable at shutdown, recent metrics were not saved to it", "err", err)
+	}
+	if d.elector != nil {
+		d.elector.Resign()
+	}
+}
@@ -2,21 +2,45 @@ package server
 
 import (
 	"flag"
+	"time"
 )
 
 var (
-	flagRunAddr         string
-	flagGRPCAddr        string
-	flagLogLevel        string
-	flagStoreInterval   int64
-	flagFileStoragePath string
-	flagRestoreStr      string
-	flagRestore         bool
-	flagDatabaseDSN     string
-	flagEncryptionKey   string
-	flagCryptoKeyPath   string
-	flagConfigPath      string
-	flagTrustedSubnet   string
+	flagRunAddr             string
+	flagGRPCAddr            string
+	flagLogLevel            string
+	flagStoreInterval       int64
+	flagFileStoragePath     string
+	flagRestoreStr          string
+	flagRestore             bool
+	flagDatabaseDSN         string
+	flagEncryptionKey       string
+	flagCryptoKeyPath       string
+	flagCryptoKeyPassphrase string
+	flagSignKeyPath         string
+	flagConfigPath          string
+	flagTrustedSubnet       string
+	flagTrustedProxies      string
+	flagTLSCertPath         string
+	flagTLSKeyPath          string
+	flagTLSClientCAPath     string
+	flagTLSClientAuth       string
+	flagTokenStore          string
+	flagAuditFile           string
+	flagAuditURL            string
+	flagBackupKeyPath       string
+	flagBackupGenerations   int
+	flagBackupMaxSize       int64
+	flagHistoryRetention    time.Duration
+	flagHistoryPartition    string
+	flagCluster             bool
+	flagPersistence         string
+	flagStatsdAddr          string
+	flagStatsdFlushInterval time.Duration
+	flagGraphiteAddr        string
+	flagIngestRulesPath     string
+	flagStreamThrottle      time.Duration
+	flagStreamHeartbeat     time.Duration
 )
 
 func parseFlags() {
@@ -26,11 +50,34 @@ func parseFlags() {
 	flag.Int64Var(&flagStoreInterval, "i", 300, "store interval")
 	flag.StringVar(&flagFileStoragePath, "f", "./backups", "file storage path")
 	flag.StringVar(&flagRestoreStr, "r", "true", "restore")
-	flag.StringVar(&flagDatabaseDSN, "d", "", "database DSN")
+	flag.StringVar(&flagDatabaseDSN, "d", "", "database DSN, sqlite:path opens an embedded SQLite file")
 	flag.StringVar(&flagEncryptionKey, "k", "", "encryption key")
 	flag.StringVar(&flagCryptoKeyPath, "ck", "", "crypto key path")
+	flag.StringVar(&flagCryptoKeyPassphrase, "ckp", "", "crypto key passphrase, used when the key is encrypted")
+	flag.StringVar(&flagSignKeyPath, "sk", "", "public key path used to verify request signatures")
 	flag.StringVar(&flagConfigPath, "c", "", "config file path")
-	flag.StringVar(&flagTrustedSubnet, "t", "", "trusted subnet")
+	flag.StringVar(&flagTrustedSubnet, "t", "", "comma separated trusted subnets")
+	flag.StringVar(&flagTrustedProxies, "tp", "", "comma separated trusted proxies allowed to set X-Forwarded-For and X-Real-IP")
+	flag.StringVar(&flagTLSCertPath, "tc", "", "tls certificate path")
+	flag.StringVar(&flagTLSKeyPath, "tk", "", "tls key path")
+	flag.StringVar(&flagTokenStore, "ts", "", "token store: path to tokens file or \"database\", enables token authentication")
+	flag.StringVar(&flagBackupKeyPath, "bk", "", "backup encryption key path")
+	flag.IntVar(&flagBackupGenerations, "bg", 5, "number of backup snapshots to keep")
+	flag.Int64Var(&flagBackupMaxSize, "bs", 0, "total size limit of kept backup snapshots in bytes, 0 disables the limit")
+	flag.DurationVar(&flagHistoryRetention, "hr", 0, "keep metric history in the database for the duration, e.g. 720h, 0 disables history")
+	flag.StringVar(&flagHistoryPartition, "hp", "daily", "history partition interval: daily or weekly")
+	flag.StringVar(&flagPersistence, "p", "", "comma separated sinks in restore priority order with optional store interval in seconds, e.g. file:10,database:300")
+	flag.BoolVar(&flagCluster, "cl", false, "coordinate with other servers sharing the database: elect a leader for periodic jobs and replicate updates")
+	flag.StringVar(&flagStatsdAddr, "sd", "", "address of the StatsD listener for UDP and TCP, e.g. :8125, empty disables it")
+	flag.DurationVar(&flagStatsdFlushInterval, "sdi", 10*time.Second, "StatsD flush interval")
+	flag.StringVar(&flagGraphiteAddr, "gr", "", "address of the Graphite plaintext TCP listener, e.g. :2003, empty disables it")
+	flag.DurationVar(&flagStreamThrottle, "sti", 250*time.Millisecond, "shortest interval between /stream events sent to a client, 0 sends every update")
+	flag.DurationVar(&flagStreamHeartbeat, "sth", 15*time.Second, "interval of /stream heartbeats, 0 disables them")
+	flag.StringVar(&flagIngestRulesPath, "ir", "", "path of the JSON rules mapping Graphite paths and InfluxDB fields onto metrics")
+	flag.StringVar(&flagAuditFile, "af", "", "audit log file path")
+	flag.StringVar(&flagAuditURL, "au", "", "audit log http sink url")
+	flag.StringVar(&flagTLSClientCAPath, "tca", "", "tls client CA path, enables client certificate authentication")
+	flag.StringVar(&flagTLSClientAuth, "tcm", "", "tls client certificate mode: none, verify_if_given or require, require when a client CA is set")
 
 	flag.Parse()
 }
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/sshirox/isaac/internal/graphite"
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+// startGraphite listens for the Graphite plaintext protocol and writes the points to the
+// storage as they arrive. The returned function stops the listener, it has to be called
+// before the persistence workers do their final save. Connections are accepted from the
+// trusted subnets only, checked against the peer address.
+func startGraphite(writer *ingest.Writer, trusted []*net.IPNet) (func(), error) {
+	l, err := graphite.NewListener(flagGraphiteAddr, ingestRules, func(series []ingest.Series) {
+		writer.Write(context.Background(), series)
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.Trust(trusted)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(stop)
+	}()
+
+	slog.Info("Graphite listener started", "address", l.Addr().String())
+
+	return func() {
+		close(stop)
+		<-done
+	}, nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/storage/pg"
+)
+
+const (
+	migrateUsage = `usage: server migrate [-d dsn] [-c config] <command>
+
+  up            apply all pending migrations
+  down [N]      roll back N migrations, 1 by default
+  goto <V>      migrate up or down to version V
+  status        list migrations and when they were applied
+`
+	migrateTimeout = 5 * time.Minute
+)
+
+// Migrate runs the migrate subcommand against the configured database
+func Migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), migrateUsage) }
+	dsn := fs.String("d", os.Getenv("DATABASE_DSN"), "database DSN")
+	configPath := fs.String("c", os.Getenv("CONFIG"), "config file path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *dsn == "" && *configPath != "" {
+		if err := loadConfigs(*configPath); err != nil {
+			return errors.Wrap(err, "[server.Migrate] load config file")
+		}
+		*dsn = flagDatabaseDSN
+	}
+
+	if *dsn == "" {
+		return errors.New("[server.Migrate] database DSN is required")
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("[server.Migrate] command is required")
+	}
+
+	db, err := pg.Open(*dsn)
+	if err != nil {
+		return errors.Wrap(err, "[server.Migrate] open database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	switch cmd := fs.Arg(0); cmd {
+	case "up":
+		err = pg.Migrate(ctx, db, -1)
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			if steps, err = strconv.Atoi(fs.Arg(1)); err != nil || steps < 1 {
+				return errors.Errorf("[server.Migrate] invalid number of steps %q", fs.Arg(1))
+			}
+		}
+
+		var current int
+		if current, err = pg.SchemaVersion(ctx, db); err != nil {
+			return err
+		}
+		err = pg.Migrate(ctx, db, max(current-steps, 0))
+	case "goto":
+		if fs.NArg() < 2 {
+			return errors.New("[server.Migrate] version is required")
+		}
+
+		var version int
+		if version, err = strconv.Atoi(fs.Arg(1)); err != nil || version < 0 {
+			return errors.Errorf("[server.Migrate] invalid version %q", fs.Arg(1))
+		}
+		err = pg.Migrate(ctx, db, version)
+	case "status":
+		return printMigrationsStatus(ctx, db)
+	default:
+		fs.Usage()
+		return errors.Errorf("[server.Migrate] unknown command %q", cmd)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	version, err := pg.SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Println("schema version", version)
+
+	return nil
+}
+
+func printMigrationsStatus(ctx context.Context, db *sql.DB) error {
+	statuses, err := pg.MigrationsStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, st := range statuses {
+		applied := "pending"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+
+	return tw.Flush()
+}
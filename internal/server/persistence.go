@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/backup"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+// sink persists the storage to one backend. Sinks save independently, each with its own
+// interval, and a failing sink does not stop the others.
+type sink interface {
+	name() string
+	// restore loads persisted metrics into the storage, reports whether it did
+	restore(ctx context.Context, s *storage.MemStorage) (bool, error)
+	// run starts the workers saving the storage, load is set when no sink restored it
+	run(s *storage.MemStorage, load bool)
+	// writeThrough saves the storage after updates when the interval is zero
+	writeThrough(s *storage.MemStorage)
+	storeInterval() int64
+	Health() error
+	close()
+}
+
+// sinkSpec is one entry of the persistence setting: a sink name and its store interval in seconds
+type sinkSpec struct {
+	name     string
+	interval int64
+}
+
+// parsePersistence parses a comma separated list of sinks in restore priority order,
+// each optionally followed by its store interval, e.g. "file:10,database:300".
+// Sinks without an interval use the default one.
+func parsePersistence(spec string, interval int64) ([]sinkSpec, error) {
+	var res []sinkSpec
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		s := sinkSpec{name: part, interval: interval}
+		if name, value, ok := strings.Cut(part, ":"); ok {
+			i, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errors.Errorf("[server.parsePersistence] invalid store interval %q of %s", value, name)
+			}
+			s.name, s.interval = name, i
+		}
+
+		switch s.name {
+		case fileStorageSource, dbStorageSource, sqliteStorageSource:
+		case memoryStorageSource:
+			continue
+		default:
+			return nil, errors.Errorf("[server.parsePersistence] unknown sink %q, use file, database or sqlite", s.name)
+		}
+
+		// Both names stand for the database DSN, only one of them may be listed.
+		key := s.name
+		if key == sqliteStorageSource {
+			key = dbStorageSource
+		}
+		if seen[key] {
+			return nil, errors.Errorf("[server.parsePersistence] sink %s is listed twice", s.name)
+		}
+		seen[key] = true
+		res = append(res, s)
+	}
+
+	return res, nil
+}
+
+// persistence fans the storage out to its sinks
+type persistence struct {
+	sinks []sink
+}
+
+func startPersistence(
+	ctx context.Context,
+	specs []sinkSpec,
+	db *sql.DB,
+	s *storage.MemStorage,
+	r chi.Router,
+	readAuth func(http.Handler) http.Handler,
+	stop chan struct{},
+	workers *sync.WaitGroup,
+) (*persistence, error) {
+	p := &persistence{}
+
+	for _, spec := range specs {
+		var (
+			sk  sink
+			err error
+		)
+		switch spec.name {
+		case fileStorageSource:
+			sk, err = newFileSink(spec.interval, stop, workers)
+		case dbStorageSource, sqliteStorageSource:
+			sk, err = newDatabaseSink(spec.name, db, spec.interval, s, r, readAuth, stop, workers)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "[server.startPersistence] open %s sink", spec.name)
+		}
+		p.sinks = append(p.sinks, sk)
+	}
+
+	// The first sink able to restore is the source of truth, the others get its state on their first save.
+	var source sink
+	for _, sk := range p.sinks {
+		ok, err := sk.restore(ctx, s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "[server.startPersistence] restore from %s", sk.name())
+		}
+		if ok {
+			source = sk
+			slog.Info("storage restored", "sink", sk.name())
+			break
+		}
+	}
+
+	var through []sink
+	for _, sk := range p.sinks {
+		sk.run(s, source == nil || source == sk)
+		if sk.storeInterval() == 0 {
+			through = append(through, sk)
+		}
+	}
+
+	// Every update waits for a save covering it, updates made meanwhile share the next one.
+	if len(through) > 0 {
+		s.SetWriteThrough(func() {
+			for _, sk := range through {
+				sk.writeThrough(s)
+			}
+		})
+	}
+
+	return p, nil
+}
+
+// Health returns the error of the first unhealthy sink
+func (p *persistence) Health() error {
+	for _, sk := range p.sinks {
+		if err := sk.Health(); err != nil {
+			return errors.Wrap(err, sk.name())
+		}
+	}
+	return nil
+}
+
+// names returns the sinks in restore priority order, memory when there are none
+func (p *persistence) names() string {
+	if len(p.sinks) == 0 {
+		return memoryStorageSource
+	}
+
+	names := make([]string, len(p.sinks))
+	for i, sk := range p.sinks {
+		names[i] = sk.name()
+	}
+	return strings.Join(names, ",")
+}
+
+// close is called once the workers did their final saves
+func (p *persistence) close() {
+	for _, sk := range p.sinks {
+		sk.close()
+	}
+}
+
+// fileSink keeps snapshots of the storage in a local backup directory
+type fileSink struct {
+	store    *backup.Store
+	interval int64
+	stop     chan struct{}
+	workers  *sync.WaitGroup
+}
+
+func newFileSink(interval int64, stop chan struct{}, workers *sync.WaitGroup) (*fileSink, error) {
+	store, err := backup.NewStore(flagFileStoragePath, backup.Retention{
+		Generations: flagBackupGenerations,
+		MaxBytes:    flagBackupMaxSize,
+	}, backupKey, backup.NewKeyring(backupKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSink{
+		store:    store,
+		interval: interval,
+		stop:     stop,
+		workers:  workers,
+	}, nil
+}
+
+func (f *fileSink) name() string {
+	return fileStorageSource
+}
+
+func (f *fileSink) restore(_ context.Context, s *storage.MemStorage) (bool, error) {
+	if !flagRestore {
+		return false, nil
+	}
+
+	gens, err := f.store.Generations()
+	if err != nil || len(gens) == 0 {
+		return false, err
+	}
+
+	if err = f.store.Restore(s); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (f *fileSink) run(s *storage.MemStorage, _ bool) {
+	slog.Info("File is used as storage", "store_interval", f.interval)
+
+	f.workers.Add(1)
+	go func() {
+		defer f.workers.Done()
+		backup.RunWorker(s, f.interval, f.store, f.stop)
+	}()
+}
+
+func (f *fileSink) writeThrough(s *storage.MemStorage) {
+	if err := f.store.Save(s); err != nil {
+		slog.Error("write through backup", "err", err)
+	}
+}
+
+func (f *fileSink) storeInterval() int64 {
+	return f.interval
+}
+
+func (f *fileSink) Health() error {
+	return f.store.Health()
+}
+
+func (f *fileSink) close() {}
@@ -3,10 +3,14 @@ package server
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
+	"database/sql"
 	"github.com/pkg/errors"
 	grpcHandle "github.com/sshirox/isaac/internal/grpc"
 	pb "github.com/sshirox/isaac/internal/proto/metrics/proto"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 	"log"
 	"log/slog"
@@ -16,16 +20,23 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 
+	"github.com/sshirox/isaac/internal/audit"
+	"github.com/sshirox/isaac/internal/auth"
 	"github.com/sshirox/isaac/internal/backup"
+	"github.com/sshirox/isaac/internal/certs"
 	"github.com/sshirox/isaac/internal/crypto"
 	"github.com/sshirox/isaac/internal/handler"
+	"github.com/sshirox/isaac/internal/ingest"
 	"github.com/sshirox/isaac/internal/logger"
 	"github.com/sshirox/isaac/internal/middleware"
+	inet "github.com/sshirox/isaac/internal/net"
 	"github.com/sshirox/isaac/internal/storage"
 	"github.com/sshirox/isaac/internal/storage/pg"
 )
@@ -34,12 +45,18 @@ const (
 	dbStorageSource     = "database"
 	fileStorageSource   = "file"
 	memoryStorageSource = "memory"
-	dbDriver            = "postgres"
+	sqliteStorageSource = "sqlite"
+	dbTokenStore        = "database"
+	shutdownTimeout     = 10 * time.Second
 )
 
 var (
-	storageSource string
-	privateKey    *rsa.PrivateKey
+	sinks        []sinkSpec
+	privateKey   *rsa.PrivateKey
+	signVerifier *crypto.KeyVerifier
+	certReloader *certs.Reloader
+	backupKey    *backup.Key
+	ingestRules  *ingest.Rules
 )
 
 func Run() error {
@@ -53,20 +70,44 @@ func Run() error {
 		return err
 	}
 
-	db, err := pg.Open(dbDriver, flagDatabaseDSN)
+	db, err := pg.Open(flagDatabaseDSN)
 	if err != nil {
 		slog.Error("open database", "err", err)
 	}
 	defer db.Close()
 
-	err = pg.Ping(db)
+	if flagDatabaseDSN != "" {
+		if err = pg.Ping(db); err != nil {
+			slog.Error("ping database", "err", err)
+		} else {
+			slog.Info("open database", "addr", flagDatabaseDSN)
+		}
+	}
+	authn, err := newAuthenticator(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	auditLogger, err := newAuditLogger()
 	if err != nil {
-		slog.Error("ping database", "err", err)
-	} else {
-		slog.Info("open database", "addr", flagDatabaseDSN)
+		return err
 	}
+	if auditLogger != nil {
+		defer auditLogger.Close()
+	}
+
+	proxies, err := inet.ParseCIDRs(flagTrustedProxies)
+	if err != nil {
+		return errors.Wrap(err, "[server.Run] parse trusted proxies")
+	}
+	subnets, err := inet.ParseCIDRs(flagTrustedSubnet)
+	if err != nil {
+		return errors.Wrap(err, "[server.Run] parse trusted subnet")
+	}
+
 	encoder := crypto.NewEncoder(flagEncryptionKey)
 	signValidator := middleware.NewSignValidator(encoder).Validate
+	signatureVerifier := middleware.NewSignatureVerifier(signVerifier).Verify
 	cryptoDecoder := middleware.NewCryptoDecoder(privateKey).Decode
 
 	r := chi.NewRouter()
@@ -74,77 +115,196 @@ func Run() error {
 	r.Use(logger.WithLogging)
 	r.Use(middleware.GZipMiddleware)
 
-	trustedSubnetMiddleware, err := middleware.TrustedSubnetMiddleware(flagTrustedSubnet)
+	trustedSubnetMiddleware, err := middleware.TrustedSubnetMiddleware(flagTrustedSubnet, flagTrustedProxies)
 	if err != nil {
-		slog.Error("Failed to initialize middleware", slog.Any("error", err))
-	} else {
-		r.Use(trustedSubnetMiddleware)
+		return errors.Wrap(err, "[server.Run] trusted subnet middleware")
 	}
+	r.Use(trustedSubnetMiddleware)
 
 	s := storage.NewMemStorage()
+	// every ingest path shares the writer, it keeps the last cumulative totals and
+	// serializes the read-modify-write of a series
+	writer := ingest.NewWriter(s)
 
 	go func() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
 	}()
 
-	r.Get("/", handler.IndexHandler(s))
+	readAuth := middleware.TokenAuth(authn, auth.ScopeRead)
+	writeAuth := middleware.TokenAuth(authn, auth.ScopeWrite)
+	adminAuth := middleware.TokenAuth(authn, auth.ScopeAdmin)
+
+	r.With(readAuth).Get("/", handler.IndexHandler(s))
+	r.With(readAuth).Get("/metric/{type}/{name}", handler.MetricPageHandler(s))
+	r.Handle("/static/*", handler.StaticHandler())
+	r.With(readAuth).Get("/metrics", handler.PrometheusHandler(s))
+	streamsDone := make(chan struct{})
+	r.With(readAuth).Get("/stream", handler.StreamHandler(s, handler.StreamOptions{
+		Throttle:  flagStreamThrottle,
+		Heartbeat: flagStreamHeartbeat,
+		Done:      streamsDone,
+	}))
 	r.Route("/update", func(r chi.Router) {
+		r.Use(writeAuth, middleware.AuditMiddleware(auditLogger, audit.ActionUpdate, proxies))
 		r.Post("/", handler.UpdateByContentTypeHandler(s))
 		r.Post("/{type}/{name}/{value}", handler.UpdateMetricsHandler(s))
 	})
 	r.Route("/updates", func(r chi.Router) {
+		r.Use(writeAuth, middleware.AuditMiddleware(auditLogger, audit.ActionBulkUpdate, proxies))
 		if privateKey != nil {
-			r.With(signValidator, cryptoDecoder).Post("/", handler.BulkUpdateHandler(s))
+			r.With(signatureVerifier, signValidator, cryptoDecoder).Post("/", handler.BulkUpdateHandler(s))
 		} else {
-			r.With(signValidator).Post("/", handler.BulkUpdateHandler(s))
+			r.With(signatureVerifier, signValidator).Post("/", handler.BulkUpdateHandler(s))
 		}
 	})
+	r.Route("/api/v1/write", func(r chi.Router) {
+		r.Use(writeAuth, middleware.AuditMiddleware(auditLogger, audit.ActionBulkUpdate, proxies))
+		r.With(signatureVerifier, signValidator).Post("/", handler.RemoteWriteHandler(writer))
+	})
+	r.Route("/v1/metrics", func(r chi.Router) {
+		r.Use(writeAuth, middleware.AuditMiddleware(auditLogger, audit.ActionBulkUpdate, proxies))
+		r.With(signatureVerifier, signValidator).Post("/", handler.OTLPHandler(writer))
+	})
+	r.Route("/write", func(r chi.Router) {
+		r.Use(writeAuth, middleware.AuditMiddleware(auditLogger, audit.ActionBulkUpdate, proxies))
+		r.With(signatureVerifier, signValidator).Post("/", handler.InfluxWriteHandler(writer, ingestRules))
+	})
 	r.Route("/value", func(r chi.Router) {
+		r.Use(readAuth)
 		r.Post("/", handler.ValueByContentTypeHandler(s))
 		r.Get("/{type}/{name}", handler.ValueByContentTypeHandler(s))
 	})
-	r.Get("/ping", handler.PingDBHandler(db))
+	if auditLogger != nil {
+		r.With(adminAuth).Get("/audit", handler.AuditHandler(auditLogger))
+	}
+
+	stop := make(chan struct{})
+	var workers sync.WaitGroup
+
+	p, err := startPersistence(ctx, sinks, db, s, r, readAuth, stop, &workers)
+	if err != nil {
+		close(stop)
+		workers.Wait()
+		return err
+	}
+	defer p.close()
+
+	r.Get("/ping", handler.PingHandler(p))
+	r.Get("/ready", handler.ReadyHandler(p.names(), p))
+
+	slog.Info("Running server", "address", flagRunAddr, "tls", certReloader != nil)
+
+	var tlsConfig *tls.Config
+	if certReloader != nil {
+		tlsConfig = certReloader.ServerConfig()
+		certReloader.ReloadOnSignal(ctx)
+	}
 
-	switch storageSource {
-	case fileStorageSource:
-		ms, f, err := backup.RestoreMetrics(s, flagFileStoragePath, flagRestore)
+	var grpcServer *grpc.Server
+	if flagGRPCAddr != "" {
+		grpcServer, err = RunGRPCServer(s, writer, flagGRPCAddr, tlsConfig, authn, auditLogger)
 		if err != nil {
+			close(stop)
+			workers.Wait()
 			return err
 		}
-		defer f.Close()
-
-		slog.Info("File is used as storage")
+	}
 
-		go backup.RunWorker(ms, flagStoreInterval, f, make(chan struct{}))
-	case dbStorageSource:
-		err = pg.Bootstrap(db, ctx)
+	var stopStatsd func()
+	if flagStatsdAddr != "" {
+		stopStatsd, err = startStatsd(writer, subnets)
 		if err != nil {
-			slog.Error("bootstrap database", "err", err)
+			if grpcServer != nil {
+				grpcServer.Stop()
+			}
+			close(stop)
+			workers.Wait()
 			return err
 		}
+	}
 
-		err = pg.ListMetrics(db, s)
+	var stopGraphite func()
+	if flagGraphiteAddr != "" {
+		stopGraphite, err = startGraphite(writer, subnets)
 		if err != nil {
+			if grpcServer != nil {
+				grpcServer.Stop()
+			}
+			if stopStatsd != nil {
+				stopStatsd()
+			}
+			close(stop)
+			workers.Wait()
 			return err
 		}
-		slog.Info("Database is used as a storage")
+	}
 
-		go pg.RunSaver(db, s, flagStoreInterval, make(chan struct{}))
+	srv := &http.Server{
+		Addr:      flagRunAddr,
+		Handler:   r,
+		TLSConfig: tlsConfig,
 	}
+	// Streams never go idle, Shutdown would wait for them until the timeout and does not
+	// track hijacked WebSockets at all
+	srv.RegisterOnShutdown(func() { close(streamsDone) })
 
-	slog.Info("Running server", "address", flagRunAddr)
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			serveErr <- srv.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
 
-	if flagGRPCAddr != "" {
-		RunGRPCServer(s, flagGRPCAddr)
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down server")
+	case err = <-serveErr:
+		slog.Error("http server stopped unexpectedly", "err", err)
 	}
 
-	err = http.ListenAndServe(flagRunAddr, r)
+	shutdown(srv, grpcServer)
+	if stopStatsd != nil {
+		stopStatsd()
+	}
+	if stopGraphite != nil {
+		stopGraphite()
+	}
 
-	if err != nil {
-		return err
+	// Workers do the final flush once no request can change the storage anymore.
+	close(stop)
+	workers.Wait()
+	slog.Info("Server stopped")
+
+	return err
+}
+
+// shutdown stops accepting connections and waits for in-flight requests up to shutdownTimeout
+func shutdown(srv *http.Server, grpcServer *grpc.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("shutdown http server", "err", err)
 	}
 
-	return nil
+	if grpcServer == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Error("shutdown grpc server", "err", ctx.Err())
+		grpcServer.Stop()
+	}
 }
 
 func initConf() error {
@@ -165,6 +325,10 @@ func initConf() error {
 		flagStoreInterval = storeInterval
 	}
 
+	if flagStoreInterval < 0 {
+		return errors.Errorf("[server.initConf] store interval must not be negative, got %d", flagStoreInterval)
+	}
+
 	if envFileStoragePath := os.Getenv("FILE_STORAGE_PATH"); envFileStoragePath != "" {
 		flagFileStoragePath = envFileStoragePath
 	}
@@ -192,25 +356,130 @@ func initConf() error {
 		flagCryptoKeyPath = envCryptoKey
 	}
 
-	if flagCryptoKeyPath != "" {
-		privateKey, err = crypto.ReadPrivateKey(flagCryptoKeyPath)
-		if err != nil {
-			return errors.Wrap(err, "[server.initConf] read private key")
-		}
+	if envCryptoKeyPassphrase := os.Getenv("CRYPTO_KEY_PASSPHRASE"); envCryptoKeyPassphrase != "" {
+		flagCryptoKeyPassphrase = envCryptoKeyPassphrase
 	}
 
-	if flagDatabaseDSN != "" {
-		storageSource = dbStorageSource
-	} else if flagFileStoragePath != "" {
-		storageSource = fileStorageSource
-	} else {
-		storageSource = memoryStorageSource
+	if envSignKey := os.Getenv("SIGN_KEY"); envSignKey != "" {
+		flagSignKeyPath = envSignKey
 	}
 
 	if envTrustedSubnet := os.Getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
 		flagTrustedSubnet = envTrustedSubnet
 	}
 
+	if envTrustedProxies := os.Getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		flagTrustedProxies = envTrustedProxies
+	}
+
+	if envTLSCert := os.Getenv("TLS_CERT"); envTLSCert != "" {
+		flagTLSCertPath = envTLSCert
+	}
+
+	if envTLSKey := os.Getenv("TLS_KEY"); envTLSKey != "" {
+		flagTLSKeyPath = envTLSKey
+	}
+
+	if envTLSClientCA := os.Getenv("TLS_CLIENT_CA"); envTLSClientCA != "" {
+		flagTLSClientCAPath = envTLSClientCA
+	}
+
+	if envTLSClientAuth := os.Getenv("TLS_CLIENT_AUTH"); envTLSClientAuth != "" {
+		flagTLSClientAuth = envTLSClientAuth
+	}
+
+	if envAuditFile := os.Getenv("AUDIT_FILE"); envAuditFile != "" {
+		flagAuditFile = envAuditFile
+	}
+
+	if envAuditURL := os.Getenv("AUDIT_URL"); envAuditURL != "" {
+		flagAuditURL = envAuditURL
+	}
+
+	if envBackupKey := os.Getenv("BACKUP_KEY"); envBackupKey != "" {
+		flagBackupKeyPath = envBackupKey
+	}
+
+	if envBackupGenerations := os.Getenv("BACKUP_GENERATIONS"); envBackupGenerations != "" {
+		generations, err := strconv.Atoi(envBackupGenerations)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] parse backup generations")
+		}
+		flagBackupGenerations = generations
+	}
+
+	if envBackupMaxSize := os.Getenv("BACKUP_MAX_SIZE"); envBackupMaxSize != "" {
+		maxSize, err := strconv.ParseInt(envBackupMaxSize, 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] parse backup max size")
+		}
+		flagBackupMaxSize = maxSize
+	}
+
+	if envHistoryRetention := os.Getenv("HISTORY_RETENTION"); envHistoryRetention != "" {
+		retention, err := time.ParseDuration(envHistoryRetention)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] parse history retention")
+		}
+		flagHistoryRetention = retention
+	}
+
+	if envHistoryPartition := os.Getenv("HISTORY_PARTITION"); envHistoryPartition != "" {
+		flagHistoryPartition = envHistoryPartition
+	}
+
+	if envCluster := os.Getenv("CLUSTER"); envCluster != "" {
+		cluster, err := strconv.ParseBool(envCluster)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] parse cluster")
+		}
+		flagCluster = cluster
+	}
+
+	if envPersistence := os.Getenv("PERSISTENCE"); envPersistence != "" {
+		flagPersistence = envPersistence
+	}
+
+	if envStatsdAddr := os.Getenv("STATSD_ADDRESS"); envStatsdAddr != "" {
+		flagStatsdAddr = envStatsdAddr
+	}
+
+	if envStatsdFlushInterval := os.Getenv("STATSD_FLUSH_INTERVAL"); envStatsdFlushInterval != "" {
+		interval, err := time.ParseDuration(envStatsdFlushInterval)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] parse statsd flush interval")
+		}
+		flagStatsdFlushInterval = interval
+	}
+
+	if envGraphiteAddr := os.Getenv("GRAPHITE_ADDRESS"); envGraphiteAddr != "" {
+		flagGraphiteAddr = envGraphiteAddr
+	}
+
+	if envIngestRules := os.Getenv("INGEST_RULES"); envIngestRules != "" {
+		flagIngestRulesPath = envIngestRules
+	}
+
+	if envStreamThrottle := os.Getenv("STREAM_THROTTLE"); envStreamThrottle != "" {
+		throttle, err := time.ParseDuration(envStreamThrottle)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] parse stream throttle")
+		}
+		flagStreamThrottle = throttle
+	}
+
+	if envStreamHeartbeat := os.Getenv("STREAM_HEARTBEAT"); envStreamHeartbeat != "" {
+		heartbeat, err := time.ParseDuration(envStreamHeartbeat)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] parse stream heartbeat")
+		}
+		flagStreamHeartbeat = heartbeat
+	}
+
+	if envTokenStore := os.Getenv("TOKEN_STORE"); envTokenStore != "" {
+		flagTokenStore = envTokenStore
+	}
+
 	if envConfigPath := os.Getenv("CONFIG"); envConfigPath != "" {
 		flagConfigPath = envConfigPath
 	}
@@ -222,6 +491,92 @@ func initConf() error {
 		}
 	}
 
+	// Without an explicit setting the database is preferred over the file,
+	// the DSN scheme tells a SQLite file from a Postgres server.
+	if flagPersistence == "" {
+		if flagDatabaseDSN != "" && pg.DialectOf(flagDatabaseDSN) == pg.DialectSQLite {
+			flagPersistence = sqliteStorageSource
+		} else if flagDatabaseDSN != "" {
+			flagPersistence = dbStorageSource
+		} else if flagFileStoragePath != "" {
+			flagPersistence = fileStorageSource
+		}
+	}
+
+	if flagStreamThrottle < 0 || flagStreamHeartbeat < 0 {
+		return errors.New("[server.initConf] stream throttle and heartbeat must not be negative")
+	}
+
+	if flagStatsdAddr != "" && flagStatsdFlushInterval <= 0 {
+		return errors.Errorf("[server.initConf] statsd flush interval must be positive, got %s", flagStatsdFlushInterval)
+	}
+
+	sinks, err = parsePersistence(flagPersistence, flagStoreInterval)
+	if err != nil {
+		return err
+	}
+	for _, sk := range sinks {
+		if sk.name == dbStorageSource && flagDatabaseDSN == "" {
+			return errors.New("[server.initConf] database sink requires a database DSN")
+		}
+		if sk.name == sqliteStorageSource && pg.DialectOf(flagDatabaseDSN) != pg.DialectSQLite {
+			return errors.New("[server.initConf] sqlite sink requires a sqlite:path database DSN")
+		}
+	}
+
+	if pg.DialectOf(flagDatabaseDSN) == pg.DialectSQLite {
+		if flagCluster {
+			return errors.New("[server.initConf] replica coordination requires Postgres")
+		}
+		if flagTokenStore == dbTokenStore {
+			return errors.New("[server.initConf] database token store requires Postgres")
+		}
+	}
+
+	if flagCryptoKeyPath != "" {
+		key, err := crypto.ReadPrivateKey(flagCryptoKeyPath, []byte(flagCryptoKeyPassphrase))
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] read private key")
+		}
+
+		var ok bool
+		if privateKey, ok = key.(*rsa.PrivateKey); !ok {
+			return errors.New("[server.initConf] crypto key must be an RSA key, use sign_key for ECDSA and Ed25519")
+		}
+	}
+
+	if flagSignKeyPath != "" {
+		key, err := crypto.ReadPublicKey(flagSignKeyPath)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] read sign key")
+		}
+
+		if signVerifier, err = crypto.NewKeyVerifier(key); err != nil {
+			return errors.Wrap(err, "[server.initConf] sign key")
+		}
+	}
+
+	if flagBackupKeyPath != "" {
+		backupKey, err = backup.ReadKey(flagBackupKeyPath)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] read backup key")
+		}
+	}
+
+	if flagIngestRulesPath != "" {
+		ingestRules, err = ingest.LoadRules(flagIngestRulesPath)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] load ingest rules")
+		}
+	}
+
+	if flagTLSCertPath != "" || flagTLSKeyPath != "" {
+		certReloader, err = certs.NewReloader(flagTLSCertPath, flagTLSKeyPath, flagTLSClientCAPath, flagTLSClientAuth)
+		if err != nil {
+			return errors.Wrap(err, "[server.initConf] load tls certificates")
+		}
+	}
+
 	if err = logger.Initialize(flagLogLevel); err != nil {
 		return err
 	}
@@ -229,15 +584,42 @@ func initConf() error {
 	return nil
 }
 
-// RunGRPCServer initializes and starts a gRPC server.
-func RunGRPCServer(metricsStorage *storage.MemStorage, address string) {
+// RunGRPCServer initializes and starts a gRPC server. TLS, token authentication and
+// auditing are enabled when tlsConfig, authn and auditLogger are not nil.
+func RunGRPCServer(
+	metricsStorage *storage.MemStorage,
+	writer *ingest.Writer,
+	address string,
+	tlsConfig *tls.Config,
+	authn *auth.Authenticator,
+	auditLogger *audit.Logger,
+) (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", address)
 	if err != nil {
 		slog.Error("Failed to start listener", slog.String("address", address), slog.Any("error", err))
+		return nil, errors.Wrap(err, "[server.RunGRPCServer] listen")
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if authn != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(grpcHandle.AuthUnaryInterceptor(authn)),
+			grpc.ChainStreamInterceptor(grpcHandle.AuthStreamInterceptor(authn)),
+		)
+	}
+	if auditLogger != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(grpcHandle.AuditUnaryInterceptor(auditLogger)),
+			grpc.ChainStreamInterceptor(grpcHandle.AuditStreamInterceptor(auditLogger)),
+		)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(opts...)
 	pb.RegisterMetricsServiceServer(grpcServer, grpcHandle.NewServer(metricsStorage))
+	colmetricspb.RegisterMetricsServiceServer(grpcServer, grpcHandle.NewOTLPServer(writer))
 	reflection.Register(grpcServer)
 
 	slog.Info("Starting gRPC server", slog.String("address", address))
@@ -247,4 +629,47 @@ func RunGRPCServer(metricsStorage *storage.MemStorage, address string) {
 			slog.Error("gRPC server stopped unexpectedly", slog.Any("error", err))
 		}
 	}()
+
+	return grpcServer, nil
+}
+
+func newAuthenticator(ctx context.Context, db *sql.DB) (*auth.Authenticator, error) {
+	switch flagTokenStore {
+	case "":
+		return nil, nil
+	case dbTokenStore:
+		store, err := auth.NewPGStore(ctx, db)
+		if err != nil {
+			return nil, errors.Wrap(err, "[server.newAuthenticator] open token store")
+		}
+		slog.Info("Token authentication enabled", "store", dbTokenStore)
+		return auth.NewAuthenticator(store), nil
+	default:
+		slog.Info("Token authentication enabled", "store", flagTokenStore)
+		return auth.NewAuthenticator(auth.NewFileStore(flagTokenStore)), nil
+	}
+}
+
+func newAuditLogger() (*audit.Logger, error) {
+	var sinks []audit.Sink
+
+	if flagAuditFile != "" {
+		fs, err := audit.NewFileSink(flagAuditFile, 0, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "[server.newAuditLogger] open audit file")
+		}
+		sinks = append(sinks, fs)
+	}
+
+	if flagAuditURL != "" {
+		sinks = append(sinks, audit.NewHTTPSink(flagAuditURL))
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	slog.Info("Audit log enabled", "file", flagAuditFile, "url", flagAuditURL)
+
+	return audit.NewLogger(sinks...), nil
 }
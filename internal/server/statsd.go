@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/sshirox/isaac/internal/ingest"
+	"github.com/sshirox/isaac/internal/statsd"
+)
+
+// startStatsd listens for StatsD metrics and writes them to the storage every flush interval.
+// The returned function stops the listener and waits for the final flush, it has to be
+// called before the persistence workers do their final save. Without proxies in between,
+// the trusted subnets are checked against the peer address of each packet and connection.
+func startStatsd(writer *ingest.Writer, trusted []*net.IPNet) (func(), error) {
+	agg := statsd.NewAggregator(statsd.DefaultMaxSeries)
+	l, err := statsd.NewListener(flagStatsdAddr, agg)
+	if err != nil {
+		return nil, err
+	}
+	l.Trust(trusted)
+
+	stop := make(chan struct{})
+	served := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(served)
+		l.Serve(stop)
+	}()
+	go func() {
+		defer wg.Done()
+		statsd.RunFlusher(agg, flagStatsdFlushInterval, func(series []ingest.Series) {
+			writer.Write(context.Background(), series)
+		}, served)
+	}()
+
+	slog.Info("StatsD listener started", "address", l.Addr().String(), "flush_interval", flagStatsdFlushInterval)
+
+	return func() {
+		close(stop)
+		wg.Wait()
+	}, nil
+}
@@ -0,0 +1,324 @@
+package statsd
+
+import (
+	"bytes"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sshirox/isaac/internal/expfmt"
+	"github.com/sshirox/isaac/internal/ingest"
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+// Self-metrics of the listener, reported as counters on every flush
+const (
+	PacketsMetric     = "isaac_statsd_packets_total"
+	ParseErrorsMetric = "isaac_statsd_parse_errors_total"
+	DroppedMetric     = "isaac_statsd_dropped_total"
+)
+
+// DefaultMaxSeries limits the series kept by an aggregator
+const DefaultMaxSeries = 10000
+
+// maxTimerSamples limits the values a timer keeps per interval for its quantiles, past it
+// a uniform sample of the interval is kept
+const maxTimerSamples = 1000
+
+// quantiles reported for timers and histograms
+var quantiles = []float64{0, 0.5, 0.9, 0.99, 1}
+
+type counter struct {
+	labels  map[string]string
+	value   float64
+	touched bool
+}
+
+type gauge struct {
+	labels  map[string]string
+	value   float64
+	touched bool
+}
+
+type timer struct {
+	name   string
+	labels map[string]string
+	values []float64
+	// seen is the number of values of the interval, values holds a sample of them
+	seen  int
+	count float64
+	sum   float64
+}
+
+type set struct {
+	labels  map[string]string
+	members map[string]struct{}
+}
+
+// Aggregator collects samples between flushes. Counters report the sum of the interval as
+// a delta, gauges their last value, sets the number of unique members, and timers and
+// histograms become the counter name_count, the gauge name_sum of all values and the
+// gauges name{quantile="..."} of the interval, estimated from a sample of at most
+// maxTimerSamples values. Series are kept for the lifetime of the aggregator, samples of
+// new series are dropped once maxSeries are known.
+type Aggregator struct {
+	maxSeries int
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	timers   map[string]*timer
+	sets     map[string]*set
+	series   int
+
+	packets     atomic.Int64
+	parseErrors atomic.Int64
+	dropped     atomic.Int64
+}
+
+func NewAggregator(maxSeries int) *Aggregator {
+	return &Aggregator{
+		maxSeries: maxSeries,
+		counters:  make(map[string]*counter),
+		gauges:    make(map[string]*gauge),
+		timers:    make(map[string]*timer),
+		sets:      make(map[string]*set),
+	}
+}
+
+// Add aggregates the lines of a packet
+func (a *Aggregator) Add(packet []byte) {
+	a.packets.Add(1)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, line := range bytes.Split(packet, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		samples, err := ParseLine(string(line))
+		if err != nil {
+			a.parseErrors.Add(1)
+			slog.Debug("parse statsd line", "err", err)
+			continue
+		}
+		for _, s := range samples {
+			if !a.add(s) {
+				a.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Drop counts a packet that was not aggregated
+func (a *Aggregator) Drop() {
+	a.dropped.Add(1)
+}
+
+// add aggregates the sample, reports false when the series limit is reached
+func (a *Aggregator) add(s Sample) bool {
+	id := expfmt.SeriesID(s.Name, s.Tags)
+
+	switch s.Type {
+	case TypeCounter:
+		c, ok := a.counters[id]
+		if !ok {
+			if !a.grow() {
+				return false
+			}
+			c = &counter{labels: s.Tags}
+			a.counters[id] = c
+		}
+		c.value += s.Value / s.Rate
+		c.touched = true
+	case TypeGauge:
+		g, ok := a.gauges[id]
+		if !ok {
+			if !a.grow() {
+				return false
+			}
+			g = &gauge{labels: s.Tags}
+			a.gauges[id] = g
+		}
+		if s.Relative {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+		}
+		g.touched = true
+	case TypeSet:
+		st, ok := a.sets[id]
+		if !ok {
+			if !a.grow() {
+				return false
+			}
+			st = &set{labels: s.Tags, members: make(map[string]struct{})}
+			a.sets[id] = st
+		}
+		st.members[s.Member] = struct{}{}
+	default:
+		t, ok := a.timers[id]
+		if !ok {
+			if !a.grow() {
+				return false
+			}
+			t = &timer{name: s.Name, labels: s.Tags}
+			a.timers[id] = t
+		}
+		// reservoir sampling keeps every value of the interval with the same probability
+		t.seen++
+		if len(t.values) < maxTimerSamples {
+			t.values = append(t.values, s.Value)
+		} else if i := rand.IntN(t.seen); i < maxTimerSamples {
+			t.values[i] = s.Value
+		}
+		t.count += 1 / s.Rate
+		t.sum += s.Value / s.Rate
+	}
+
+	return true
+}
+
+func (a *Aggregator) grow() bool {
+	if a.maxSeries > 0 && a.series >= a.maxSeries {
+		return false
+	}
+	a.series++
+	return true
+}
+
+// Flush returns the series aggregated since the previous flush and the self-metrics.
+// Gauges, counter and timer count remainders and timer sums are kept for the next interval.
+func (a *Aggregator) Flush() []ingest.Series {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var res []ingest.Series
+
+	for id, c := range a.counters {
+		if !c.touched {
+			continue
+		}
+		// isaac counters are integers, the fraction left by sample rates is carried over
+		delta := math.Round(c.value)
+		c.value -= delta
+		c.touched = false
+		res = append(res, ingest.Series{Kind: metric.CounterMetricType, ID: id, Labels: c.labels, Value: delta, Delta: true})
+	}
+
+	for id, g := range a.gauges {
+		if !g.touched {
+			continue
+		}
+		g.touched = false
+		res = append(res, ingest.Series{Kind: metric.GaugeMetricType, ID: id, Labels: g.labels, Value: g.value})
+	}
+
+	for id, st := range a.sets {
+		if len(st.members) == 0 {
+			continue
+		}
+		res = append(res, ingest.Series{Kind: metric.GaugeMetricType, ID: id, Labels: st.labels, Value: float64(len(st.members))})
+		st.members = make(map[string]struct{})
+	}
+
+	for _, t := range a.timers {
+		if len(t.values) == 0 {
+			continue
+		}
+		name := t.name
+		count := math.Round(t.count)
+		t.count -= count
+
+		res = append(res,
+			ingest.Series{
+				Kind:   metric.CounterMetricType,
+				ID:     expfmt.SeriesID(name+"_count", t.labels),
+				Labels: t.labels,
+				Value:  count,
+				Delta:  true,
+			},
+			ingest.Series{
+				Kind:   metric.GaugeMetricType,
+				ID:     expfmt.SeriesID(name+"_sum", t.labels),
+				Labels: t.labels,
+				Value:  t.sum,
+			},
+		)
+
+		sort.Float64s(t.values)
+		for _, q := range quantiles {
+			l := make(map[string]string, len(t.labels)+1)
+			for k, v := range t.labels {
+				l[k] = v
+			}
+			l["quantile"] = strconv.FormatFloat(q, 'g', -1, 64)
+
+			res = append(res, ingest.Series{
+				Kind:   metric.GaugeMetricType,
+				ID:     expfmt.SeriesID(name, l),
+				Labels: l,
+				Value:  quantile(t.values, q),
+			})
+		}
+
+		t.values = t.values[:0]
+		t.seen = 0
+	}
+
+	for name, v := range map[string]int64{
+		PacketsMetric:     a.packets.Swap(0),
+		ParseErrorsMetric: a.parseErrors.Swap(0),
+		DroppedMetric:     a.dropped.Swap(0),
+	} {
+		res = append(res, ingest.Series{Kind: metric.CounterMetricType, ID: name, Value: float64(v), Delta: true})
+	}
+
+	return res
+}
+
+// Merge adds series flushed later to ones that could not be written yet. Counter deltas of
+// a series are summed, other series take the later value.
+func Merge(pending, later []ingest.Series) []ingest.Series {
+	if len(pending) == 0 {
+		return later
+	}
+
+	res := make([]ingest.Series, len(pending), len(pending)+len(later))
+	copy(res, pending)
+	index := make(map[string]int, len(res))
+	for i, s := range res {
+		index[s.Kind+" "+s.ID] = i
+	}
+
+	for _, s := range later {
+		i, ok := index[s.Kind+" "+s.ID]
+		switch {
+		case !ok:
+			index[s.Kind+" "+s.ID] = len(res)
+			res = append(res, s)
+		case s.Delta && res[i].Delta:
+			res[i].Value += s.Value
+		default:
+			res[i] = s
+		}
+	}
+
+	return res
+}
+
+// quantile returns the nearest-rank quantile of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
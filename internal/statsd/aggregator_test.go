@@ -0,0 +1,95 @@
+package statsd
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sshirox/isaac/internal/ingest"
+)
+
+func byID(series []ingest.Series) map[string]ingest.Series {
+	res := make(map[string]ingest.Series, len(series))
+	for _, s := range series {
+		res[s.Kind+" "+s.ID] = s
+	}
+	return res
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	agg := NewAggregator(DefaultMaxSeries)
+	agg.Add([]byte("requests:1|c|@0.4\nrequests:1|c|#env:prod\nqueue:5|g\nqueue:+2|g\nusers:a|s\nusers:b|s\nusers:a|s\nbroken\n"))
+	agg.Add([]byte("latency:10:20:30:40|ms"))
+
+	got := byID(agg.Flush())
+	assert.Equal(t, 3.0, got["counter requests"].Value)
+	assert.True(t, got["counter requests"].Delta)
+	assert.Equal(t, 1.0, got[`counter requests{env="prod"}`].Value)
+	assert.Equal(t, 7.0, got["gauge queue"].Value)
+	assert.Equal(t, 2.0, got["gauge users"].Value)
+	assert.Equal(t, 4.0, got["counter latency_count"].Value)
+	assert.Equal(t, 100.0, got["gauge latency_sum"].Value)
+	assert.Equal(t, 10.0, got[`gauge latency{quantile="0"}`].Value)
+	assert.Equal(t, 20.0, got[`gauge latency{quantile="0.5"}`].Value)
+	assert.Equal(t, 40.0, got[`gauge latency{quantile="0.99"}`].Value)
+	assert.Equal(t, 2.0, got["counter "+PacketsMetric].Value)
+	assert.Equal(t, 1.0, got["counter "+ParseErrorsMetric].Value)
+	assert.Equal(t, 0.0, got["counter "+DroppedMetric].Value)
+
+	// the fraction left by the sample rate is carried over, timer sums keep growing
+	agg.Add([]byte("requests:1|c|@0.4\nlatency:5|ms|@0.4"))
+	got = byID(agg.Flush())
+	assert.Equal(t, 2.0, got["counter requests"].Value)
+	assert.Equal(t, 3.0, got["counter latency_count"].Value)
+	assert.Equal(t, 112.5, got["gauge latency_sum"].Value)
+	agg.Add([]byte("latency:5|ms|@0.4"))
+	got = byID(agg.Flush())
+	assert.Equal(t, 2.0, got["counter latency_count"].Value)
+	assert.NotContains(t, got, "gauge queue")
+	assert.NotContains(t, got, "gauge users")
+}
+
+func TestAggregator_maxSeries(t *testing.T) {
+	agg := NewAggregator(1)
+	agg.Add([]byte("a:1|c\nb:1|c\na:1|c"))
+	agg.Drop()
+
+	got := byID(agg.Flush())
+	assert.Equal(t, 2.0, got["counter a"].Value)
+	assert.NotContains(t, got, "counter b")
+	assert.Equal(t, 2.0, got["counter "+DroppedMetric].Value)
+}
+
+func TestAggregator_timerSamples(t *testing.T) {
+	agg := NewAggregator(DefaultMaxSeries)
+	for i := 1; i <= 3*maxTimerSamples; i++ {
+		agg.Add([]byte("latency:" + strconv.Itoa(i) + "|ms"))
+	}
+	assert.Len(t, agg.timers["latency"].values, maxTimerSamples)
+
+	// count and sum cover every value, quantiles are estimated from the sample
+	got := byID(agg.Flush())
+	assert.Equal(t, float64(3*maxTimerSamples), got["counter latency_count"].Value)
+	assert.Equal(t, float64(3*maxTimerSamples*(3*maxTimerSamples+1)/2), got["gauge latency_sum"].Value)
+	assert.InDelta(t, 1500, got[`gauge latency{quantile="0.5"}`].Value, 300)
+}
+
+func TestMerge(t *testing.T) {
+	pending := []ingest.Series{
+		{Kind: "counter", ID: "requests", Value: 3, Delta: true},
+		{Kind: "gauge", ID: "queue", Value: 5},
+	}
+	later := []ingest.Series{
+		{Kind: "counter", ID: "requests", Value: 2, Delta: true},
+		{Kind: "gauge", ID: "queue", Value: 7},
+		{Kind: "gauge", ID: "users", Value: 1},
+	}
+
+	got := byID(Merge(pending, later))
+	assert.Len(t, got, 3)
+	assert.Equal(t, 5.0, got["counter requests"].Value)
+	assert.Equal(t, 7.0, got["gauge queue"].Value)
+	assert.Equal(t, 1.0, got["gauge users"].Value)
+	assert.Equal(t, 3.0, pending[0].Value)
+}
@@ -0,0 +1,212 @@
+package statsd
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/ingest"
+	inet "github.com/sshirox/isaac/internal/net"
+)
+
+const (
+	// maxPacketSize is the largest UDP datagram
+	maxPacketSize = 65535
+	// queueSize is the number of packets waiting for the aggregator before new ones are dropped
+	queueSize = 4096
+)
+
+// Listener receives StatsD packets over UDP and newline separated lines over TCP on one address
+type Listener struct {
+	agg   *Aggregator
+	udp   net.PacketConn
+	tcp   net.Listener
+	queue chan []byte
+	// trusted are the networks packets and connections are accepted from, empty accepts all
+	trusted []*net.IPNet
+}
+
+// NewListener binds the UDP and TCP sockets of addr
+func NewListener(addr string, agg *Aggregator) (*Listener, error) {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, pkgerrors.Wrap(err, "[statsd.NewListener] listen udp")
+	}
+
+	// TCP takes the port UDP got, so a zero port picks the same one for both
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return nil, pkgerrors.Wrap(err, "[statsd.NewListener] listen tcp")
+	}
+
+	return &Listener{
+		agg:   agg,
+		udp:   udp,
+		tcp:   tcp,
+		queue: make(chan []byte, queueSize),
+	}, nil
+}
+
+// Addr returns the address the listener is bound to
+func (l *Listener) Addr() net.Addr {
+	return l.udp.LocalAddr()
+}
+
+// Trust accepts packets and connections from the subnets only, it is called before Serve
+func (l *Listener) Trust(subnets []*net.IPNet) {
+	l.trusted = subnets
+}
+
+func (l *Listener) allows(addr net.Addr) bool {
+	if len(l.trusted) == 0 {
+		return true
+	}
+
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	if ip != nil && inet.ContainsIP(l.trusted, ip) {
+		return true
+	}
+
+	l.agg.Drop()
+	slog.Debug("drop statsd input from untrusted address", "remote", addr.String())
+	return false
+}
+
+// Serve receives packets until stop is closed, then closes the sockets and aggregates the queued packets
+func (l *Listener) Serve(stop chan struct{}) {
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+	var connsMu sync.Mutex
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		l.readUDP()
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.tcp.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("accept statsd connection", "err", err)
+				}
+				return
+			}
+			if !l.allows(conn.RemoteAddr()) {
+				conn.Close()
+				continue
+			}
+
+			connsMu.Lock()
+			conns[conn] = struct{}{}
+			connsMu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.readTCP(conn)
+
+				connsMu.Lock()
+				delete(conns, conn)
+				connsMu.Unlock()
+			}()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for packet := range l.queue {
+			l.agg.Add(packet)
+		}
+	}()
+
+	<-stop
+	l.udp.Close()
+	l.tcp.Close()
+	connsMu.Lock()
+	for conn := range conns {
+		conn.Close()
+	}
+	connsMu.Unlock()
+
+	wg.Wait()
+	close(l.queue)
+	<-done
+	slog.Info("stop statsd listener")
+}
+
+func (l *Listener) readUDP() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := l.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("read statsd packet", "err", err)
+			}
+			return
+		}
+		if !l.allows(addr) {
+			continue
+		}
+
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		l.enqueue(packet)
+	}
+}
+
+func (l *Listener) readTCP(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxPacketSize)
+	for scanner.Scan() {
+		line := make([]byte, len(scanner.Bytes()))
+		copy(line, scanner.Bytes())
+		l.enqueue(line)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		l.agg.parseErrors.Add(1)
+		slog.Debug("read statsd connection", "err", err)
+	}
+}
+
+func (l *Listener) enqueue(packet []byte) {
+	select {
+	case l.queue <- packet:
+	default:
+		l.agg.Drop()
+	}
+}
+
+// RunFlusher passes the aggregated series to write every interval until stop is closed,
+// then flushes the rest
+func RunFlusher(agg *Aggregator, interval time.Duration, write func([]ingest.Series), stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			write(agg.Flush())
+		case <-stop:
+			write(agg.Flush())
+			slog.Info("stop statsd flusher")
+			return
+		}
+	}
+}
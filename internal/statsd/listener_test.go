@@ -0,0 +1,83 @@
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListener(t *testing.T) {
+	agg := NewAggregator(DefaultMaxSeries)
+	l, err := NewListener("127.0.0.1:0", agg)
+	require.NoError(t, err)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(stop)
+	}()
+
+	udp, err := net.Dial("udp", l.Addr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("udp:1|c"))
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer tcp.Close()
+	_, err = tcp.Write([]byte("tcp:2|c\ntcp:3|c\n"))
+	require.NoError(t, err)
+
+	counters := make(map[string]float64)
+	assert.Eventually(t, func() bool {
+		for _, s := range agg.Flush() {
+			if s.ID == "udp" || s.ID == "tcp" {
+				counters[s.ID] += s.Value
+			}
+		}
+		return counters["udp"] == 1 && counters["tcp"] == 5
+	}, 2*time.Second, 10*time.Millisecond)
+
+	close(stop)
+	<-done
+}
+
+func TestListener_Trust(t *testing.T) {
+	agg := NewAggregator(DefaultMaxSeries)
+	l, err := NewListener("127.0.0.1:0", agg)
+	require.NoError(t, err)
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	l.Trust([]*net.IPNet{subnet})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(stop)
+	}()
+
+	udp, err := net.Dial("udp", l.Addr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("udp:1|c"))
+	require.NoError(t, err)
+
+	// packets from outside the trusted subnets are counted as dropped
+	assert.Eventually(t, func() bool {
+		for _, s := range agg.Flush() {
+			assert.NotEqual(t, "udp", s.ID)
+			if s.ID == DroppedMetric && s.Value > 0 {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+
+	close(stop)
+	<-done
+}
@@ -0,0 +1,105 @@
+// Package statsd receives the StatsD line protocol with DogStatsD tags and aggregates it into isaac metrics
+package statsd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Metric types of the line protocol
+const (
+	TypeCounter      = "c"
+	TypeGauge        = "g"
+	TypeTimer        = "ms"
+	TypeHistogram    = "h"
+	TypeDistribution = "d"
+	TypeSet          = "s"
+)
+
+// Sample is one value of a line
+type Sample struct {
+	Name  string
+	Type  string
+	Value float64
+	// Member is the raw value of a set
+	Member string
+	// Relative marks a gauge value with an explicit sign that changes the gauge instead of setting it
+	Relative bool
+	Rate     float64
+	Tags     map[string]string
+}
+
+// ParseLine parses name:value[:value...]|type[|@rate][|#tag:value,tag], sections it does not
+// know, like DogStatsD timestamps, are ignored. A tag without a value is set to "true".
+func ParseLine(line string) ([]Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return nil, errors.Errorf("[statsd.ParseLine] no metric name in %q", line)
+	}
+
+	sections := strings.Split(rest, "|")
+	if len(sections) < 2 {
+		return nil, errors.Errorf("[statsd.ParseLine] no metric type in %q", line)
+	}
+
+	typ := sections[1]
+	switch typ {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution, TypeSet:
+	default:
+		return nil, errors.Errorf("[statsd.ParseLine] unknown metric type %q", typ)
+	}
+
+	rate := 1.0
+	var tags map[string]string
+	for _, sec := range sections[2:] {
+		switch {
+		case strings.HasPrefix(sec, "@"):
+			r, err := strconv.ParseFloat(sec[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return nil, errors.Errorf("[statsd.ParseLine] invalid sample rate %q", sec)
+			}
+			rate = r
+		case strings.HasPrefix(sec, "#"):
+			tags = parseTags(sec[1:])
+		}
+	}
+
+	values := strings.Split(sections[0], ":")
+	res := make([]Sample, 0, len(values))
+	for _, v := range values {
+		s := Sample{Name: name, Type: typ, Rate: rate, Tags: tags}
+
+		if typ == TypeSet {
+			s.Member = v
+			res = append(res, s)
+			continue
+		}
+
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, errors.Errorf("[statsd.ParseLine] invalid value %q of %s", v, name)
+		}
+		s.Value = f
+		s.Relative = typ == TypeGauge && (strings.HasPrefix(v, "+") || strings.HasPrefix(v, "-"))
+		res = append(res, s)
+	}
+
+	return res, nil
+}
+
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			value = "true"
+		}
+		tags[name] = value
+	}
+	return tags
+}
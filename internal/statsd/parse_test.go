@@ -0,0 +1,53 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []Sample
+	}{
+		{
+			line: "requests:1|c",
+			want: []Sample{{Name: "requests", Type: TypeCounter, Value: 1, Rate: 1}},
+		},
+		{
+			line: "requests:2|c|@0.5|#env:prod,canary",
+			want: []Sample{{Name: "requests", Type: TypeCounter, Value: 2, Rate: 0.5,
+				Tags: map[string]string{"env": "prod", "canary": "true"}}},
+		},
+		{
+			line: "queue:-3|g",
+			want: []Sample{{Name: "queue", Type: TypeGauge, Value: -3, Relative: true, Rate: 1}},
+		},
+		{
+			line: "latency:10:20|ms|T1700000000",
+			want: []Sample{
+				{Name: "latency", Type: TypeTimer, Value: 10, Rate: 1},
+				{Name: "latency", Type: TypeTimer, Value: 20, Rate: 1},
+			},
+		},
+		{
+			line: "users:alice|s",
+			want: []Sample{{Name: "users", Type: TypeSet, Member: "alice", Rate: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, line := range []string{"requests", ":1|c", "requests:1", "requests:1|x", "requests:a|c", "requests:1|c|@2"} {
+		_, err := ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+// Key identifies a metric by kind and id
+type Key struct {
+	Kind string
+	ID   string
+}
+
+type change struct {
+	seq     uint64
+	deleted bool
+	at      time.Time
+}
+
+// Changes are metrics updated or deleted after a sequence number
+type Changes struct {
+	Gauges   map[string]float64
+	Counters map[string]int64
+	Deleted  []Key
+	// Seq is the sequence number the changes are current to, pass it to the next ChangesSince call
+	Seq uint64
+}
+
+// Empty reports whether nothing changed
+func (c Changes) Empty() bool {
+	return len(c.Gauges) == 0 && len(c.Counters) == 0 && len(c.Deleted) == 0
+}
+
+// Len returns the number of changed metrics
+func (c Changes) Len() int {
+	return len(c.Gauges) + len(c.Counters) + len(c.Deleted)
+}
+
+// Seq returns the sequence number of the latest change
+func (ms *MemStorage) Seq() uint64 {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.seq
+}
+
+// ChangesSince returns current values of metrics changed after seq and metrics deleted since,
+// every persistence backend keeps its own seq so each writes only what it has not seen yet
+func (ms *MemStorage) ChangesSince(seq uint64) Changes {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	c := Changes{
+		Gauges:   make(map[string]float64),
+		Counters: make(map[string]int64),
+		Seq:      ms.seq,
+	}
+
+	for k, ch := range ms.changed {
+		if ch.seq <= seq {
+			continue
+		}
+
+		switch {
+		case ch.deleted:
+			c.Deleted = append(c.Deleted, k)
+		case k.Kind == metric.GaugeMetricType:
+			c.Gauges[k.ID] = ms.gauges[k.ID]
+		case k.Kind == metric.CounterMetricType:
+			c.Counters[k.ID] = ms.counters[k.ID]
+		}
+	}
+
+	return c
+}
+
+// Acknowledge records that consumer, e.g. a saver, wrote the changes up to seq. Deleted
+// metrics are remembered until every consumer saw them, with no consumer they are not kept.
+func (ms *MemStorage) Acknowledge(consumer any, seq uint64) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.cursors[consumer] = seq
+
+	oldest := seq
+	for _, c := range ms.cursors {
+		oldest = min(oldest, c)
+	}
+	for k, ch := range ms.changed {
+		if ch.deleted && ch.seq <= oldest {
+			delete(ms.changed, k)
+		}
+	}
+}
+
+// touch records a change of the metric, callers hold the write lock
+func (ms *MemStorage) touch(kind, id string, deleted bool) {
+	ms.seq++
+	k := Key{Kind: kind, ID: id}
+	if deleted && len(ms.cursors) == 0 {
+		delete(ms.changed, k)
+		return
+	}
+	ms.changed[k] = change{seq: ms.seq, deleted: deleted, at: time.Now()}
+}
+
+// ReceiveUpdated returns when the metric was last changed by this server, restored
+// metrics count as changed when they were loaded
+func (ms *MemStorage) ReceiveUpdated(kind, id string) (time.Time, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	ch, ok := ms.changed[Key{Kind: kind, ID: id}]
+	if !ok || ch.deleted {
+		return time.Time{}, false
+	}
+	return ch.at, true
+}
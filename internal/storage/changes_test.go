@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+func TestMemStorage_ChangesSince(t *testing.T) {
+	ms := NewMemStorage()
+	ms.Acknowledge("saver", 0)
+	ms.UpdateGauge("Alloc", 1)
+	ms.UpdateCounter("PollCount", 2)
+
+	c := ms.ChangesSince(0)
+	assert.Equal(t, map[string]float64{"Alloc": 1}, c.Gauges)
+	assert.Equal(t, map[string]int64{"PollCount": 2}, c.Counters)
+	assert.Equal(t, ms.Seq(), c.Seq)
+
+	assert.True(t, ms.ChangesSince(c.Seq).Empty())
+
+	ms.UpdateCounter("PollCount", 3)
+	ms.UpdateGauge("Frees", 4)
+	ms.DeleteGauge("Alloc")
+
+	next := ms.ChangesSince(c.Seq)
+	assert.Equal(t, map[string]float64{"Frees": 4}, next.Gauges)
+	assert.Equal(t, map[string]int64{"PollCount": 5}, next.Counters)
+	assert.Equal(t, []Key{{Kind: "gauge", ID: "Alloc"}}, next.Deleted)
+	assert.Equal(t, 3, next.Len())
+
+	// A metric recreated after deletion is an update again.
+	ms.UpdateGauge("Alloc", 7)
+	assert.Equal(t, map[string]float64{"Alloc": 7}, ms.ChangesSince(next.Seq).Gauges)
+}
+
+func TestMemStorage_Acknowledge(t *testing.T) {
+	ms := NewMemStorage()
+	ms.UpdateGauge("Alloc", 1)
+	ms.UpdateGauge("Frees", 1)
+
+	// without consumers deletes are not remembered
+	ms.DeleteGauge("Frees")
+	assert.Empty(t, ms.ChangesSince(0).Deleted)
+
+	ms.Acknowledge("a", ms.Seq())
+	ms.Acknowledge("b", ms.Seq())
+	ms.DeleteGauge("Alloc")
+	c := ms.ChangesSince(0)
+	assert.Equal(t, []Key{{Kind: "gauge", ID: "Alloc"}}, c.Deleted)
+
+	// the delete is forgotten once every consumer saw it
+	ms.Acknowledge("a", c.Seq)
+	assert.Len(t, ms.ChangesSince(0).Deleted, 1)
+	ms.Acknowledge("b", c.Seq)
+	assert.Empty(t, ms.ChangesSince(0).Deleted)
+}
+
+func TestMemStorage_ReceiveUpdated(t *testing.T) {
+	ms := NewMemStorage()
+
+	_, ok := ms.ReceiveUpdated(metric.GaugeMetricType, "cpu")
+	assert.False(t, ok)
+
+	before := time.Now()
+	ms.UpdateGauge("cpu", 1)
+	at, ok := ms.ReceiveUpdated(metric.GaugeMetricType, "cpu")
+	assert.True(t, ok)
+	assert.False(t, at.Before(before))
+
+	ms.DeleteGauge("cpu")
+	_, ok = ms.ReceiveUpdated(metric.GaugeMetricType, "cpu")
+	assert.False(t, ok)
+}
@@ -1,8 +1,27 @@
 package storage
 
+import (
+	"sync"
+	"time"
+
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+type labelKey struct {
+	kind string
+	id   string
+}
+
 type MemStorage struct {
+	mu       sync.RWMutex
 	gauges   map[string]float64
 	counters map[string]int64
+	labels   map[labelKey]map[string]string
+	subs     map[*Subscription]struct{}
+	hook     func()
+	seq      uint64
+	changed  map[Key]change
+	cursors  map[any]uint64
 }
 
 // NewMemStorage creates new instance of metrics storage
@@ -10,45 +29,242 @@ func NewMemStorage() *MemStorage {
 	return &MemStorage{
 		gauges:   make(map[string]float64),
 		counters: make(map[string]int64),
+		labels:   make(map[labelKey]map[string]string),
+		subs:     make(map[*Subscription]struct{}),
+		changed:  make(map[Key]change),
+		cursors:  make(map[any]uint64),
 	}
 }
 
 // UpdateGauge updates metric by value
 func (ms *MemStorage) UpdateGauge(id string, value float64) {
+	defer ms.afterWrite()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	ms.gauges[id] = value
+	ms.touch(metric.GaugeMetricType, id, false)
+	ms.publish(Update{Kind: metric.GaugeMetricType, ID: id, Value: value})
 }
 
 // UpdateCounter updates metric by value
 func (ms *MemStorage) UpdateCounter(id string, value int64) {
+	defer ms.afterWrite()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	ms.counters[id] += value
+	ms.touch(metric.CounterMetricType, id, false)
+	ms.publish(Update{Kind: metric.CounterMetricType, ID: id, Delta: ms.counters[id], Increment: value})
+}
+
+// ApplyReplicated applies a change made by another server: gauges are set, counters are
+// incremented by u.Increment and deleted metrics are removed. Subscribers receive it
+// with Replicated set so it is not sent back.
+func (ms *MemStorage) ApplyReplicated(u Update) {
+	if ms.applyReplicated(u) {
+		ms.afterWrite()
+	}
+}
+
+// applyReplicated reports whether the update changed the storage
+func (ms *MemStorage) applyReplicated(u Update) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	res := Update{Kind: u.Kind, ID: u.ID, Deleted: u.Deleted, Replicated: true}
+
+	switch {
+	case u.Deleted && u.Kind == metric.GaugeMetricType:
+		if _, ok := ms.gauges[u.ID]; !ok {
+			return false
+		}
+		delete(ms.gauges, u.ID)
+	case u.Deleted && u.Kind == metric.CounterMetricType:
+		if _, ok := ms.counters[u.ID]; !ok {
+			return false
+		}
+		delete(ms.counters, u.ID)
+	case u.Kind == metric.GaugeMetricType:
+		ms.gauges[u.ID] = u.Value
+		res.Value = u.Value
+	case u.Kind == metric.CounterMetricType:
+		ms.counters[u.ID] += u.Increment
+		res.Delta = ms.counters[u.ID]
+		res.Increment = u.Increment
+	default:
+		return false
+	}
+
+	if u.Deleted {
+		delete(ms.labels, labelKey{kind: u.Kind, id: u.ID})
+	}
+	ms.touch(u.Kind, u.ID, u.Deleted)
+	ms.publish(res)
+	return true
 }
 
 // ReceiveGauge get metric by id
 func (ms *MemStorage) ReceiveGauge(id string) (float64, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	val, ok := ms.gauges[id]
 	return val, ok
 }
 
 // ReceiveCounter get metric by id
 func (ms *MemStorage) ReceiveCounter(id string) (int64, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	val, ok := ms.counters[id]
 	return val, ok
 }
 
-// ReceiveAllGauges get all gauge metrics
+// ReceiveAllGauges get a copy of all gauge metrics
 func (ms *MemStorage) ReceiveAllGauges() map[string]float64 {
-	return ms.gauges
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	res := make(map[string]float64, len(ms.gauges))
+	for id, val := range ms.gauges {
+		res[id] = val
+	}
+	return res
 }
 
-// ReceiveAllCounters get all counter metrics
+// ReceiveAllCounters get a copy of all counter metrics
 func (ms *MemStorage) ReceiveAllCounters() map[string]int64 {
-	return ms.counters
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	res := make(map[string]int64, len(ms.counters))
+	for id, val := range ms.counters {
+		res[id] = val
+	}
+	return res
 }
 
 // ReceiveAllMetrics get all gauge and counter metrics
 func (ms *MemStorage) ReceiveAllMetrics() map[string]interface{} {
 	return map[string]interface{}{
-		"gauges":   ms.gauges,
-		"counters": ms.counters,
+		"gauges":   ms.ReceiveAllGauges(),
+		"counters": ms.ReceiveAllCounters(),
+	}
+}
+
+// DeleteGauge removes gauge metric by id, reports whether it existed
+func (ms *MemStorage) DeleteGauge(id string) bool {
+	ms.mu.Lock()
+	_, ok := ms.gauges[id]
+	if ok {
+		delete(ms.gauges, id)
+		delete(ms.labels, labelKey{kind: metric.GaugeMetricType, id: id})
+		ms.touch(metric.GaugeMetricType, id, true)
+		ms.publish(Update{Kind: metric.GaugeMetricType, ID: id, Deleted: true})
+	}
+	ms.mu.Unlock()
+
+	if ok {
+		ms.afterWrite()
+	}
+	return ok
+}
+
+// DeleteCounter removes counter metric by id, reports whether it existed
+func (ms *MemStorage) DeleteCounter(id string) bool {
+	ms.mu.Lock()
+	_, ok := ms.counters[id]
+	if ok {
+		delete(ms.counters, id)
+		delete(ms.labels, labelKey{kind: metric.CounterMetricType, id: id})
+		ms.touch(metric.CounterMetricType, id, true)
+		ms.publish(Update{Kind: metric.CounterMetricType, ID: id, Deleted: true})
+	}
+	ms.mu.Unlock()
+
+	if ok {
+		ms.afterWrite()
+	}
+	return ok
+}
+
+// SetLabels replaces labels of the metric, empty labels are removed. Labels are not
+// persisted, so the write hook is not called.
+func (ms *MemStorage) SetLabels(kind, id string, labels map[string]string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	k := labelKey{kind: kind, id: id}
+	if len(labels) == 0 {
+		delete(ms.labels, k)
+		return
+	}
+
+	l := make(map[string]string, len(labels))
+	for name, value := range labels {
+		l[name] = value
+	}
+	ms.labels[k] = l
+}
+
+// ReceiveLabels get a copy of labels of the metric
+func (ms *MemStorage) ReceiveLabels(kind, id string) map[string]string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.receiveLabels(kind, id)
+}
+
+func (ms *MemStorage) receiveLabels(kind, id string) map[string]string {
+	l, ok := ms.labels[labelKey{kind: kind, id: id}]
+	if !ok {
+		return nil
+	}
+
+	res := make(map[string]string, len(l))
+	for name, value := range l {
+		res[name] = value
+	}
+	return res
+}
+
+// SetWriteHook registers fn to be called after every change of a value once the storage
+// lock is released, the mutating call returns after fn does. Calls that change nothing,
+// like deleting a missing metric, do not call it.
+func (ms *MemStorage) SetWriteHook(fn func()) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.hook = fn
+}
+
+func (ms *MemStorage) afterWrite() {
+	ms.mu.RLock()
+	hook := ms.hook
+	ms.mu.RUnlock()
+
+	if hook != nil {
+		hook()
+	}
+}
+
+func (ms *MemStorage) publish(u Update) {
+	if len(ms.subs) == 0 {
+		return
+	}
+
+	u.Labels = ms.receiveLabels(u.Kind, u.ID)
+	u.Time = time.Now()
+
+	for sub := range ms.subs {
+		select {
+		case sub.ch <- u:
+		default:
+			delete(ms.subs, sub)
+			sub.err = ErrSlowSubscriber
+			close(sub.ch)
+		}
 	}
 }
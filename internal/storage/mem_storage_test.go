@@ -75,3 +75,48 @@ func TestNewMemStorage(t *testing.T) {
 
 	assert.Equal(t, "*storage.MemStorage", fmt.Sprintf("%T", ms))
 }
+
+func TestMemStorage_DeleteGauge(t *testing.T) {
+	ms := NewMemStorage()
+	ms.UpdateGauge("Alloc", 9765.77)
+
+	assert.True(t, ms.DeleteGauge("Alloc"))
+	assert.False(t, ms.DeleteGauge("Alloc"))
+
+	_, ok := ms.ReceiveGauge("Alloc")
+	assert.False(t, ok)
+}
+
+func TestMemStorage_SetLabels(t *testing.T) {
+	ms := NewMemStorage()
+	ms.UpdateCounter("PollCount", 5)
+	ms.SetLabels("counter", "PollCount", map[string]string{"host": "a"})
+
+	assert.Equal(t, map[string]string{"host": "a"}, ms.ReceiveLabels("counter", "PollCount"))
+	assert.Nil(t, ms.ReceiveLabels("gauge", "PollCount"))
+
+	ms.DeleteCounter("PollCount")
+	assert.Nil(t, ms.ReceiveLabels("counter", "PollCount"))
+}
+
+func TestMemStorage_SetWriteHook(t *testing.T) {
+	ms := NewMemStorage()
+
+	var calls int
+	ms.SetWriteHook(func() {
+		calls++
+		_, ok := ms.ReceiveGauge("Alloc")
+		assert.True(t, ok)
+	})
+
+	ms.UpdateGauge("Alloc", 1)
+	ms.UpdateCounter("PollCount", 1)
+	ms.DeleteCounter("PollCount")
+	assert.Equal(t, 3, calls)
+
+	// calls that change nothing do not write
+	ms.DeleteCounter("PollCount")
+	ms.ApplyReplicated(Update{Kind: "gauge", ID: "missing", Deleted: true})
+	ms.SetLabels("gauge", "Alloc", map[string]string{"host": "a"})
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,135 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+	healthCheckInterval = 5 * time.Second
+)
+
+// ErrNotConnected is reported until the first successful connection
+var ErrNotConnected = errors.New("database is not connected yet")
+
+// Connector tracks database availability. Setup runs once the database is first reachable
+// and is retried until it succeeds, later outages only toggle availability.
+type Connector struct {
+	db    *sql.DB
+	setup func(ctx context.Context) error
+
+	mu    sync.RWMutex
+	err   error
+	since time.Time
+	ready bool
+}
+
+func NewConnector(db *sql.DB, setup func(ctx context.Context) error) *Connector {
+	return &Connector{
+		db:    db,
+		setup: setup,
+		err:   ErrNotConnected,
+		since: time.Now(),
+	}
+}
+
+// Health returns nil when the database is reachable and set up, otherwise the reason it is not
+func (c *Connector) Health() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.err
+}
+
+// Since returns the time of the latest availability change
+func (c *Connector) Since() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.since
+}
+
+// Available reports whether the database is reachable and set up
+func (c *Connector) Available() bool {
+	return c.Health() == nil
+}
+
+// Connect checks the database once, running setup if it has not succeeded yet
+func (c *Connector) Connect(ctx context.Context) error {
+	err := c.db.PingContext(ctx)
+	if err == nil && !c.isReady() {
+		if err = c.setup(ctx); err != nil {
+			slog.Error("set up database", "err", err)
+		} else {
+			c.mu.Lock()
+			c.ready = true
+			c.mu.Unlock()
+		}
+	}
+
+	c.set(err)
+	return err
+}
+
+// Run checks the database every healthCheckInterval while it is available and
+// reconnects with exponential backoff while it is not, until stop is closed
+func (c *Connector) Run(stop chan struct{}) {
+	backoff := reconnectMinBackoff
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := c.Connect(ctx)
+		cancel()
+
+		wait := healthCheckInterval
+		if err != nil {
+			wait = backoff
+			backoff = min(backoff*2, reconnectMaxBackoff)
+		} else {
+			backoff = reconnectMinBackoff
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-stop:
+			t.Stop()
+			return
+		}
+	}
+}
+
+func (c *Connector) isReady() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ready
+}
+
+func (c *Connector) set(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wasUp := c.err == nil
+	switch {
+	case err == nil && errors.Is(c.err, ErrNotConnected):
+		slog.Info("database is connected")
+		c.since = time.Now()
+	case err == nil && !wasUp:
+		slog.Info("database is available", "down_for", time.Since(c.since).Round(time.Second))
+		c.since = time.Now()
+	case err != nil && wasUp:
+		slog.Warn("database is unavailable, running in memory-only mode", "err", err)
+		c.since = time.Now()
+	case err != nil:
+		slog.Debug("database is still unavailable", "err", err)
+	}
+	c.err = err
+}
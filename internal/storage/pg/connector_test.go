@@ -0,0 +1,28 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnector_Unreachable(t *testing.T) {
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 connect_timeout=1 sslmode=disable")
+	require.NoError(t, err)
+	defer db.Close()
+
+	calls := 0
+	c := NewConnector(db, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+	assert.ErrorIs(t, c.Health(), ErrNotConnected)
+
+	assert.Error(t, c.Connect(context.Background()))
+	assert.Error(t, c.Health())
+	assert.False(t, c.Available())
+	assert.Zero(t, calls)
+}
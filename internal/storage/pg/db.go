@@ -17,15 +17,6 @@ const (
 	timeout = 10 * time.Second
 )
 
-func Open(driver, addr string) (*sql.DB, error) {
-	db, err := sql.Open(driver, addr)
-	if err != nil {
-		return nil, err
-	}
-
-	return db, nil
-}
-
 func Ping(db *sql.DB) error {
 	err := db.Ping()
 	if err != nil {
@@ -34,80 +25,13 @@ func Ping(db *sql.DB) error {
 	return nil
 }
 
+// Bootstrap applies pending schema migrations
 func Bootstrap(db *sql.DB, ctx context.Context) error {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-
-	defer tx.Rollback()
-
-	tx.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS observability`)
-
-	tx.ExecContext(ctx, `
-        CREATE TABLE IF NOT EXISTS observability.metrics (
-            id SERIAL PRIMARY KEY,
-            type character varying(255) NOT NULL,
-            name character varying(255) NOT NULL UNIQUE,
-            value double precision,
-            delta int
-        )
-    `)
-
-	return tx.Commit()
-}
-
-func RunSaver(db *sql.DB, ms *storage.MemStorage, interval int64, stopChan chan struct{}) {
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	for {
-		select {
-		case <-ticker.C:
-			if err := upsertMetrics(db, ms); err != nil {
-				slog.Error("save metrics to database", "err", err)
-			}
-		case <-stopChan:
-			slog.Info("stop database saver")
-			return
-		}
-	}
-}
-
-func upsertMetrics(db *sql.DB, s *storage.MemStorage) error {
-	gauges := s.ReceiveAllGauges()
-	counters := s.ReceiveAllCounters()
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	for name, value := range gauges {
-		query := `
-            INSERT INTO observability.metrics (name, type, value)
-                VALUES ($1, $2, $3)
-                ON CONFLICT (name)
-                DO UPDATE SET name = $1, type = $2, value = $3`
-		err := ExecuteContextWithRetry(ctx, db, query, name, metric.GaugeMetricType, value)
-		if err != nil {
-			slog.Error("upsert gauge", "err", err)
-			return errors.Wrap(err, "upsert gauge")
-		}
-	}
-
-	for name, delta := range counters {
-		query := `
-            INSERT INTO observability.metrics (name, type, delta)
-                VALUES ($1, $2, $3)
-                ON CONFLICT (name)
-                DO UPDATE SET name = $1, type = $2, delta = $3`
-		err := ExecuteContextWithRetry(ctx, db, query, name, metric.CounterMetricType, delta)
-		if err != nil {
-			slog.Error("upsert counter", "err", err)
-			return errors.Wrap(err, "upsert counter")
-		}
-	}
-
-	return nil
+	return Migrate(ctx, db, -1)
 }
 
+// ListMetrics merges the stored metrics into ms: gauges already in ms are newer and kept,
+// stored counters are added to the increments ms has collected
 func ListMetrics(db *sql.DB, ms *storage.MemStorage) error {
 	err := listGauges(db, ms)
 	if err != nil {
@@ -143,7 +67,9 @@ func listGauges(db *sql.DB, ms *storage.MemStorage) error {
 			slog.Error("scan gauge", "err", err)
 			return errors.Wrap(err, "scan gauge")
 		}
-		ms.UpdateGauge(name, value)
+		if _, ok := ms.ReceiveGauge(name); !ok {
+			ms.UpdateGauge(name, value)
+		}
 	}
 
 	err = rows.Err()
@@ -187,3 +113,44 @@ func listCounters(db *sql.DB, ms *storage.MemStorage) error {
 
 	return nil
 }
+
+// CatchUpCounters raises counters of ms that are behind the stored totals, e.g. after
+// replication messages were missed. The difference is applied as a replicated update,
+// so it is not sent to other replicas again.
+func CatchUpCounters(ctx context.Context, db *sql.DB, ms *storage.MemStorage) (int, error) {
+	query := "SELECT name, delta FROM observability.metrics WHERE type = 'counter'"
+	rows, err := QueryContextWithRetry(ctx, db, query)
+	if err != nil {
+		return 0, errors.Wrap(err, "[pg.CatchUpCounters] read counters")
+	}
+	defer rows.Close()
+
+	stored := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var delta int64
+		if err = rows.Scan(&name, &delta); err != nil {
+			return 0, errors.Wrap(err, "[pg.CatchUpCounters] scan counter")
+		}
+		stored[name] = delta
+	}
+	if err = rows.Err(); err != nil {
+		return 0, errors.Wrap(err, "[pg.CatchUpCounters] read counters")
+	}
+
+	raised := 0
+	for name, delta := range stored {
+		current, _ := ms.ReceiveCounter(name)
+		if delta <= current {
+			continue
+		}
+		ms.ApplyReplicated(storage.Update{
+			Kind:      metric.CounterMetricType,
+			ID:        name,
+			Increment: delta - current,
+		})
+		raised++
+	}
+
+	return raised, nil
+}
@@ -0,0 +1,108 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+
+	sqliteScheme = "sqlite:"
+	// sqliteTimeLayout has a fixed width so timestamps stored as text compare in time order
+	sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+// DialectOf returns the dialect selected by the DSN scheme: "sqlite:path" or "sqlite://path"
+// opens an embedded SQLite file, anything else is a Postgres connection string
+func DialectOf(dsn string) string {
+	if strings.HasPrefix(dsn, sqliteScheme) {
+		return DialectSQLite
+	}
+	return DialectPostgres
+}
+
+// Open opens the database the DSN points to
+func Open(dsn string) (*sql.DB, error) {
+	if DialectOf(dsn) == DialectPostgres {
+		return sql.Open(DialectPostgres, dsn)
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(dsn, sqliteScheme), "//")
+	if path == "" {
+		return nil, errors.New("[pg.Open] sqlite DSN has no file path")
+	}
+
+	db := sql.OpenDB(&sqliteConnector{path: path, driver: &sqlite.Driver{}})
+	// SQLite has a single writer, one connection keeps writers from failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+// dialect returns the dialect of an opened database
+func dialect(db *sql.DB) string {
+	if db == nil {
+		return DialectPostgres
+	}
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		return DialectSQLite
+	}
+	return DialectPostgres
+}
+
+// timeArg converts a time query argument to the representation of the dialect
+func timeArg(d string, t time.Time) any {
+	if d == DialectSQLite {
+		return t.UTC().Format(sqliteTimeLayout)
+	}
+	return t
+}
+
+// sqliteConnector opens connections with the database file attached as the observability
+// schema, so queries are shared with Postgres
+type sqliteConnector struct {
+	path   string
+	driver *sqlite.Driver
+}
+
+func (c *sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(":memory:")
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("[pg.sqliteConnector.Connect] driver does not support exec")
+	}
+
+	stmts := []struct {
+		query string
+		args  []driver.NamedValue
+	}{
+		{`ATTACH DATABASE $1 AS observability`, []driver.NamedValue{{Ordinal: 1, Value: c.path}}},
+		{`PRAGMA observability.journal_mode = WAL`, nil},
+		{`PRAGMA busy_timeout = 5000`, nil},
+	}
+	for _, st := range stmts {
+		if _, err = execer.ExecContext(ctx, st.query, st.args); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "[pg.sqliteConnector.Connect] open %s", c.path)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,133 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// leaderLockID is the pg_advisory_lock key held by the replica running periodic jobs
+	leaderLockID     = 7340032
+	electionInterval = 5 * time.Second
+)
+
+// Elector elects one leader among the servers sharing a database. The leader holds a
+// session advisory lock on a dedicated connection, losing the connection releases the
+// lock and lets another replica take over.
+type Elector struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	conn      *sql.Conn
+	onElected []func()
+
+	leader atomic.Bool
+}
+
+func NewElector(db *sql.DB) *Elector {
+	return &Elector{db: db}
+}
+
+// IsLeader reports whether this replica currently holds the leader lock
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// OnElected registers fn to be called every time this replica becomes the leader
+func (e *Elector) OnElected(fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.onElected = append(e.onElected, fn)
+}
+
+// Campaign checks that held leadership is still valid or tries to acquire it
+func (e *Elector) Campaign(ctx context.Context) (bool, error) {
+	e.mu.Lock()
+
+	if e.conn != nil {
+		if err := e.conn.PingContext(ctx); err == nil {
+			e.mu.Unlock()
+			return true, nil
+		}
+		slog.Warn("leader connection lost, stepping down")
+		e.resign()
+	}
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		e.mu.Unlock()
+		return false, errors.Wrap(err, "[pg.Elector.Campaign] get connection")
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, leaderLockID).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Close()
+		e.mu.Unlock()
+		return false, errors.Wrap(err, "[pg.Elector.Campaign] try leader lock")
+	}
+
+	e.conn = conn
+	e.leader.Store(true)
+	callbacks := append([]func(){}, e.onElected...)
+	e.mu.Unlock()
+
+	slog.Info("elected as leader")
+	for _, fn := range callbacks {
+		fn()
+	}
+
+	return true, nil
+}
+
+// Run campaigns every electionInterval until stop is closed. Leadership is kept until
+// Resign so jobs stopping with Run can still do their final work as the leader.
+func (e *Elector) Run(stop chan struct{}) {
+	t := time.NewTicker(electionInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if _, err := e.Campaign(ctx); err != nil {
+				slog.Error("leader election", "err", err)
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Resign releases leadership, a no-op for followers
+func (e *Elector) Resign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.resign()
+}
+
+func (e *Elector) resign() {
+	if e.conn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if _, err := e.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, leaderLockID); err != nil {
+		slog.Debug("release leader lock", "err", err)
+	}
+	// A broken connection is discarded by the pool and the server drops its lock with the session.
+	e.conn.Close()
+	e.conn = nil
+	e.leader.Store(false)
+}
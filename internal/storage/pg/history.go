@@ -0,0 +1,271 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/metric"
+)
+
+const (
+	PartitionDaily  = "daily"
+	PartitionWeekly = "weekly"
+
+	partitionPrefix     = "samples_"
+	partitionDateLayout = "20060102"
+	// partitionsAhead is the number of future partitions kept ready so inserts never miss one
+	partitionsAhead     = 2
+	maintenanceInterval = time.Hour
+	maxHistoryLimit     = 10000
+)
+
+// History keeps metric samples in observability.samples, a table partitioned by time.
+// Partitions are created ahead of time and dropped once they are older than retention.
+// SQLite has no partitions, expired samples are deleted instead.
+type History struct {
+	db        *sql.DB
+	dialect   string
+	interval  string
+	retention time.Duration
+	gate      func() bool
+}
+
+type partition struct {
+	name       string
+	start, end time.Time
+}
+
+func NewHistory(db *sql.DB, interval string, retention time.Duration) (*History, error) {
+	switch interval {
+	case PartitionDaily, PartitionWeekly:
+	case "":
+		interval = PartitionDaily
+	default:
+		return nil, errors.Errorf("[pg.NewHistory] unknown partition interval %q, use daily or weekly", interval)
+	}
+
+	if retention <= 0 {
+		return nil, errors.New("[pg.NewHistory] retention must be positive")
+	}
+
+	return &History{
+		db:        db,
+		dialect:   dialect(db),
+		interval:  interval,
+		retention: retention,
+	}, nil
+}
+
+// SetGate makes Run skip maintenance while gate reports false, it must be called before Run
+func (h *History) SetGate(gate func() bool) {
+	h.gate = gate
+}
+
+// Run maintains partitions every hour until stop is closed
+func (h *History) Run(stop chan struct{}) {
+	t := time.NewTicker(maintenanceInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if h.gate != nil && !h.gate() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if err := h.Maintain(ctx, time.Now()); err != nil {
+				slog.Error("maintain history partitions", "err", err)
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Maintain creates partitions up to partitionsAhead intervals after now and drops the expired ones
+func (h *History) Maintain(ctx context.Context, now time.Time) error {
+	if h.dialect == DialectSQLite {
+		res, err := h.db.ExecContext(ctx, `DELETE FROM observability.samples WHERE ts < $1`,
+			timeArg(h.dialect, now.Add(-h.retention)))
+		if err != nil {
+			return errors.Wrap(err, "[pg.History.Maintain] delete expired samples")
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			slog.Info("expired history samples deleted", "count", n)
+		}
+		return nil
+	}
+
+	existing, err := h.partitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	start := h.bucketStart(now)
+	for i := 0; i <= partitionsAhead; i++ {
+		p := h.partitionAt(start)
+		start = p.end
+
+		if overlaps(existing, p) {
+			continue
+		}
+
+		_, err = h.db.ExecContext(ctx, fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS observability.%s PARTITION OF observability.samples FOR VALUES FROM ('%s') TO ('%s')`,
+			p.name, p.start.Format(time.RFC3339), p.end.Format(time.RFC3339)))
+		if err != nil {
+			return errors.Wrapf(err, "[pg.History.Maintain] create partition %s", p.name)
+		}
+		existing = append(existing, p)
+		slog.Info("history partition created", "name", p.name)
+	}
+
+	for _, p := range expired(existing, now.Add(-h.retention)) {
+		if _, err = h.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS observability.%s`, p.name)); err != nil {
+			return errors.Wrapf(err, "[pg.History.Maintain] drop partition %s", p.name)
+		}
+		slog.Info("history partition dropped", "name", p.name)
+	}
+
+	return nil
+}
+
+// Query returns samples of the metric taken in [from, to) in time order, at most limit of them
+func (h *History) Query(ctx context.Context, kind, name string, from, to time.Time, limit int) ([]metric.Sample, error) {
+	if limit <= 0 || limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+        SELECT ts, value, delta FROM observability.samples
+            WHERE type = $1 AND name = $2 AND ts >= $3 AND ts < $4
+            ORDER BY ts
+            LIMIT $5`, kind, name, timeArg(h.dialect, from), timeArg(h.dialect, to), limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "[pg.History.Query] select samples")
+	}
+	defer rows.Close()
+
+	res := make([]metric.Sample, 0)
+	for rows.Next() {
+		var s metric.Sample
+		var value sql.NullFloat64
+		var delta sql.NullInt64
+		if err = rows.Scan(&s.Time, &value, &delta); err != nil {
+			return nil, errors.Wrap(err, "[pg.History.Query] scan sample")
+		}
+
+		if value.Valid {
+			s.Value = &value.Float64
+		}
+		if delta.Valid {
+			s.Delta = &delta.Int64
+		}
+		res = append(res, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "[pg.History.Query] select samples")
+	}
+
+	return res, nil
+}
+
+func (h *History) partitions(ctx context.Context) ([]partition, error) {
+	rows, err := h.db.QueryContext(ctx, `
+        SELECT c.relname FROM pg_inherits i
+            JOIN pg_class c ON c.oid = i.inhrelid
+            WHERE i.inhparent = 'observability.samples'::regclass`)
+	if err != nil {
+		return nil, errors.Wrap(err, "[pg.History.partitions] list partitions")
+	}
+	defer rows.Close()
+
+	var res []partition
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "[pg.History.partitions] scan partition")
+		}
+
+		if p, ok := parsePartition(name); ok {
+			res = append(res, p)
+		}
+	}
+
+	return res, rows.Err()
+}
+
+// bucketStart returns the UTC start of the day or ISO week containing t
+func (h *History) bucketStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if h.interval == PartitionDaily {
+		return day
+	}
+
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func (h *History) partitionAt(start time.Time) partition {
+	end := start.AddDate(0, 0, 1)
+	if h.interval == PartitionWeekly {
+		end = start.AddDate(0, 0, 7)
+	}
+
+	return partition{
+		name:  partitionPrefix + start.Format(partitionDateLayout) + "_" + end.Format(partitionDateLayout),
+		start: start,
+		end:   end,
+	}
+}
+
+// parsePartition reads the range of a partition from its samples_YYYYMMDD_YYYYMMDD name
+func parsePartition(name string) (partition, bool) {
+	from, to, ok := strings.Cut(strings.TrimPrefix(name, partitionPrefix), "_")
+	if !ok || !strings.HasPrefix(name, partitionPrefix) {
+		return partition{}, false
+	}
+
+	start, err := time.Parse(partitionDateLayout, from)
+	if err != nil {
+		return partition{}, false
+	}
+
+	end, err := time.Parse(partitionDateLayout, to)
+	if err != nil {
+		return partition{}, false
+	}
+
+	return partition{name: name, start: start, end: end}, true
+}
+
+func overlaps(existing []partition, p partition) bool {
+	for _, e := range existing {
+		if e.start.Before(p.end) && p.start.Before(e.end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expired lists partitions holding only samples older than cutoff
+func expired(existing []partition, cutoff time.Time) []partition {
+	var res []partition
+	for _, p := range existing {
+		if !p.end.After(cutoff) {
+			res = append(res, p)
+		}
+	}
+
+	return res
+}
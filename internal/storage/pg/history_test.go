@@ -0,0 +1,56 @@
+package pg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory_partitionAt(t *testing.T) {
+	// 2024-01-03 is a Wednesday.
+	now := time.Date(2024, 1, 3, 15, 4, 5, 0, time.UTC)
+
+	daily, err := NewHistory(nil, PartitionDaily, 24*time.Hour)
+	require.NoError(t, err)
+	p := daily.partitionAt(daily.bucketStart(now))
+	assert.Equal(t, "samples_20240103_20240104", p.name)
+
+	weekly, err := NewHistory(nil, PartitionWeekly, 24*time.Hour)
+	require.NoError(t, err)
+	p = weekly.partitionAt(weekly.bucketStart(now))
+	assert.Equal(t, "samples_20240101_20240108", p.name)
+
+	parsed, ok := parsePartition(p.name)
+	require.True(t, ok)
+	assert.Equal(t, p, parsed)
+
+	_, ok = parsePartition("samples_default")
+	assert.False(t, ok)
+
+	_, err = NewHistory(nil, "hourly", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestPartitionsRetention(t *testing.T) {
+	h, err := NewHistory(nil, PartitionDaily, 48*time.Hour)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	var existing []partition
+	for d := 5; d <= 10; d++ {
+		existing = append(existing, h.partitionAt(time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)))
+	}
+
+	var names []string
+	for _, p := range expired(existing, now.Add(-h.retention)) {
+		names = append(names, p.name)
+	}
+	assert.Equal(t, []string{"samples_20240105_20240106", "samples_20240106_20240107", "samples_20240107_20240108"}, names)
+
+	weekly, err := NewHistory(nil, PartitionWeekly, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, overlaps(existing, weekly.partitionAt(weekly.bucketStart(now))))
+	assert.False(t, overlaps(existing, h.partitionAt(time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC))))
+}
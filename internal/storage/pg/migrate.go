@@ -0,0 +1,345 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// migrationLockID is the pg_advisory_lock key held while migrating,
+// servers starting concurrently apply migrations one at a time.
+const migrationLockID = 7340031
+
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+var ErrIrreversible = errors.New("migration has no down script")
+
+// Migration is a numbered schema change, files are named NNNN_name.up.sql and NNNN_name.down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a known migration and whether it is applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations of the dialect ordered by version
+func Migrations(dialect string) ([]Migration, error) {
+	if dialect == DialectSQLite {
+		return loadMigrations(migrationFiles, "migrations/sqlite")
+	}
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "[pg.loadMigrations] read migrations")
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, title, ok := strings.Cut(base, "_")
+		version, convErr := strconv.Atoi(num)
+		if !ok || convErr != nil || version <= 0 {
+			return nil, errors.Errorf("[pg.loadMigrations] invalid migration file name %q", name)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, errors.Wrap(err, "[pg.loadMigrations] read migration")
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, errors.Errorf("[pg.loadMigrations] migration %d has conflicting names %q and %q", version, m.Name, title)
+		}
+
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, errors.Errorf("[pg.loadMigrations] migration %d has no up script", m.Version)
+		}
+		res = append(res, *m)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+
+	for i, m := range res {
+		if m.Version != i+1 {
+			return nil, errors.Errorf("[pg.loadMigrations] migration %d is missing", i+1)
+		}
+	}
+
+	return res, nil
+}
+
+// Migrate moves the schema to target version, a negative target means the latest one
+func Migrate(ctx context.Context, db *sql.DB, target int) error {
+	migrations, err := Migrations(dialect(db))
+	if err != nil {
+		return err
+	}
+
+	if target < 0 {
+		target = len(migrations)
+	}
+	if target > len(migrations) {
+		return errors.Errorf("[pg.Migrate] unknown version %d, latest is %d", target, len(migrations))
+	}
+
+	return withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		current, err := schemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range plan(migrations, current, target) {
+			up := m.Version > current
+			if err = apply(ctx, conn, m, up); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// plan lists migrations to apply going from current to target version,
+// in application order: ascending when upgrading, descending when downgrading
+func plan(migrations []Migration, current, target int) []Migration {
+	var res []Migration
+	if target >= current {
+		for _, m := range migrations {
+			if m.Version > current && m.Version <= target {
+				res = append(res, m)
+			}
+		}
+		return res
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if m := migrations[i]; m.Version <= current && m.Version > target {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// SchemaVersion returns the latest applied migration version, 0 for an empty database
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "[pg.SchemaVersion] get connection")
+	}
+	defer conn.Close()
+
+	if err = createVersionTable(ctx, conn, dialect(db)); err != nil {
+		return 0, err
+	}
+
+	return schemaVersion(ctx, conn)
+}
+
+// MigrationsStatus lists every known migration with its application time
+func MigrationsStatus(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(dialect(db))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "[pg.MigrationsStatus] get connection")
+	}
+	defer conn.Close()
+
+	if err = createVersionTable(ctx, conn, dialect(db)); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM observability.schema_version`)
+	if err != nil {
+		return nil, errors.Wrap(err, "[pg.MigrationsStatus] read schema version")
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, errors.Wrap(err, "[pg.MigrationsStatus] scan schema version")
+		}
+		applied[version] = at
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "[pg.MigrationsStatus] read schema version")
+	}
+
+	res := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		st := MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			st.AppliedAt = &at
+		}
+		res = append(res, st)
+	}
+
+	return res, nil
+}
+
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	// Advisory locks belong to a session, so everything runs on one connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[pg.withMigrationLock] get connection")
+	}
+	defer conn.Close()
+
+	// SQLite databases are opened with a single connection, holding it is the lock.
+	if dialect(db) == DialectSQLite {
+		if err = createVersionTable(ctx, conn, DialectSQLite); err != nil {
+			return err
+		}
+		return fn(conn)
+	}
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return errors.Wrap(err, "[pg.withMigrationLock] acquire lock")
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			slog.Error("release migration lock", "err", err)
+		}
+	}()
+
+	if err = createVersionTable(ctx, conn, DialectPostgres); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func createVersionTable(ctx context.Context, conn *sql.Conn, d string) error {
+	if d == DialectSQLite {
+		_, err := conn.ExecContext(ctx, `
+            CREATE TABLE IF NOT EXISTS observability.schema_version (
+                version integer PRIMARY KEY,
+                name text NOT NULL,
+                applied_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+            )
+        `)
+		return errors.Wrap(err, "[pg.createVersionTable] create schema_version table")
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS observability`); err != nil {
+		return errors.Wrap(err, "[pg.createVersionTable] create schema")
+	}
+
+	_, err := conn.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS observability.schema_version (
+            version integer PRIMARY KEY,
+            name character varying(255) NOT NULL,
+            applied_at timestamptz NOT NULL DEFAULT now()
+        )
+    `)
+	if err != nil {
+		return errors.Wrap(err, "[pg.createVersionTable] create schema_version table")
+	}
+
+	return nil
+}
+
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM observability.schema_version`).Scan(&version)
+	if err != nil {
+		return 0, errors.Wrap(err, "[pg.schemaVersion] read schema version")
+	}
+
+	return version, nil
+}
+
+// apply runs one migration and records it in schema_version within a single transaction
+func apply(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	script, direction := m.Up, "up"
+	if !up {
+		script, direction = m.Down, "down"
+		if script == "" {
+			return errors.Wrap(ErrIrreversible, m.String())
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "[pg.apply] begin transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return errors.Wrapf(err, "[pg.apply] migration %s %s", m, direction)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO observability.schema_version (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM observability.schema_version WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return errors.Wrap(err, "[pg.apply] update schema version")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "[pg.apply] commit migration")
+	}
+
+	slog.Info("migration applied", "version", m.Version, "name", m.Name, "direction", direction)
+
+	return nil
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
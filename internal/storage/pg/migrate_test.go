@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	for _, d := range []string{DialectPostgres, DialectSQLite} {
+		migrations, err := Migrations(d)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.Version)
+			assert.NotEmpty(t, m.Up, m.String())
+			assert.NotEmpty(t, m.Down, m.String())
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "ordered",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   {Data: []byte("B")},
+				"m/0001_first.up.sql":    {Data: []byte("A")},
+				"m/0001_first.down.sql":  {Data: []byte("a")},
+				"m/README.md":            {Data: []byte("ignored")},
+				"m/0002_second.down.sql": {Data: []byte("b")},
+			},
+			want: []string{"0001_first", "0002_second"},
+		},
+		{
+			name:    "gap",
+			files:   fstest.MapFS{"m/0001_a.up.sql": {}, "m/0003_c.up.sql": {Data: []byte("C")}},
+			wantErr: true,
+		},
+		{
+			name:    "no up script",
+			files:   fstest.MapFS{"m/0001_a.down.sql": {Data: []byte("a")}},
+			wantErr: true,
+		},
+		{
+			name:    "bad name",
+			files:   fstest.MapFS{"m/first.up.sql": {Data: []byte("A")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var names []string
+			for _, m := range got {
+				names = append(names, m.String())
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	versions := func(ms []Migration) []int {
+		var res []int
+		for _, m := range ms {
+			res = append(res, m.Version)
+		}
+		return res
+	}
+
+	assert.Equal(t, []int{2, 3}, versions(plan(migrations, 1, 3)))
+	assert.Equal(t, []int{3, 2}, versions(plan(migrations, 3, 1)))
+	assert.Equal(t, []int{3, 2, 1}, versions(plan(migrations, 3, 0)))
+	assert.Empty(t, plan(migrations, 2, 2))
+}
@@ -0,0 +1,9 @@
+CREATE SCHEMA IF NOT EXISTS observability;
+
+CREATE TABLE IF NOT EXISTS observability.metrics (
+    id SERIAL PRIMARY KEY,
+    type character varying(255) NOT NULL,
+    name character varying(255) NOT NULL UNIQUE,
+    value double precision,
+    delta int
+);
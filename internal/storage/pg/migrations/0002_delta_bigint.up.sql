@@ -0,0 +1 @@
+ALTER TABLE observability.metrics ALTER COLUMN delta TYPE bigint;
@@ -0,0 +1,3 @@
+ALTER TABLE observability.metrics DROP CONSTRAINT IF EXISTS metrics_type_name_key;
+
+ALTER TABLE observability.metrics ADD CONSTRAINT metrics_name_key UNIQUE (name);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS observability.samples (
+    type character varying(255) NOT NULL,
+    name character varying(255) NOT NULL,
+    value double precision,
+    delta bigint,
+    ts timestamptz NOT NULL
+) PARTITION BY RANGE (ts);
+
+CREATE INDEX IF NOT EXISTS samples_type_name_ts_idx ON observability.samples (type, name, ts);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS observability.metrics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    name TEXT NOT NULL,
+    value REAL,
+    delta INTEGER,
+    UNIQUE (type, name)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS observability.samples (
+    type TEXT NOT NULL,
+    name TEXT NOT NULL,
+    value REAL,
+    delta INTEGER,
+    ts DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS observability.samples_type_name_ts_idx ON samples (type, name, ts);
@@ -0,0 +1,291 @@
+package pg
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/sshirox/isaac/internal/metric"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+const (
+	replicationChannel = "isaac_metrics"
+	// maxNotifyPayload keeps messages below the 8000 bytes NOTIFY limit
+	maxNotifyPayload     = 7800
+	replicationBuffer    = 65536
+	replicationBatch     = 512
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// Replicator keeps the in-memory storages of servers sharing a database consistent.
+// Local changes are sent with NOTIFY as gauge values, counter increments and deletions,
+// changes of other replicas are received with LISTEN and applied to the storage.
+type Replicator struct {
+	db       *sql.DB
+	ms       *storage.MemStorage
+	id       string
+	listener *pq.Listener
+}
+
+type replicaMessage struct {
+	Origin  string          `json:"o"`
+	Updates []replicaUpdate `json:"u"`
+}
+
+type replicaUpdate struct {
+	Kind      string  `json:"k"`
+	ID        string  `json:"i"`
+	Value     float64 `json:"v,omitempty"`
+	Increment int64   `json:"d,omitempty"`
+	Deleted   bool    `json:"x,omitempty"`
+}
+
+// NewReplicator starts listening for changes of other replicas on the database at dsn
+func NewReplicator(db *sql.DB, dsn string, ms *storage.MemStorage) (*Replicator, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, errors.Wrap(err, "[pg.NewReplicator] generate replica id")
+	}
+
+	listener := pq.NewListener(dsn, listenerMinReconnect, listenerMaxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("replication listener", "event", ev, "err", err)
+		}
+	})
+	if err := listener.Listen(replicationChannel); err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "[pg.NewReplicator] listen")
+	}
+
+	return &Replicator{
+		db:       db,
+		ms:       ms,
+		id:       hex.EncodeToString(raw),
+		listener: listener,
+	}, nil
+}
+
+// ID identifies the replica in sent messages
+func (r *Replicator) ID() string {
+	return r.id
+}
+
+// Run sends local changes and applies received ones until stop is closed.
+// Changes made before stop is closed are sent before it returns.
+func (r *Replicator) Run(stop chan struct{}) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.receive(stop)
+	}()
+
+	for {
+		sub := r.ms.Subscribe(replicationBuffer)
+		err := r.forward(sub, stop)
+		sub.Close()
+		if err == nil {
+			break
+		}
+		slog.Error("replication fell behind, some changes were not sent to other replicas", "err", err)
+	}
+
+	<-done
+	slog.Info("stop replication")
+}
+
+func (r *Replicator) forward(sub *storage.Subscription, stop chan struct{}) error {
+	for {
+		select {
+		case u, ok := <-sub.C():
+			if !ok {
+				return sub.Err()
+			}
+			batch, ok := drain(sub, []storage.Update{u})
+			r.send(batch)
+			if !ok {
+				return sub.Err()
+			}
+		case <-stop:
+			batch, _ := drain(sub, nil)
+			r.send(batch)
+			return nil
+		}
+	}
+}
+
+// drain appends updates already buffered by sub, reports false once sub is closed
+func drain(sub *storage.Subscription, batch []storage.Update) ([]storage.Update, bool) {
+	for len(batch) < replicationBatch {
+		select {
+		case u, ok := <-sub.C():
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, u)
+		default:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+func (r *Replicator) send(batch []storage.Update) {
+	payloads, err := encodeReplicaMessages(r.id, batch)
+	if err != nil {
+		slog.Error("encode replication message", "err", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, p := range payloads {
+		if _, err = r.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, replicationChannel, p); err != nil {
+			slog.Error("send replication message", "err", err)
+		}
+	}
+}
+
+func (r *Replicator) receive(stop chan struct{}) {
+	defer r.listener.Close()
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	// The listener is already subscribed, so changes saved before it are read from the
+	// database and the ones made after it arrive as messages.
+	r.CatchUp()
+
+	for {
+		select {
+		case n := <-r.listener.Notify:
+			if n == nil {
+				slog.Warn("replication connection re-established, catching up with the database")
+				r.CatchUp()
+				continue
+			}
+			r.apply(n.Extra)
+		case <-ping.C:
+			go r.listener.Ping()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CatchUp raises counters that are behind the totals saved by the leader,
+// increments sent while this replica was not listening are not lost
+func (r *Replicator) CatchUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	raised, err := CatchUpCounters(ctx, r.db, r.ms)
+	if err != nil {
+		slog.Error("catch up with the database", "err", err)
+		return
+	}
+	if raised > 0 {
+		slog.Info("caught up with the database", "counters", raised)
+	}
+}
+
+func (r *Replicator) apply(payload string) {
+	var msg replicaMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		slog.Error("decode replication message", "err", err)
+		return
+	}
+
+	if msg.Origin == r.id {
+		return
+	}
+
+	for _, u := range msg.Updates {
+		r.ms.ApplyReplicated(storage.Update{
+			Kind:      u.Kind,
+			ID:        u.ID,
+			Value:     u.Value,
+			Increment: u.Increment,
+			Deleted:   u.Deleted,
+		})
+	}
+}
+
+// encodeReplicaMessages turns local updates into NOTIFY payloads of at most maxNotifyPayload bytes,
+// replicated updates are skipped so they are not sent back
+func encodeReplicaMessages(origin string, updates []storage.Update) ([]string, error) {
+	var (
+		res  []string
+		msg  = replicaMessage{Origin: origin}
+		size int
+	)
+
+	header, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	flush := func() error {
+		if len(msg.Updates) == 0 {
+			return nil
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		res = append(res, string(data))
+		msg.Updates = nil
+		size = len(header)
+		return nil
+	}
+	size = len(header)
+
+	for _, u := range updates {
+		if u.Replicated {
+			continue
+		}
+
+		ru := replicaUpdate{Kind: u.Kind, ID: u.ID, Deleted: u.Deleted}
+		switch {
+		case u.Deleted:
+		case u.Kind == metric.GaugeMetricType:
+			ru.Value = u.Value
+		case u.Kind == metric.CounterMetricType:
+			ru.Increment = u.Increment
+		}
+
+		data, err := json.Marshal(ru)
+		if err != nil {
+			return nil, err
+		}
+		if len(header)+len(data) > maxNotifyPayload {
+			slog.Warn("metric name is too long to replicate", "type", u.Kind, "id", u.ID)
+			continue
+		}
+
+		// One more byte for the separating comma.
+		if size+len(data)+1 > maxNotifyPayload {
+			if err = flush(); err != nil {
+				return nil, err
+			}
+		}
+		msg.Updates = append(msg.Updates, ru)
+		size += len(data) + 1
+	}
+
+	if err = flush(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
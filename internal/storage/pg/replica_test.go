@@ -0,0 +1,69 @@
+package pg
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func TestEncodeReplicaMessages(t *testing.T) {
+	updates := []storage.Update{
+		{Kind: "gauge", ID: "Alloc", Value: 1.5},
+		{Kind: "counter", ID: "PollCount", Delta: 10, Increment: 3},
+		{Kind: "counter", ID: "Remote", Increment: 1, Replicated: true},
+		{Kind: "gauge", ID: "Old", Deleted: true},
+	}
+
+	payloads, err := encodeReplicaMessages("r1", updates)
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+
+	var msg replicaMessage
+	require.NoError(t, json.Unmarshal([]byte(payloads[0]), &msg))
+	assert.Equal(t, "r1", msg.Origin)
+	assert.Equal(t, []replicaUpdate{
+		{Kind: "gauge", ID: "Alloc", Value: 1.5},
+		{Kind: "counter", ID: "PollCount", Increment: 3},
+		{Kind: "gauge", ID: "Old", Deleted: true},
+	}, msg.Updates)
+}
+
+func TestEncodeReplicaMessages_Split(t *testing.T) {
+	var updates []storage.Update
+	for i := 0; i < 1000; i++ {
+		updates = append(updates, storage.Update{Kind: "gauge", ID: fmt.Sprintf("Metric%04d", i), Value: float64(i)})
+	}
+
+	payloads, err := encodeReplicaMessages("r1", updates)
+	require.NoError(t, err)
+	assert.Greater(t, len(payloads), 1)
+
+	total := 0
+	for _, p := range payloads {
+		assert.LessOrEqual(t, len(p), maxNotifyPayload)
+
+		var msg replicaMessage
+		require.NoError(t, json.Unmarshal([]byte(p), &msg))
+		total += len(msg.Updates)
+	}
+	assert.Equal(t, len(updates), total)
+}
+
+func TestReplicator_Apply(t *testing.T) {
+	ms := storage.NewMemStorage()
+	r := &Replicator{ms: ms, id: "local"}
+
+	r.apply(`{"o":"local","u":[{"k":"counter","i":"PollCount","d":5}]}`)
+	r.apply(`{"o":"other","u":[{"k":"counter","i":"PollCount","d":2},{"k":"gauge","i":"Alloc","v":3}]}`)
+	r.apply(`not json`)
+
+	v, _ := ms.ReceiveCounter("PollCount")
+	assert.Equal(t, int64(2), v)
+	g, _ := ms.ReceiveGauge("Alloc")
+	assert.Equal(t, 3.0, g)
+}
@@ -0,0 +1,411 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	errs "github.com/sshirox/isaac/internal/errors"
+	"github.com/sshirox/isaac/internal/metric"
+	"github.com/sshirox/isaac/internal/retries"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+// saveBatchSize limits the rows sent in one statement
+const saveBatchSize = 5000
+
+// SaveStats describes one save
+type SaveStats struct {
+	Upserted int
+	Deleted  int
+	Duration time.Duration
+}
+
+// Saver writes metrics changed since its previous save in one transaction.
+// A failed save leaves the table untouched and its changes are retried by the next one.
+type Saver struct {
+	db      *sql.DB
+	dialect string
+	samples bool
+	gate    func() bool
+
+	mu   sync.Mutex
+	seq  uint64
+	last SaveStats
+}
+
+func NewSaver(db *sql.DB) *Saver {
+	return &Saver{db: db, dialect: dialect(db)}
+}
+
+// RecordSamples makes every save also append the saved values to the history samples table
+func (s *Saver) RecordSamples() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = true
+}
+
+// MarkSynced treats the current storage state as saved, used after loading it from the database
+func (s *Saver) MarkSynced(ms *storage.MemStorage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq = ms.Seq()
+	ms.Acknowledge(s, s.seq)
+}
+
+// SetGate makes saves no-ops while gate reports false, skipped changes are saved by the
+// first save after it reports true again
+func (s *Saver) SetGate(gate func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gate = gate
+}
+
+// LastStats returns the stats of the latest successful save
+func (s *Saver) LastStats() SaveStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+// Save writes pending changes, concurrent saves are serialized
+func (s *Saver) Save(ctx context.Context, ms *storage.MemStorage) (SaveStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gate != nil && !s.gate() {
+		return SaveStats{}, nil
+	}
+
+	changes := ms.ChangesSince(s.seq)
+	if changes.Empty() {
+		s.seq = changes.Seq
+		ms.Acknowledge(s, s.seq)
+		return SaveStats{}, nil
+	}
+
+	start := time.Now()
+
+	// Waits between attempts follow ctx, so a short-lived caller does not keep the
+	// saver locked for the whole retry schedule.
+	err := retries.RetryContext(ctx, func() error {
+		err := s.save(ctx, changes)
+		if err != nil && !errs.IsRetryPGErr(err) {
+			return errors.Wrap(errs.ErrNonRetry, err.Error())
+		}
+		return err
+	})
+	if err != nil {
+		return SaveStats{}, errors.Wrap(err, "[pg.Saver.Save] save metrics")
+	}
+
+	s.seq = changes.Seq
+	ms.Acknowledge(s, s.seq)
+
+	// Samples are written after the metrics so a history problem, e.g. a missing
+	// partition, costs only the samples of this save.
+	if s.samples {
+		if err = s.saveSamples(ctx, changes, start); err != nil {
+			slog.Error("history samples were not recorded", "err", err)
+		}
+	}
+
+	s.last = SaveStats{
+		Upserted: len(changes.Gauges) + len(changes.Counters),
+		Deleted:  len(changes.Deleted),
+		Duration: time.Since(start),
+	}
+
+	return s.last, nil
+}
+
+func (s *Saver) save(ctx context.Context, changes storage.Changes) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.dialect == DialectSQLite {
+		if err = saveSQLite(ctx, tx, changes); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// Rows are written in name order so concurrent saves lock them in the same order.
+	names, values := sortedGauges(changes.Gauges)
+	for i := 0; i < len(names); i += saveBatchSize {
+		j := min(i+saveBatchSize, len(names))
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO observability.metrics (type, name, value)
+                SELECT $1, name, value FROM unnest($2::text[], $3::double precision[]) AS t(name, value)
+                ON CONFLICT (type, name)
+                DO UPDATE SET value = EXCLUDED.value`,
+			metric.GaugeMetricType, pq.Array(names[i:j]), pq.Array(values[i:j]))
+		if err != nil {
+			return errors.Wrap(err, "upsert gauges")
+		}
+	}
+
+	// Stored counter totals never go down, so a replica that took over the leadership
+	// before catching up cannot overwrite the totals of the previous leader.
+	names, deltas := sortedCounters(changes.Counters)
+	for i := 0; i < len(names); i += saveBatchSize {
+		j := min(i+saveBatchSize, len(names))
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO observability.metrics (type, name, delta)
+                SELECT $1, name, delta FROM unnest($2::text[], $3::bigint[]) AS t(name, delta)
+                ON CONFLICT (type, name)
+                DO UPDATE SET delta = GREATEST(metrics.delta, EXCLUDED.delta)`,
+			metric.CounterMetricType, pq.Array(names[i:j]), pq.Array(deltas[i:j]))
+		if err != nil {
+			return errors.Wrap(err, "upsert counters")
+		}
+	}
+
+	deleted := make(map[string][]string)
+	for _, k := range changes.Deleted {
+		deleted[k.Kind] = append(deleted[k.Kind], k.ID)
+	}
+	for kind, ids := range deleted {
+		_, err = tx.ExecContext(ctx, `DELETE FROM observability.metrics WHERE type = $1 AND name = ANY($2::text[])`,
+			kind, pq.Array(ids))
+		if err != nil {
+			return errors.Wrap(err, "delete metrics")
+		}
+	}
+
+	return tx.Commit()
+}
+
+// saveSamples records the saved values in the history, in one transaction per save
+func (s *Saver) saveSamples(ctx context.Context, changes storage.Changes, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "[pg.Saver.saveSamples] begin")
+	}
+	defer tx.Rollback()
+
+	gaugeNames, values := sortedGauges(changes.Gauges)
+	counterNames, deltas := sortedCounters(changes.Counters)
+
+	if s.dialect == DialectSQLite {
+		ts := timeArg(DialectSQLite, now)
+		for i := 0; i < len(gaugeNames); i += saveBatchSize {
+			j := min(i+saveBatchSize, len(gaugeNames))
+			args := make([]any, 0, 2*(j-i)+2)
+			args = append(args, metric.GaugeMetricType, ts)
+			for k := i; k < j; k++ {
+				args = append(args, gaugeNames[k], values[k])
+			}
+			_, err = tx.ExecContext(ctx, `
+                INSERT INTO observability.samples (type, ts, name, value) VALUES `+valuesRows(j-i, 2, "$1", "$2"), args...)
+			if err != nil {
+				return errors.Wrap(err, "[pg.Saver.saveSamples] insert gauge samples")
+			}
+		}
+		for i := 0; i < len(counterNames); i += saveBatchSize {
+			j := min(i+saveBatchSize, len(counterNames))
+			args := make([]any, 0, 2*(j-i)+2)
+			args = append(args, metric.CounterMetricType, ts)
+			for k := i; k < j; k++ {
+				args = append(args, counterNames[k], deltas[k])
+			}
+			_, err = tx.ExecContext(ctx, `
+                INSERT INTO observability.samples (type, ts, name, delta) VALUES `+valuesRows(j-i, 2, "$1", "$2"), args...)
+			if err != nil {
+				return errors.Wrap(err, "[pg.Saver.saveSamples] insert counter samples")
+			}
+		}
+		return tx.Commit()
+	}
+
+	for i := 0; i < len(gaugeNames); i += saveBatchSize {
+		j := min(i+saveBatchSize, len(gaugeNames))
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO observability.samples (type, name, value, ts)
+                SELECT $1, name, value, $4 FROM unnest($2::text[], $3::double precision[]) AS t(name, value)`,
+			metric.GaugeMetricType, pq.Array(gaugeNames[i:j]), pq.Array(values[i:j]), now)
+		if err != nil {
+			return errors.Wrap(err, "[pg.Saver.saveSamples] insert gauge samples")
+		}
+	}
+	for i := 0; i < len(counterNames); i += saveBatchSize {
+		j := min(i+saveBatchSize, len(counterNames))
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO observability.samples (type, name, delta, ts)
+                SELECT $1, name, delta, $4 FROM unnest($2::text[], $3::bigint[]) AS t(name, delta)`,
+			metric.CounterMetricType, pq.Array(counterNames[i:j]), pq.Array(deltas[i:j]), now)
+		if err != nil {
+			return errors.Wrap(err, "[pg.Saver.saveSamples] insert counter samples")
+		}
+	}
+
+	return tx.Commit()
+}
+
+// saveSQLite writes changes with multi-row VALUES, SQLite has no arrays to unnest
+func saveSQLite(ctx context.Context, tx *sql.Tx, changes storage.Changes) error {
+	names, values := sortedGauges(changes.Gauges)
+	for i := 0; i < len(names); i += saveBatchSize {
+		j := min(i+saveBatchSize, len(names))
+		args := make([]any, 0, 2*(j-i)+1)
+		args = append(args, metric.GaugeMetricType)
+		for k := i; k < j; k++ {
+			args = append(args, names[k], values[k])
+		}
+
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO observability.metrics (type, name, value) VALUES `+valuesRows(j-i, 2, "$1")+`
+                ON CONFLICT (type, name)
+                DO UPDATE SET value = excluded.value`, args...)
+		if err != nil {
+			return errors.Wrap(err, "upsert gauges")
+		}
+	}
+
+	names, deltas := sortedCounters(changes.Counters)
+	for i := 0; i < len(names); i += saveBatchSize {
+		j := min(i+saveBatchSize, len(names))
+		args := make([]any, 0, 2*(j-i)+1)
+		args = append(args, metric.CounterMetricType)
+		for k := i; k < j; k++ {
+			args = append(args, names[k], deltas[k])
+		}
+
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO observability.metrics (type, name, delta) VALUES `+valuesRows(j-i, 2, "$1")+`
+                ON CONFLICT (type, name)
+                DO UPDATE SET delta = MAX(delta, excluded.delta)`, args...)
+		if err != nil {
+			return errors.Wrap(err, "upsert counters")
+		}
+	}
+
+	for _, k := range changes.Deleted {
+		_, err := tx.ExecContext(ctx, `DELETE FROM observability.metrics WHERE type = $1 AND name = $2`, k.Kind, k.ID)
+		if err != nil {
+			return errors.Wrap(err, "delete metrics")
+		}
+	}
+
+	return nil
+}
+
+// valuesRows returns rows tuples of the shared expressions followed by cols numbered
+// placeholders, numbering starts after the shared arguments
+func valuesRows(rows, cols int, shared ...string) string {
+	var b strings.Builder
+
+	n := len(shared) + 1
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for i, sh := range shared {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(sh)
+		}
+		for c := 0; c < cols; c++ {
+			if len(shared) > 0 || c > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("$" + strconv.Itoa(n))
+			n++
+		}
+		b.WriteByte(')')
+	}
+
+	return b.String()
+}
+
+// RunSaver saves changed metrics every interval seconds until stopChan is closed, then saves
+// the final state. With zero interval only the final save is done, updates are
+// expected to be persisted by a write hook.
+func RunSaver(s *Saver, ms *storage.MemStorage, interval int64, stopChan chan struct{}) {
+	// deletes made before the first save are kept for it
+	s.mu.Lock()
+	ms.Acknowledge(s, s.seq)
+	s.mu.Unlock()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			SaveAndReport(s, ms)
+		case <-stopChan:
+			SaveAndReport(s, ms)
+			slog.Info("stop database saver")
+			return
+		}
+	}
+}
+
+// SaveAndReport saves pending changes and logs the outcome
+func SaveAndReport(s *Saver, ms *storage.MemStorage) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stats, err := s.Save(ctx, ms)
+	if err != nil {
+		slog.Error("save metrics to database", "err", err)
+		return
+	}
+
+	if stats.Upserted > 0 || stats.Deleted > 0 {
+		slog.Info("metrics saved to database",
+			"upserted", stats.Upserted, "deleted", stats.Deleted, "duration", stats.Duration)
+	}
+}
+
+func sortedGauges(m map[string]float64) ([]string, []float64) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]float64, len(names))
+	for i, name := range names {
+		values[i] = m[name]
+	}
+
+	return names, values
+}
+
+func sortedCounters(m map[string]int64) ([]string, []int64) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	deltas := make([]int64, len(names))
+	for i, name := range names {
+		deltas[i] = m[name]
+	}
+
+	return names, deltas
+}
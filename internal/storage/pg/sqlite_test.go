@@ -0,0 +1,190 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errs "github.com/sshirox/isaac/internal/errors"
+	"github.com/sshirox/isaac/internal/storage"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	db, err := Open("sqlite://" + filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, Bootstrap(db, context.Background()))
+	return db
+}
+
+func TestDialectOf(t *testing.T) {
+	assert.Equal(t, DialectSQLite, DialectOf("sqlite:metrics.db"))
+	assert.Equal(t, DialectSQLite, DialectOf("sqlite:///var/lib/isaac/metrics.db"))
+	assert.Equal(t, DialectPostgres, DialectOf("postgres://localhost/isaac"))
+	assert.Equal(t, DialectPostgres, DialectOf("host=localhost dbname=isaac"))
+
+	_, err := Open("sqlite:")
+	assert.Error(t, err)
+}
+
+func TestSQLite_SaveAndList(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	ms := storage.NewMemStorage()
+	ms.UpdateGauge("Alloc", 1.5)
+	ms.UpdateGauge("Old", 2)
+	ms.UpdateCounter("PollCount", 5)
+
+	saver := NewSaver(db)
+	stats, err := saver.Save(ctx, ms)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Upserted)
+
+	ms.UpdateGauge("Alloc", 2.5)
+	ms.UpdateCounter("PollCount", 2)
+	ms.DeleteGauge("Old")
+	stats, err = saver.Save(ctx, ms)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Upserted)
+	assert.Equal(t, 1, stats.Deleted)
+
+	loaded := storage.NewMemStorage()
+	require.NoError(t, ListMetrics(db, loaded))
+	assert.Equal(t, map[string]float64{"Alloc": 2.5}, loaded.ReceiveAllGauges())
+	assert.Equal(t, map[string]int64{"PollCount": 7}, loaded.ReceiveAllCounters())
+}
+
+func TestSaver_NonRetryError(t *testing.T) {
+	db := openSQLite(t)
+	require.NoError(t, db.Close())
+
+	ms := storage.NewMemStorage()
+	ms.UpdateGauge("Alloc", 1)
+
+	start := time.Now()
+	_, err := NewSaver(db).Save(context.Background(), ms)
+	assert.ErrorIs(t, err, errs.ErrNonRetry)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestSQLite_CatchUpCounters(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	leader := storage.NewMemStorage()
+	leader.UpdateCounter("PollCount", 10)
+	leader.UpdateCounter("Lagging", 1)
+	_, err := NewSaver(db).Save(ctx, leader)
+	require.NoError(t, err)
+
+	// The replica missed some increments and then took over the leadership.
+	replica := storage.NewMemStorage()
+	replica.UpdateCounter("PollCount", 4)
+	replica.UpdateCounter("Lagging", 3)
+	saver := NewSaver(db)
+	_, err = saver.Save(ctx, replica)
+	require.NoError(t, err)
+
+	stored := storage.NewMemStorage()
+	require.NoError(t, ListMetrics(db, stored))
+	assert.Equal(t, map[string]int64{"PollCount": 10, "Lagging": 3}, stored.ReceiveAllCounters())
+
+	sub := replica.Subscribe(1)
+	defer sub.Close()
+
+	raised, err := CatchUpCounters(ctx, db, replica)
+	require.NoError(t, err)
+	assert.Equal(t, 1, raised)
+	assert.Equal(t, map[string]int64{"PollCount": 10, "Lagging": 3}, replica.ReceiveAllCounters())
+
+	u := <-sub.C()
+	assert.Equal(t, "PollCount", u.ID)
+	assert.Equal(t, int64(6), u.Increment)
+	assert.True(t, u.Replicated)
+}
+
+func TestSQLite_History(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	h, err := NewHistory(db, PartitionDaily, time.Hour)
+	require.NoError(t, err)
+
+	saver := NewSaver(db)
+	saver.RecordSamples()
+
+	ms := storage.NewMemStorage()
+	from := time.Now()
+	for i := 1; i <= 3; i++ {
+		ms.UpdateGauge("Alloc", float64(i))
+		_, err = saver.Save(ctx, ms)
+		require.NoError(t, err)
+	}
+
+	samples, err := h.Query(ctx, "gauge", "Alloc", from, time.Now().Add(time.Second), 0)
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.Equal(t, 1.0, *samples[0].Value)
+	assert.Equal(t, 3.0, *samples[2].Value)
+	assert.False(t, samples[0].Time.After(samples[2].Time))
+
+	require.NoError(t, h.Maintain(ctx, time.Now().Add(2*time.Hour)))
+	samples, err = h.Query(ctx, "gauge", "Alloc", from, time.Now().Add(time.Second), 0)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestSQLite_SamplesFailure(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	saver := NewSaver(db)
+	saver.RecordSamples()
+
+	// Like a missing partition, samples cannot be inserted but metrics are still saved.
+	_, err := db.ExecContext(ctx, `DROP TABLE observability.samples`)
+	require.NoError(t, err)
+
+	ms := storage.NewMemStorage()
+	ms.UpdateGauge("Alloc", 1.5)
+	ms.UpdateCounter("PollCount", 5)
+	stats, err := saver.Save(ctx, ms)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Upserted)
+
+	loaded := storage.NewMemStorage()
+	require.NoError(t, ListMetrics(db, loaded))
+	assert.Equal(t, map[string]float64{"Alloc": 1.5}, loaded.ReceiveAllGauges())
+	assert.Equal(t, map[string]int64{"PollCount": 5}, loaded.ReceiveAllCounters())
+}
+
+func TestSQLite_Migrate(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	migrations, err := Migrations(DialectSQLite)
+	require.NoError(t, err)
+
+	version, err := SchemaVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	require.NoError(t, Migrate(ctx, db, 0))
+	version, err = SchemaVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+
+	require.NoError(t, Migrate(ctx, db, -1))
+	statuses, err := MigrationsStatus(ctx, db)
+	require.NoError(t, err)
+	for _, st := range statuses {
+		assert.NotNil(t, st.AppliedAt, st.String())
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSlowSubscriber is reported by a subscription that could not keep up with updates
+var ErrSlowSubscriber = errors.New("subscriber is too slow")
+
+// Update describes a single change applied to the storage.
+// Delta is the counter total after the change, Increment the amount added by it.
+// Replicated marks changes received from another server sharing the storage.
+type Update struct {
+	Kind       string
+	ID         string
+	Value      float64
+	Delta      int64
+	Increment  int64
+	Labels     map[string]string
+	Deleted    bool
+	Replicated bool
+	Time       time.Time
+}
+
+// Subscription delivers storage updates until it is closed
+type Subscription struct {
+	ms  *MemStorage
+	ch  chan Update
+	err error
+}
+
+// Subscribe registers a subscription buffering up to size updates.
+// Publishing never blocks: a subscriber whose buffer is full is dropped,
+// its channel is closed and Err returns ErrSlowSubscriber.
+func (ms *MemStorage) Subscribe(size int) *Subscription {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sub := &Subscription{
+		ms: ms,
+		ch: make(chan Update, size),
+	}
+	ms.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// C returns the channel of updates
+func (sub *Subscription) C() <-chan Update {
+	return sub.ch
+}
+
+// Err returns the reason the subscription was dropped by the storage
+func (sub *Subscription) Err() error {
+	sub.ms.mu.RLock()
+	defer sub.ms.mu.RUnlock()
+
+	return sub.err
+}
+
+// Close unregisters the subscription
+func (sub *Subscription) Close() {
+	sub.ms.mu.Lock()
+	defer sub.ms.mu.Unlock()
+
+	if _, ok := sub.ms.subs[sub]; ok {
+		delete(sub.ms.subs, sub)
+		close(sub.ch)
+	}
+}
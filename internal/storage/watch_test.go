@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemStorage_Subscribe(t *testing.T) {
+	ms := NewMemStorage()
+	sub := ms.Subscribe(10)
+
+	ms.UpdateCounter("PollCount", 2)
+	ms.UpdateCounter("PollCount", 3)
+	ms.UpdateGauge("Alloc", 1.5)
+
+	u := <-sub.C()
+	assert.Equal(t, int64(2), u.Delta)
+	u = <-sub.C()
+	assert.Equal(t, int64(5), u.Delta)
+	u = <-sub.C()
+	assert.Equal(t, "Alloc", u.ID)
+	assert.Equal(t, 1.5, u.Value)
+
+	sub.Close()
+	_, ok := <-sub.C()
+	assert.False(t, ok)
+	assert.NoError(t, sub.Err())
+}
+
+func TestMemStorage_SubscribeOverflow(t *testing.T) {
+	ms := NewMemStorage()
+	sub := ms.Subscribe(1)
+
+	ms.UpdateGauge("Alloc", 1)
+	ms.UpdateGauge("Alloc", 2)
+
+	<-sub.C()
+	_, ok := <-sub.C()
+	assert.False(t, ok)
+	assert.ErrorIs(t, sub.Err(), ErrSlowSubscriber)
+
+	sub.Close()
+}
+
+func TestMemStorage_ApplyReplicated(t *testing.T) {
+	ms := NewMemStorage()
+	ms.UpdateCounter("PollCount", 2)
+	sub := ms.Subscribe(10)
+
+	ms.ApplyReplicated(Update{Kind: "counter", ID: "PollCount", Increment: 3})
+	ms.ApplyReplicated(Update{Kind: "gauge", ID: "Alloc", Value: 1.5})
+	ms.ApplyReplicated(Update{Kind: "gauge", ID: "Missing", Deleted: true})
+
+	v, _ := ms.ReceiveCounter("PollCount")
+	assert.Equal(t, int64(5), v)
+	g, _ := ms.ReceiveGauge("Alloc")
+	assert.Equal(t, 1.5, g)
+
+	u := <-sub.C()
+	assert.True(t, u.Replicated)
+	assert.Equal(t, int64(5), u.Delta)
+	assert.Equal(t, int64(3), u.Increment)
+	u = <-sub.C()
+	assert.True(t, u.Replicated)
+	assert.Equal(t, "Alloc", u.ID)
+	assert.Empty(t, sub.C())
+
+	ms.ApplyReplicated(Update{Kind: "counter", ID: "PollCount", Deleted: true})
+	_, ok := ms.ReceiveCounter("PollCount")
+	assert.False(t, ok)
+
+	sub.Close()
+}
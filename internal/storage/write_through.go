@@ -0,0 +1,50 @@
+package storage
+
+import "sync"
+
+// writeThrough runs saves for mutating calls. A call waits for a save started after its
+// change, calls arriving while a save runs share the next one.
+type writeThrough struct {
+	ms   *MemStorage
+	save func()
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	saving bool
+	// saved is the sequence number the latest finished save covers
+	saved uint64
+}
+
+// SetWriteThrough makes every change return only once save, started after the change,
+// has finished. Concurrent changes are coalesced into one save, a failed save is not
+// retried by the waiting calls.
+func (ms *MemStorage) SetWriteThrough(save func()) {
+	w := &writeThrough{ms: ms, save: save, saved: ms.Seq()}
+	w.cond = sync.NewCond(&w.mu)
+	ms.SetWriteHook(w.wait)
+}
+
+func (w *writeThrough) wait() {
+	seq := w.ms.Seq()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.saved < seq {
+		if w.saving {
+			w.cond.Wait()
+			continue
+		}
+
+		w.saving = true
+		w.mu.Unlock()
+		// the save reads the storage after this point, so it covers every change up to covered
+		covered := w.ms.Seq()
+		w.save()
+		w.mu.Lock()
+
+		w.saving = false
+		w.saved = max(w.saved, covered)
+		w.cond.Broadcast()
+	}
+}
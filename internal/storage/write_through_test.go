@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemStorage_SetWriteThrough(t *testing.T) {
+	ms := NewMemStorage()
+
+	var (
+		mu    sync.Mutex
+		saved map[string]float64
+		saves atomic.Int64
+	)
+	ms.SetWriteThrough(func() {
+		saves.Add(1)
+		gauges := ms.ReceiveAllGauges()
+		mu.Lock()
+		saved = gauges
+		mu.Unlock()
+	})
+
+	// the sink holds the value by the time the update returns
+	ms.UpdateGauge("Alloc", 1)
+	mu.Lock()
+	assert.Equal(t, 1.0, saved["Alloc"])
+	mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(v float64) {
+			defer wg.Done()
+			ms.UpdateGauge("Frees", v)
+			mu.Lock()
+			defer mu.Unlock()
+			_, ok := saved["Frees"]
+			assert.True(t, ok)
+		}(float64(i))
+	}
+	wg.Wait()
+
+	// the last save covers every update
+	assert.Positive(t, saves.Load())
+	mu.Lock()
+	assert.Equal(t, ms.ReceiveAllGauges(), saved)
+	mu.Unlock()
+}